@@ -0,0 +1,381 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat names the format of an archive.
+type ArchiveFormat string
+
+// Archive formats.
+const (
+	ArchiveTar   ArchiveFormat = "tar"
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+	ArchiveZip   ArchiveFormat = "zip"
+)
+
+// ArchiveOptions control which entries of a tree exportArchive writes and how.
+type ArchiveOptions struct {
+	// Format is the format of the archive. When empty, it is chosen from the extension of
+	// the destination: .tar, .tar.gz or .tgz, or .zip.
+	Format ArchiveFormat `json:"format,omitempty"`
+	// Include holds file name patterns to include; when empty, every file is included.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"` // file and directory name patterns to exclude
+}
+
+// NewArchiveBackend returns a read-only Backend serving the files of a tar, gzip-compressed
+// tar or zip archive, detected from its content. The archive is read into memory. Paths
+// are resolved against the root of the archive, so "/a/b", "a/b" and "./a/b" all name the
+// same file, and entries cannot escape it through "..". Symbolic links are left out, and
+// hard links in tar archives become copies of the file they link to.
+func NewArchiveBackend(data []byte) (Backend, error) {
+	memory := NewMemoryBackend()
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		err = readZip(memory, data)
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")):
+		var reader *gzip.Reader
+		if reader, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			err = readTar(memory, reader)
+		}
+	default:
+		err = readTar(memory, bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewReadOnlyBackend(memory), nil
+}
+
+// openArchive returns a read-only Backend serving the files of the archive at path.
+func openArchive(backend Backend, path string) (Backend, error) {
+	data, err := backend.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := NewArchiveBackend(data)
+	if err != nil {
+		return nil, fmt.Errorf("open archive %s: %w", path, err)
+	}
+	return archive, nil
+}
+
+// archiveLoader adds the entries of an archive to memory. Directories get their modification
+// times once every entry is added, as adding entries changes them.
+type archiveLoader struct {
+	memory  *MemoryBackend
+	dirs    map[string]time.Time
+	content map[string][]byte // files by cleaned name, for tar hard links
+}
+
+// newArchiveLoader returns an archiveLoader adding entries to memory.
+func newArchiveLoader(memory *MemoryBackend) *archiveLoader {
+	return &archiveLoader{memory: memory, dirs: map[string]time.Time{}, content: map[string][]byte{}}
+}
+
+func (a *archiveLoader) addDir(name string, mode fs.FileMode, modTime time.Time) error {
+	if err := a.memory.MkdirAll(name, mode.Perm()|0700); err != nil {
+		return err
+	}
+	a.dirs[fsName(name)] = modTime
+	return nil
+}
+
+func (a *archiveLoader) addFile(name string, data []byte, mode fs.FileMode, modTime time.Time) error {
+	if mode.Perm() == 0 {
+		mode = 0644
+	}
+	if err := a.memory.MkdirAll(path.Dir(fsName(name)), 0755); err != nil {
+		return err
+	}
+	if err := a.memory.WriteFile(name, data, mode.Perm()); err != nil {
+		return err
+	}
+	a.content[fsName(name)] = data
+	return a.memory.Chtimes(name, modTime)
+}
+
+// finish sets the modification times of the directories.
+func (a *archiveLoader) finish() error {
+	for name, modTime := range a.dirs {
+		if err := a.memory.Chtimes(name, modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTar adds the entries of a tar archive to memory.
+func readTar(memory *MemoryBackend, r io.Reader) error {
+	entries := newArchiveLoader(memory)
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		info := header.FileInfo()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = entries.addDir(header.Name, info.Mode(), header.ModTime)
+		case tar.TypeReg:
+			var data []byte
+			if data, err = io.ReadAll(reader); err == nil {
+				err = entries.addFile(header.Name, data, info.Mode(), header.ModTime)
+			}
+		case tar.TypeLink:
+			data, ok := entries.content[fsName(header.Linkname)]
+			if !ok {
+				return &fs.PathError{Op: "link", Path: header.Name, Err: fs.ErrNotExist}
+			}
+			err = entries.addFile(header.Name, data, info.Mode(), header.ModTime)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return entries.finish()
+}
+
+// readZip adds the entries of a zip archive to memory.
+func readZip(memory *MemoryBackend, data []byte) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	entries := newArchiveLoader(memory)
+	for _, file := range reader.File {
+		mode := file.Mode()
+		switch {
+		case mode.IsDir() || strings.HasSuffix(file.Name, "/"):
+			err = entries.addDir(file.Name, mode, file.Modified)
+		case mode.IsRegular():
+			var content io.ReadCloser
+			if content, err = file.Open(); err != nil {
+				return err
+			}
+			var data []byte
+			data, err = io.ReadAll(content)
+			content.Close()
+			if err == nil {
+				err = entries.addFile(file.Name, data, mode, file.Modified)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return entries.finish()
+}
+
+// archiveFormat returns the format of an archive written to path with options.
+func archiveFormat(path string, options ArchiveOptions) (ArchiveFormat, error) {
+	if options.Format != "" {
+		switch options.Format {
+		case ArchiveTar, ArchiveTarGz, ArchiveZip:
+			return options.Format, nil
+		}
+		return "", fmt.Errorf("unknown archive format %q", options.Format)
+	}
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		return ArchiveTarGz, nil
+	case strings.HasSuffix(name, ".tar"):
+		return ArchiveTar, nil
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveZip, nil
+	}
+	return "", fmt.Errorf("cannot tell the archive format of %s", path)
+}
+
+// archiveWriter writes entries of one of the archive formats.
+type archiveWriter interface {
+	writeDir(name string, info fs.FileInfo) error
+	writeFile(name string, info fs.FileInfo, data []byte) error
+	writeLink(name string, info fs.FileInfo, target string) error
+	Close() error
+}
+
+type tarWriter struct {
+	*tar.Writer
+}
+
+func (w tarWriter) writeHeader(name string, info fs.FileInfo, link string) error {
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	return w.WriteHeader(header)
+}
+
+func (w tarWriter) writeDir(name string, info fs.FileInfo) error {
+	return w.writeHeader(name, info, "")
+}
+
+func (w tarWriter) writeFile(name string, info fs.FileInfo, data []byte) error {
+	if err := w.writeHeader(name, info, ""); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (w tarWriter) writeLink(name string, info fs.FileInfo, target string) error {
+	return w.writeHeader(name, info, target)
+}
+
+// gzipTarWriter is a tarWriter that also closes its gzip stream.
+type gzipTarWriter struct {
+	tarWriter
+	gzip *gzip.Writer
+}
+
+func (w gzipTarWriter) Close() error {
+	if err := w.tarWriter.Close(); err != nil {
+		return err
+	}
+	return w.gzip.Close()
+}
+
+type zipWriter struct {
+	*zip.Writer
+}
+
+func (w zipWriter) create(name string, info fs.FileInfo) (io.Writer, error) {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	} else if info.Mode().IsRegular() {
+		header.Method = zip.Deflate
+	}
+	return w.CreateHeader(header)
+}
+
+func (w zipWriter) writeDir(name string, info fs.FileInfo) error {
+	_, err := w.create(name, info)
+	return err
+}
+
+func (w zipWriter) writeFile(name string, info fs.FileInfo, data []byte) error {
+	writer, err := w.create(name, info)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+func (w zipWriter) writeLink(name string, info fs.FileInfo, target string) error {
+	return w.writeFile(name, info, []byte(target))
+}
+
+// exportArchive writes the entries of tree to a new archive at dst, named by their
+// slash-separated path relative to the root of the tree, or by its name if the tree is a
+// single file. Files must match the include patterns, and files and directories matching
+// the exclude patterns are left out with everything below them, as are the entries a tree
+// has omitted. Symbolic links are stored as links. The archive is built in memory and
+// written atomically.
+func exportArchive(backend WritableBackend, tree DirectoryTree, dst string, options ArchiveOptions) error {
+	format, err := archiveFormat(dst, options)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	var writer archiveWriter
+	switch format {
+	case ArchiveTar:
+		writer = tarWriter{tar.NewWriter(&buf)}
+	case ArchiveTarGz:
+		compressed := gzip.NewWriter(&buf)
+		writer = gzipTarWriter{tarWriter{tar.NewWriter(compressed)}, compressed}
+	case ArchiveZip:
+		writer = zipWriter{zip.NewWriter(&buf)}
+	}
+	children := tree.Children
+	if tree.IsFile {
+		children = []DirectoryTree{tree}
+	}
+	exporter := archiveExporter{backend: backend, writer: writer, options: options}
+	for _, child := range children {
+		if err := exporter.export(child, child.Name); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return writeFile(backend, dst, buf.Bytes())
+}
+
+// archiveExporter writes the entries of a tree read from backend to an archive.
+type archiveExporter struct {
+	backend Backend
+	writer  archiveWriter
+	options ArchiveOptions
+}
+
+// export writes node to the archive as name, followed by its children.
+func (e archiveExporter) export(node DirectoryTree, name string) error {
+	if node.Omitted != nil || isExcluded(node.Name, e.options.Exclude) {
+		return nil
+	}
+	if node.IsFile && !isIncluded(node.Name, e.options.Include) {
+		return nil
+	}
+	info, err := e.backend.Lstat(node.Path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case isSymlink(info):
+		target, err := e.backend.ReadLink(node.Path)
+		if err != nil {
+			return err
+		}
+		return e.writer.writeLink(name, info, target)
+	case info.IsDir():
+		if err := e.writer.writeDir(name, info); err != nil {
+			return err
+		}
+		for _, child := range node.Children {
+			if err := e.export(child, name+"/"+child.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case info.Mode().IsRegular():
+		data, err := readFile(e.backend, node.Path)
+		if err != nil {
+			return err
+		}
+		return e.writer.writeFile(name, info, data)
+	}
+	err = errors.New("not a regular file, directory or link")
+	return &fs.PathError{Op: "archive", Path: node.Path, Err: err}
+}
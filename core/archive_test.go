@@ -0,0 +1,164 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportArchive(t *testing.T) {
+	memory := NewMemoryBackend()
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for path, content := range map[string]string{
+		"/repo/main.go":           "package main\n",
+		"/repo/README.md":         "# repo\n",
+		"/repo/pkg/util.go":       "package pkg\n",
+		"/repo/pkg/util_test.go":  "package pkg\n",
+		"/repo/node_modules/x.go": "package x\n",
+	} {
+		if err := memory.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := memory.WriteFile(path, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := memory.Chtimes(path, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys := NewFS(memory)
+	tree, err := fsys.BuildDirTree("/repo", TreeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dst := range []string{"/out/repo.tar", "/out/repo.tar.gz", "/out/repo.tgz", "/out/repo.zip"} {
+		t.Run(filepath.Base(dst), func(t *testing.T) {
+			if err := memory.MkdirAll("/out", 0755); err != nil {
+				t.Fatal(err)
+			}
+			options := ArchiveOptions{Include: []string{"*.go"}, Exclude: []string{"node_modules", "*_test.go"}}
+			if err := fsys.ExportArchive(tree, dst, options); err != nil {
+				t.Fatal(err)
+			}
+			archive, err := fsys.OpenArchive(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			err = walkDir(archive, "/", func(path string, entry fs.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() {
+					files = append(files, path)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"/main.go", "/pkg/util.go"}; !reflect.DeepEqual(files, want) {
+				t.Errorf("files = %v, want %v", files, want)
+			}
+			if data, err := readFile(archive, "pkg/util.go"); err != nil || string(data) != "package pkg\n" {
+				t.Errorf("content = %q, %v", data, err)
+			}
+			info, err := archive.Stat("/main.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0640 || !info.ModTime().Equal(modTime) {
+				t.Errorf("main.go has mode %v and time %v", info.Mode(), info.ModTime())
+			}
+			if err := NewFS(archive).WriteFile("/main.go", nil); !errors.Is(err, ErrReadOnly) {
+				t.Errorf("writing to an archive: got %v, want ErrReadOnly", err)
+			}
+		})
+	}
+
+	if err := fsys.ExportArchive(tree, "/out/repo.rar", ArchiveOptions{}); err == nil {
+		t.Error("exporting to an unknown format did not fail")
+	}
+}
+
+func TestExportArchive_Symlink(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	tree, err := BuildDirTree(dir, TreeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "out.tar")
+	if err := ExportArchive(tree, dst, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := tar.NewReader(bytes.NewReader(data))
+	links := map[string]string{}
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			break
+		}
+		if header.Typeflag == tar.TypeSymlink {
+			links[header.Name] = header.Linkname
+		}
+	}
+	if !reflect.DeepEqual(links, map[string]string{"link": "a.txt"}) {
+		t.Errorf("links = %v", links)
+	}
+}
+
+func TestNewArchiveBackend_Tar(t *testing.T) {
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for _, header := range []*tar.Header{
+		{Name: "../../escape.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+		{Name: "hard.txt", Typeflag: tar.TypeLink, Linkname: "escape.txt"},
+		{Name: "link.txt", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+	} {
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			writer.Write([]byte("x"))
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := NewArchiveBackend(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := archive.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"escape.txt", "hard.txt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("entries = %v, want %v", names, want)
+	}
+	if data, err := archive.ReadFile("hard.txt"); err != nil || string(data) != "x" {
+		t.Errorf("hard link = %q, %v", data, err)
+	}
+
+	if _, err := NewArchiveBackend([]byte("not an archive")); err == nil {
+		t.Error("reading a malformed archive did not fail")
+	}
+}
@@ -0,0 +1,405 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Operations recorded by an AuditBackend.
+const (
+	AuditRead      = "read"       // reading file contents
+	AuditWrite     = "write"      // writing a file
+	AuditPatch     = "patch"      // writing a file through ApplyPatch or ApplyStructuredEdit
+	AuditCopy      = "copy"       // writing a file as a copy of another
+	AuditSymlink   = "symlink"    // creating a symbolic link
+	AuditDelete    = "delete"     // removing a file or directory
+	AuditCreateDir = "create_dir" // creating a directory
+	AuditRename    = "rename"     // moving a file or directory
+	AuditSearch    = "search"     // searching files
+	AuditTree      = "tree"       // building a directory tree
+	AuditChmod     = "chmod"      // changing the mode of a file or directory
+	AuditChtimes   = "chtimes"    // changing the modification time of a file or directory
+)
+
+// AuditEvent records a single filesystem operation.
+type AuditEvent struct {
+	Time         time.Time   `json:"time"`
+	Session      string      `json:"session,omitempty"`
+	Actor        string      `json:"actor,omitempty"`
+	Op           string      `json:"op"`
+	Path         string      `json:"path"`
+	NewPath      string      `json:"new_path,omitempty"` // destination of a rename
+	Target       string      `json:"target,omitempty"`   // target of a created link
+	Query        string      `json:"query,omitempty"`    // query of a search
+	Matches      int         `json:"matches,omitempty"`  // number of search results
+	BytesRead    int64       `json:"bytes_read,omitempty"`
+	BytesWritten int64       `json:"bytes_written,omitempty"`
+	Mode         fs.FileMode `json:"mode,omitempty"`    // permissions of a written file or of a chmod
+	ModTime      time.Time   `json:"mod_time,omitzero"` // modification time set by chtimes
+	Diff         string      `json:"diff,omitempty"`    // unified diff of a patch
+	Content      []byte      `json:"content,omitempty"` // written content, used for replay
+	Error        string      `json:"error,omitempty"`   // empty if the operation succeeded
+}
+
+// AuditSink receives the events recorded by an AuditBackend. Record may be called from
+// multiple goroutines.
+type AuditSink interface {
+	Record(event AuditEvent) error
+}
+
+// AuditFunc adapts a function to an AuditSink.
+type AuditFunc func(event AuditEvent) error
+
+// Record calls f(event).
+func (f AuditFunc) Record(event AuditEvent) error {
+	return f(event)
+}
+
+// JSONLSink is an AuditSink writing one JSON object per line.
+type JSONLSink struct {
+	mu      sync.Mutex
+	w       io.Writer
+	encoder *json.Encoder
+}
+
+// NewJSONLSink returns a sink writing events to w.
+func NewJSONLSink(w io.Writer) *JSONLSink {
+	return &JSONLSink{w: w, encoder: json.NewEncoder(w)}
+}
+
+// OpenAuditLog returns a sink appending events to the file at path, which is created if
+// it does not exist. Close the sink to close the file.
+func OpenAuditLog(path string) (*JSONLSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLSink(f), nil
+}
+
+// Record writes event as a line of JSON.
+func (s *JSONLSink) Record(event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(event)
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (s *JSONLSink) Close() error {
+	if closer, ok := s.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// AuditOptions configures an AuditBackend.
+type AuditOptions struct {
+	Session string // session ID included in every event
+	Actor   string // actor ID included in every event
+	// OmitContent leaves written content out of events. The log is smaller, but its
+	// writes and patches cannot be replayed.
+	OmitContent bool
+}
+
+// AuditBackend records every operation on another backend to an AuditSink. Reads,
+// writes, deletions, renames and directory creations are recorded by the backend itself;
+// searches and trees are recorded as a single event without the reads they make, and
+// patches as a write with the diff of the change. Stat, Lstat and ReadDir are not
+// recorded.
+//
+// If an operation succeeds but its event cannot be recorded, the operation returns the
+// sink's error.
+type AuditBackend struct {
+	backend Backend
+	sink    AuditSink
+	options AuditOptions
+	// op is set on views used by operations that record themselves: reads are left out
+	// and writes are recorded as op.
+	op string
+}
+
+// NewAuditBackend returns backend recording its operations to sink.
+func NewAuditBackend(backend Backend, sink AuditSink, options AuditOptions) *AuditBackend {
+	return &AuditBackend{backend: backend, sink: sink, options: options}
+}
+
+// record sends event to the sink, completed with the time, IDs and the outcome err. It
+// returns err, or the sink's error if err is nil.
+func (a *AuditBackend) record(event AuditEvent, err error) error {
+	event.Time = time.Now()
+	event.Session = a.options.Session
+	event.Actor = a.options.Actor
+	if err != nil {
+		event.Error = err.Error()
+	}
+	if a.options.OmitContent {
+		event.Content = nil
+	}
+	if recordErr := a.sink.Record(event); recordErr != nil && err == nil {
+		return fmt.Errorf("could not record audit event: %w", recordErr)
+	}
+	return err
+}
+
+func (a *AuditBackend) unwrap() Backend {
+	return a.backend
+}
+
+func (a *AuditBackend) withOperation(op string, inner Backend) Backend {
+	view := *a
+	view.backend = inner
+	view.op = op
+	return &view
+}
+
+// Open opens a file for reading. The read is recorded when the file is closed, with the
+// number of bytes read from it.
+func (a *AuditBackend) Open(name string) (fs.File, error) {
+	f, err := a.backend.Open(name)
+	if a.op != "" {
+		return f, err
+	}
+	if err != nil {
+		return nil, a.record(AuditEvent{Op: AuditRead, Path: name}, err)
+	}
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return f, nil
+	}
+	file := &auditFile{File: f, backend: a, path: name}
+	if _, ok := f.(io.ReaderAt); ok {
+		return auditFileAt{file}, nil
+	}
+	return file, nil
+}
+
+// Stat returns the file info of a path, following links.
+func (a *AuditBackend) Stat(name string) (fs.FileInfo, error) {
+	return a.backend.Stat(name)
+}
+
+// Lstat returns the file info of a path without following a final link.
+func (a *AuditBackend) Lstat(name string) (fs.FileInfo, error) {
+	return a.backend.Lstat(name)
+}
+
+// ReadDir returns the entries of a directory sorted by name.
+func (a *AuditBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return a.backend.ReadDir(name)
+}
+
+// ReadFile returns the content of a file.
+func (a *AuditBackend) ReadFile(name string) ([]byte, error) {
+	data, err := a.backend.ReadFile(name)
+	if a.op != "" {
+		return data, err
+	}
+	if err := a.record(AuditEvent{Op: AuditRead, Path: name, BytesRead: int64(len(data))}, err); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReadLink returns the target of a symbolic link.
+func (a *AuditBackend) ReadLink(name string) (string, error) {
+	return a.backend.ReadLink(name)
+}
+
+// WriteFile writes a file. Writes made by a patch include the diff of the change.
+func (a *AuditBackend) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	event := AuditEvent{Op: AuditWrite, Path: name, BytesWritten: int64(len(data)), Mode: perm, Content: data}
+	if a.op != "" {
+		event.Op = a.op
+	}
+	if event.Op == AuditPatch {
+		old, _ := a.backend.ReadFile(name)
+		event.Diff = unifiedDiff(diffName("a", name), diffName("b", name), old, data)
+	}
+	backend, err := writableBackend(a.backend, "write", name)
+	if err == nil {
+		err = backend.WriteFile(name, data, perm)
+	}
+	return a.record(event, err)
+}
+
+// MkdirAll creates a directory along with any missing parents.
+func (a *AuditBackend) MkdirAll(name string, perm fs.FileMode) error {
+	backend, err := writableBackend(a.backend, "mkdir", name)
+	if err == nil {
+		err = backend.MkdirAll(name, perm)
+	}
+	return a.record(AuditEvent{Op: AuditCreateDir, Path: name, Mode: perm}, err)
+}
+
+// Remove removes a file or an empty directory.
+func (a *AuditBackend) Remove(name string) error {
+	backend, err := writableBackend(a.backend, "remove", name)
+	if err == nil {
+		err = backend.Remove(name)
+	}
+	return a.record(AuditEvent{Op: AuditDelete, Path: name}, err)
+}
+
+// RemoveAll removes a path and everything below it.
+func (a *AuditBackend) RemoveAll(name string) error {
+	backend, err := writableBackend(a.backend, "remove", name)
+	if err == nil {
+		err = backend.RemoveAll(name)
+	}
+	return a.record(AuditEvent{Op: AuditDelete, Path: name}, err)
+}
+
+// Rename moves a file or directory.
+func (a *AuditBackend) Rename(oldname, newname string) error {
+	backend, err := writableBackend(a.backend, "rename", oldname)
+	if err == nil {
+		err = backend.Rename(oldname, newname)
+	}
+	return a.record(AuditEvent{Op: AuditRename, Path: oldname, NewPath: newname}, err)
+}
+
+// Chmod changes the mode of a file or directory.
+func (a *AuditBackend) Chmod(name string, mode fs.FileMode) error {
+	backend, err := writableBackend(a.backend, "chmod", name)
+	if err == nil {
+		err = backend.Chmod(name, mode)
+	}
+	return a.record(AuditEvent{Op: AuditChmod, Path: name, Mode: mode}, err)
+}
+
+// Chtimes changes the modification time of a file or directory.
+func (a *AuditBackend) Chtimes(name string, modTime time.Time) error {
+	backend, err := writableBackend(a.backend, "chtimes", name)
+	if err == nil {
+		err = backend.Chtimes(name, modTime)
+	}
+	return a.record(AuditEvent{Op: AuditChtimes, Path: name, ModTime: modTime}, err)
+}
+
+// auditFile records a read with the number of bytes read when it is closed.
+type auditFile struct {
+	fs.File
+	backend *AuditBackend
+	path    string
+	mu      sync.Mutex
+	n       int64
+	err     error
+}
+
+func (f *auditFile) count(n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n += int64(n)
+	if err != nil && err != io.EOF && f.err == nil {
+		f.err = err
+	}
+}
+
+func (f *auditFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.count(n, err)
+	return n, err
+}
+
+func (f *auditFile) Close() error {
+	err := f.File.Close()
+	f.mu.Lock()
+	event, readErr := AuditEvent{Op: AuditRead, Path: f.path, BytesRead: f.n}, f.err
+	f.mu.Unlock()
+	if recordErr := f.backend.record(event, readErr); readErr == nil && err == nil {
+		err = recordErr
+	}
+	return err
+}
+
+// auditFileAt is an auditFile for files supporting io.ReaderAt.
+type auditFileAt struct {
+	*auditFile
+}
+
+func (f auditFileAt) ReadAt(p []byte, offset int64) (int, error) {
+	n, err := f.File.(io.ReaderAt).ReadAt(p, offset)
+	f.count(n, err)
+	return n, err
+}
+
+// recordAudit records event with the outcome err on every AuditBackend among backend and
+// the backends it wraps, and returns err or the first error recording it.
+func recordAudit(backend Backend, event AuditEvent, err error) error {
+	result := err
+	for _, backend := range wrappedBackends(backend) {
+		if a, ok := backend.(*AuditBackend); ok {
+			if recordErr := a.record(event, err); result == nil {
+				result = recordErr
+			}
+		}
+	}
+	return result
+}
+
+// readAuditLog reads the events of a JSONL audit log.
+func readAuditLog(r io.Reader) ([]AuditEvent, error) {
+	var events []AuditEvent
+	decoder := json.NewDecoder(r)
+	for {
+		var event AuditEvent
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read audit event %d: %w", len(events)+1, err)
+		}
+		events = append(events, event)
+	}
+}
+
+// replayAudit applies the successful writes, patches, deletions, renames, directory and
+// link creations and changes of modes and times of events to backend, in order.
+func replayAudit(backend WritableBackend, events []AuditEvent) error {
+	for i, event := range events {
+		if event.Error != "" {
+			continue
+		}
+		var err error
+		switch event.Op {
+		case AuditWrite, AuditPatch, AuditCopy:
+			if event.Content == nil && event.BytesWritten > 0 {
+				err = errors.New("the event has no content")
+				break
+			}
+			perm := event.Mode
+			if perm == 0 {
+				perm = 0644
+			}
+			err = backend.WriteFile(event.Path, event.Content, perm)
+		case AuditDelete:
+			err = backend.RemoveAll(event.Path)
+		case AuditCreateDir:
+			perm := event.Mode
+			if perm == 0 {
+				perm = 0755
+			}
+			err = backend.MkdirAll(event.Path, perm)
+		case AuditRename:
+			err = backend.Rename(event.Path, event.NewPath)
+		case AuditSymlink:
+			err = createSymlink(backend, event.Target, event.Path)
+		case AuditChmod:
+			err = backend.Chmod(event.Path, event.Mode)
+		case AuditChtimes:
+			err = backend.Chtimes(event.Path, event.ModTime)
+		}
+		if err != nil {
+			return fmt.Errorf("could not replay event %d (%s %s): %w", i+1, event.Op, event.Path, err)
+		}
+	}
+	return nil
+}
+
+var _ WritableBackend = (*AuditBackend)(nil)
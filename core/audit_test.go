@@ -0,0 +1,193 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newAuditTestBackend returns a memory backend holding a small project.
+func newAuditTestBackend(t *testing.T) *MemoryBackend {
+	t.Helper()
+	memory := NewMemoryBackend()
+	if err := memory.MkdirAll("/repo/docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		"/repo/main.go":       "package main\n\nfunc main() {}\n",
+		"/repo/docs/guide.md": "# guide\n",
+	} {
+		if err := memory.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return memory
+}
+
+func TestAuditBackend(t *testing.T) {
+	memory := newAuditTestBackend(t)
+	var log bytes.Buffer
+	sink := NewJSONLSink(&log)
+	fsys := NewFS(NewAuditBackend(memory, sink, AuditOptions{Session: "s1", Actor: "agent"}))
+
+	if _, err := fsys.ReadFile("/repo/main.go"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.ReadLines("/repo/main.go", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.ApplyPatch(FileEditRequest{
+		FilePath: "/repo/main.go",
+		Edits:    []EditInstruction{{Action: "replace", LineNumber: 3, NewContent: "func main() { run() }"}},
+	}, false, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.SearchFiles("/repo", "run", SearchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.BuildDirTree("/repo", TreeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.CreateDir("/repo/cmd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("/repo/cmd/run.go", []byte("package cmd\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.DeleteDir("/repo/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.ReadFile("/repo/missing.go"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("reading a missing file: %v", err)
+	}
+
+	events, err := ReadAuditLog(&log)
+	if err != nil {
+		t.Fatalf("ReadAuditLog failed: %v", err)
+	}
+	var ops []string
+	for _, event := range events {
+		ops = append(ops, event.Op+" "+event.Path)
+		if event.Session != "s1" || event.Actor != "agent" || event.Time.IsZero() {
+			t.Errorf("event is missing its session, actor or time: %+v", event)
+		}
+	}
+	want := []string{
+		"read /repo/main.go",
+		"read /repo/main.go",
+		"patch /repo/main.go",
+		"search /repo",
+		"tree /repo",
+		"create_dir /repo/cmd",
+		"write /repo/cmd/run.go",
+		"delete /repo/docs",
+		"read /repo/missing.go",
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("unexpected events:\n got %q\nwant %q", ops, want)
+	}
+	if events[0].BytesRead != 29 {
+		t.Errorf("read recorded %d bytes, want 29", events[0].BytesRead)
+	}
+	if patch := events[2]; !strings.HasPrefix(patch.Diff, "--- a/repo/") ||
+		!strings.Contains(patch.Diff, "-func main() {}\n+func main() { run() }\n") || patch.BytesWritten != 36 {
+		t.Errorf("unexpected patch event: %+v", patch)
+	}
+	if search := events[3]; search.Query != "run" || search.Matches != 1 {
+		t.Errorf("unexpected search event: %+v", search)
+	}
+	if failed := events[8]; failed.Error == "" {
+		t.Errorf("failed read has no error: %+v", failed)
+	}
+
+	// Replaying the log on the original files reconstructs the session.
+	replayed := newAuditTestBackend(t)
+	if err := NewFS(replayed).ReplayAudit(events); err != nil {
+		t.Fatalf("ReplayAudit failed: %v", err)
+	}
+	for _, path := range []string{"/repo/main.go", "/repo/cmd/run.go"} {
+		got, err := replayed.ReadFile(path)
+		if err != nil {
+			t.Errorf("replay is missing %s: %v", path, err)
+			continue
+		}
+		if expected, _ := memory.ReadFile(path); !bytes.Equal(got, expected) {
+			t.Errorf("replayed %s = %q, want %q", path, got, expected)
+		}
+	}
+	if _, err := replayed.Stat("/repo/docs"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("replay kept a deleted directory: %v", err)
+	}
+}
+
+func TestAuditBackend_SinkFailure(t *testing.T) {
+	failure := errors.New("disk full")
+	backend := NewAuditBackend(newAuditTestBackend(t), AuditFunc(func(AuditEvent) error { return failure }), AuditOptions{OmitContent: true})
+	if _, err := NewFS(backend).ReadFile("/repo/main.go"); !errors.Is(err, failure) {
+		t.Errorf("unrecorded read: got %v, want the sink's error", err)
+	}
+
+	var events []AuditEvent
+	backend = NewAuditBackend(newAuditTestBackend(t), AuditFunc(func(event AuditEvent) error {
+		events = append(events, event)
+		return nil
+	}), AuditOptions{OmitContent: true})
+	if err := NewFS(backend).WriteFile("/repo/main.go", []byte("package main\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Content != nil {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if err := replayAudit(NewMemoryBackend(), events); err == nil {
+		t.Error("replaying a write without content succeeded")
+	}
+}
+
+func TestAuditBackend_Symlinks(t *testing.T) {
+	root := createSymlinkTree(t)
+	var events []AuditEvent
+	backend := NewAuditBackend(OSBackend{}, AuditFunc(func(event AuditEvent) error {
+		events = append(events, event)
+		return nil
+	}), AuditOptions{})
+	dst := filepath.Join(t.TempDir(), "copy")
+	if err := NewFS(backend).CopyDir(filepath.Join(root, "sub"), dst); err != nil {
+		t.Fatal(err)
+	}
+	var links []AuditEvent
+	for _, event := range events {
+		if event.Op == AuditSymlink {
+			links = append(links, event)
+		}
+	}
+	if len(links) != 2 || links[0].Path != filepath.Join(dst, "link.txt") || links[0].Target != "file.txt" {
+		t.Fatalf("unexpected link events: %+v", links)
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := replayAudit(OSBackend{}, events); err != nil {
+		t.Fatalf("replaying the copy failed: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "loop")); err != nil || target != ".." {
+		t.Errorf("replayed link has target %q, %v", target, err)
+	}
+}
+
+func TestDiffName(t *testing.T) {
+	for path, want := range map[string]string{
+		"p.txt":        "a/p.txt",
+		"src/main.go":  "a/src/main.go",
+		"/src/main.go": "a/src/main.go",
+	} {
+		if got := diffName("a", path); got != want {
+			t.Errorf("diffName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
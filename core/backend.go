@@ -0,0 +1,255 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Backend is the storage core operates on. It extends io/fs.FS, with the difference that
+// names are paths as given to core functions (absolute or relative, in the platform's
+// format) rather than unrooted slash-separated names, plus the link operations that
+// io/fs lacks.
+type Backend interface {
+	fs.StatFS
+	fs.ReadDirFS
+	fs.ReadFileFS
+	// Lstat is like Stat but does not follow a final symbolic link.
+	Lstat(name string) (fs.FileInfo, error)
+	// ReadLink returns the target of a symbolic link.
+	ReadLink(name string) (string, error)
+}
+
+// WritableBackend is a Backend that can also be modified.
+type WritableBackend interface {
+	Backend
+	// WriteFile replaces the content of a file, creating it with perm if it does not exist.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	// MkdirAll creates a directory along with any missing parents.
+	MkdirAll(name string, perm fs.FileMode) error
+	// Remove removes a file or an empty directory.
+	Remove(name string) error
+	// RemoveAll removes a path and everything below it, succeeding if it does not exist.
+	RemoveAll(name string) error
+	// Rename moves a file or directory, replacing any file at newname.
+	Rename(oldname, newname string) error
+	// Chmod changes the permission bits of a file or directory.
+	Chmod(name string, mode fs.FileMode) error
+	// Chtimes changes the modification time of a file or directory.
+	Chtimes(name string, modTime time.Time) error
+}
+
+// writableBackend returns backend for an operation that modifies path, failing with
+// ErrReadOnly if it cannot be written to.
+func writableBackend(backend Backend, op, path string) (WritableBackend, error) {
+	if backend, ok := backend.(WritableBackend); ok {
+		return backend, nil
+	}
+	return nil, &fs.PathError{Op: op, Path: path, Err: ErrReadOnly}
+}
+
+// OSBackend is the Backend of the operating system's filesystem and the default for all
+// package-level functions.
+type OSBackend struct {
+	// NoSync skips flushing written files and their directories to disk, trading
+	// durability across crashes for speed, such as for scratch directories.
+	NoSync bool
+}
+
+// defaultBackend is the backend used by the package-level functions.
+var defaultBackend WritableBackend = OSBackend{}
+
+// Open opens a file for reading.
+func (OSBackend) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// Stat returns the file info of a path, following links.
+func (OSBackend) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Lstat returns the file info of a path without following a final link.
+func (OSBackend) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// ReadDir returns the entries of a directory sorted by name.
+func (OSBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// ReadFile returns the content of a file.
+func (OSBackend) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// ReadLink returns the target of a symbolic link.
+func (OSBackend) ReadLink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// WriteFile replaces a file atomically: data is written to a temporary file in the same
+// directory, which is flushed to disk and renamed over the file before the directory is
+// flushed too. Readers see either the old or the new content, even after a crash. An
+// existing file keeps its mode and, when the process may change it, its owner, while a
+// new one is created with perm less the umask. Writing to a link replaces the file it
+// points to.
+func (b OSBackend) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	info, err := os.Stat(name)
+	if err == nil {
+		perm = info.Mode().Perm()
+	}
+	dir := filepath.Dir(name)
+	tempFile, err := createTemp(dir, filepath.Base(name), func(name string) (*os.File, error) {
+		return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	if info != nil {
+		if err := tempFile.Chmod(perm); err != nil {
+			tempFile.Close()
+			return err
+		}
+		copyOwner(tempFile, info)
+	}
+
+	if !b.NoSync {
+		if err := tempFile.Sync(); err != nil {
+			tempFile.Close()
+			return err
+		}
+	}
+
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempFile.Name(), name); err != nil {
+		return err
+	}
+	if b.NoSync {
+		return nil
+	}
+	return syncDir(dir)
+}
+
+// createTemp creates a new file in dir to be renamed over the file named base, like
+// os.CreateTemp but opened by create, which must fail with fs.ErrExist for names already
+// taken. Unlike os.CreateTemp, create chooses the permissions, so the umask applies.
+func createTemp(dir, base string, create func(name string) (*os.File, error)) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, "."+base+".tmp-"+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := create(name)
+		if errors.Is(err, fs.ErrExist) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// MkdirAll creates a directory along with any missing parents.
+func (OSBackend) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+// Remove removes a file or an empty directory.
+func (OSBackend) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// RemoveAll removes a path and everything below it.
+func (OSBackend) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+// Rename moves a file or directory.
+func (OSBackend) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+// symlink creates newname as a link to oldname.
+func (OSBackend) symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+// Chmod changes the permission bits of a file or directory.
+func (OSBackend) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+// Chtimes changes the modification time of a file or directory, leaving its access time.
+func (OSBackend) Chtimes(name string, modTime time.Time) error {
+	return os.Chtimes(name, time.Time{}, modTime)
+}
+
+// openLockFile opens the sidecar file that locks on name are taken on, which for a link is
+// the one of the file it points to.
+func (OSBackend) openLockFile(name string) (*os.File, error) {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	return os.OpenFile(lockPath(name), os.O_RDWR|os.O_CREATE, 0666)
+}
+
+// readAt reads up to len(p) bytes of a file starting at offset, using io.ReaderAt when the
+// file supports it and skipping ahead otherwise.
+func readAt(f fs.File, p []byte, offset int64) (int, error) {
+	if r, ok := f.(io.ReaderAt); ok {
+		return r.ReadAt(p, offset)
+	}
+	if _, err := io.CopyN(io.Discard, f, offset); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(f, p)
+}
+
+// backendWrapper is implemented by backends wrapping another backend, such as
+// PolicyBackend and AuditBackend, so that the hooks core looks for are found along the
+// whole chain of wrappers.
+type backendWrapper interface {
+	// unwrap returns the wrapped backend.
+	unwrap() Backend
+	// withOperation returns a copy of the wrapper over inner, for use by the operation op.
+	withOperation(op string, inner Backend) Backend
+}
+
+// wrappedBackends returns backend followed by the backends it wraps, outermost first.
+func wrappedBackends(backend Backend) []Backend {
+	chain := []Backend{backend}
+	for {
+		wrapper, ok := backend.(backendWrapper)
+		if !ok {
+			return chain
+		}
+		backend = wrapper.unwrap()
+		chain = append(chain, backend)
+	}
+}
+
+// forOperation returns backend as used by an operation that accounts for its own backend
+// calls, such as a search, a tree or a patch. Wrappers like AuditBackend then record the
+// operation as a whole rather than every read it makes.
+func forOperation[B Backend](backend B, op string) B {
+	wrapper, ok := any(backend).(backendWrapper)
+	if !ok {
+		return backend
+	}
+	return wrapper.withOperation(op, forOperation(wrapper.unwrap(), op)).(B)
+}
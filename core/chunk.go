@@ -0,0 +1,216 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ChunkOptions defines how a file is split into chunks. At least one of MaxLines,
+// MaxBytes or MaxTokens must be set; when several are set a chunk ends as soon as
+// any limit would be exceeded. Chunks always start and end on line boundaries.
+type ChunkOptions struct {
+	MaxLines  int `json:"max_lines,omitempty"`  // maximum number of lines per chunk
+	MaxBytes  int `json:"max_bytes,omitempty"`  // maximum number of bytes per chunk
+	MaxTokens int `json:"max_tokens,omitempty"` // maximum number of tokens per chunk
+	Overlap   int `json:"overlap,omitempty"`    // number of lines repeated at the start of the next chunk
+
+	// Tokenizer counts tokens for MaxTokens and defaults to ApproxTokenizer.
+	Tokenizer Tokenizer `json:"-"`
+}
+
+// Chunk is a window of a file along with the boundaries needed to map edits back to it.
+type Chunk struct {
+	Index     int    `json:"index"`
+	StartLine int    `json:"start_line"` // 1-based, inclusive
+	EndLine   int    `json:"end_line"`   // 1-based, inclusive
+	StartByte int64  `json:"start_byte"` // offset of the first byte of the chunk
+	EndByte   int64  `json:"end_byte"`   // offset just past the last byte of the chunk
+	Content   string `json:"content"`
+}
+
+// readLines returns lines start through end (1-based, inclusive) of a file without
+// reading past the requested range. An end of 0 or less reads to the end of the file.
+// Lines are split on "\n" exactly like readFileLines.
+func readLines(backend Backend, path string, start, end int) ([]string, error) {
+	if start < 1 {
+		return nil, fmt.Errorf("invalid start line %d", start)
+	}
+	if end > 0 && end < start {
+		return nil, fmt.Errorf("invalid line range %d-%d", start, end)
+	}
+
+	f, err := backend.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	reader := bufio.NewReader(f)
+	for lineNumber := 1; end <= 0 || lineNumber <= end; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if lineNumber >= start {
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("start line %d is beyond the end of %s", start, path)
+	}
+	return lines, nil
+}
+
+// readBytes returns up to length bytes of a file starting at offset. Reading past the
+// end of the file returns the bytes that are available.
+func readBytes(backend Backend, path string, offset, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid byte range %d+%d", offset, length)
+	}
+
+	f, err := backend.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Never allocate more than the file has left to read.
+	if info, err := f.Stat(); err == nil && info.Mode().IsRegular() && length > info.Size()-offset {
+		length = info.Size() - offset
+		if length < 0 {
+			length = 0
+		}
+	}
+	buffer := make([]byte, length)
+	n, err := readAt(f, buffer, offset)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return buffer[:n], nil
+}
+
+// approximateTokens estimates the number of tokens in text using the common
+// heuristic of roughly four bytes per token.
+func approximateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// chunkFile splits a file into line-aligned, optionally overlapping chunks.
+func chunkFile(backend Backend, path string, options ChunkOptions) ([]Chunk, error) {
+	content, err := backend.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return chunkContent(string(content), options)
+}
+
+// chunkContent splits content into line-aligned, optionally overlapping chunks.
+func chunkContent(content string, options ChunkOptions) ([]Chunk, error) {
+	if options.MaxLines <= 0 && options.MaxBytes <= 0 && options.MaxTokens <= 0 {
+		return nil, fmt.Errorf("chunk options must set MaxLines, MaxBytes or MaxTokens")
+	}
+	if options.Overlap < 0 {
+		return nil, fmt.Errorf("invalid chunk overlap %d", options.Overlap)
+	}
+	if content == "" {
+		return nil, nil
+	}
+	tokenizer := options.Tokenizer
+	if tokenizer == nil {
+		tokenizer = ApproxTokenizer{}
+	}
+
+	// Keep the line terminators so that byte offsets and content round-trip exactly.
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	offsets := make([]int64, len(lines)+1)
+	for i, line := range lines {
+		offsets[i+1] = offsets[i] + int64(len(line))
+	}
+
+	// Count the tokens of each line once and estimate each window by their running sum.
+	// Tokenizers may merge or split tokens across lines, so the estimate is then refined
+	// by tokenizing a logarithmic number of whole windows.
+	var tokens []int
+	if options.MaxTokens > 0 {
+		tokens = make([]int, len(lines)+1)
+		for i, line := range lines {
+			tokens[i+1] = tokens[i] + tokenizer.CountTokens(line)
+		}
+	}
+	fitsSize := func(start, end int) bool {
+		return (options.MaxLines <= 0 || end-start <= options.MaxLines) &&
+			(options.MaxBytes <= 0 || offsets[end]-offsets[start] <= int64(options.MaxBytes))
+	}
+	fits := func(start, end int) bool {
+		return fitsSize(start, end) &&
+			(options.MaxTokens <= 0 || tokenizer.CountTokens(content[offsets[start]:offsets[end]]) <= options.MaxTokens)
+	}
+
+	var chunks []Chunk
+	for start := 0; start < len(lines); {
+		// Always take at least one line so oversized lines still make progress.
+		end := start + 1
+		for end < len(lines) && fitsSize(start, end+1) && (options.MaxTokens <= 0 || tokens[end+1]-tokens[start] <= options.MaxTokens) {
+			end++
+		}
+		if options.MaxTokens > 0 {
+			end = longestWindow(start, end, len(lines), fits)
+		}
+
+		chunks = append(chunks, Chunk{
+			Index:     len(chunks),
+			StartLine: start + 1,
+			EndLine:   end,
+			StartByte: offsets[start],
+			EndByte:   offsets[end],
+			Content:   content[offsets[start]:offsets[end]],
+		})
+
+		if end == len(lines) {
+			break
+		}
+		start = max(end-options.Overlap, start+1)
+	}
+	return chunks, nil
+}
+
+// longestWindow returns the largest end in (start, last] for which fits(start, end)
+// holds, or start+1 if none does, starting from the estimate end. fits must hold for
+// every end up to the largest one.
+func longestWindow(start, end, last int, fits func(start, end int) bool) int {
+	low, high := start+1, end-1
+	if fits(start, end) {
+		// Gallop past the estimate until a window no longer fits.
+		low, high = end, last
+		for step := 1; low < last; step *= 2 {
+			next := low + step
+			if next > last {
+				next = last
+			}
+			if !fits(start, next) {
+				high = next - 1
+				break
+			}
+			low = next
+		}
+	}
+	for low < high {
+		mid := (low + high + 1) / 2
+		if fits(start, mid) {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return low
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeChunkFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chunk.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadLines(t *testing.T) {
+	path := writeChunkFile(t, "one\ntwo\nthree\nfour")
+
+	lines, err := ReadLines(path, 2, 3)
+	if err != nil {
+		t.Fatalf("ReadLines failed: %v", err)
+	}
+	if !reflect.DeepEqual(lines, []string{"two", "three"}) {
+		t.Errorf("ReadLines mismatch: got %q", lines)
+	}
+
+	lines, err = ReadLines(path, 3, 0)
+	if err != nil {
+		t.Fatalf("ReadLines to end failed: %v", err)
+	}
+	if !reflect.DeepEqual(lines, []string{"three", "four"}) {
+		t.Errorf("ReadLines to end mismatch: got %q", lines)
+	}
+
+	// Ranges must agree with ReadFileLines.
+	all, _ := ReadFileLines(path)
+	lines, _ = ReadLines(path, 1, 0)
+	if !reflect.DeepEqual(lines, all) {
+		t.Errorf("ReadLines(1, 0) = %q, ReadFileLines = %q", lines, all)
+	}
+
+	if _, err = ReadLines(path, 0, 1); err == nil {
+		t.Error("Expected an error for start line 0")
+	}
+	if _, err = ReadLines(path, 3, 2); err == nil {
+		t.Error("Expected an error for an inverted range")
+	}
+	if _, err = ReadLines(path, 10, 12); err == nil {
+		t.Error("Expected an error for a range beyond the end of the file")
+	}
+	if _, err = ReadLines("non-existent-file", 1, 1); err == nil {
+		t.Error("Expected an error for a non-existent file")
+	}
+}
+
+func TestReadBytes(t *testing.T) {
+	path := writeChunkFile(t, "hello world")
+
+	data, err := ReadBytes(path, 6, 5)
+	if err != nil {
+		t.Fatalf("ReadBytes failed: %v", err)
+	}
+	if string(data) != "world" {
+		t.Errorf("ReadBytes mismatch: got %q", data)
+	}
+
+	data, err = ReadBytes(path, 6, 100)
+	if err != nil {
+		t.Fatalf("ReadBytes past end failed: %v", err)
+	}
+	if string(data) != "world" {
+		t.Errorf("ReadBytes past end mismatch: got %q", data)
+	}
+
+	// Huge lengths are clamped to what the file has left.
+	data, err = ReadBytes(path, 6, 1<<62)
+	if err != nil || string(data) != "world" {
+		t.Errorf("ReadBytes with a huge length = %q, %v", data, err)
+	}
+	data, err = ReadBytes(path, 100, 1<<62)
+	if err != nil || len(data) != 0 {
+		t.Errorf("ReadBytes past the end with a huge length = %q, %v", data, err)
+	}
+
+	if _, err = ReadBytes(path, -1, 1); err == nil {
+		t.Error("Expected an error for a negative offset")
+	}
+}
+
+func TestChunkFile_Lines(t *testing.T) {
+	content := "1\n2\n3\n4\n5\n6\n7\n"
+	path := writeChunkFile(t, content)
+
+	chunks, err := ChunkFile(path, ChunkOptions{MaxLines: 3, Overlap: 1})
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+
+	expected := [][2]int{{1, 3}, {3, 5}, {5, 7}}
+	if len(chunks) != len(expected) {
+		t.Fatalf("Expected %d chunks, got %d", len(expected), len(chunks))
+	}
+	for i, chunk := range chunks {
+		if chunk.Index != i || chunk.StartLine != expected[i][0] || chunk.EndLine != expected[i][1] {
+			t.Errorf("Chunk %d has lines %d-%d, want %d-%d", i, chunk.StartLine, chunk.EndLine, expected[i][0], expected[i][1])
+		}
+		if content[chunk.StartByte:chunk.EndByte] != chunk.Content {
+			t.Errorf("Chunk %d byte range %d-%d does not match its content", i, chunk.StartByte, chunk.EndByte)
+		}
+	}
+	if chunks[1].Content != "3\n4\n5\n" {
+		t.Errorf("Unexpected content for chunk 1: %q", chunks[1].Content)
+	}
+}
+
+func TestChunkFile_BytesAndTokens(t *testing.T) {
+	content := strings.Repeat("abcdefgh\n", 10) // 10 lines of 9 bytes
+	path := writeChunkFile(t, content)
+
+	chunks, err := ChunkFile(path, ChunkOptions{MaxBytes: 20})
+	if err != nil {
+		t.Fatalf("ChunkFile failed: %v", err)
+	}
+	if len(chunks) != 5 {
+		t.Fatalf("Expected 5 chunks, got %d", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if len(chunk.Content) > 20 {
+			t.Errorf("Chunk %d exceeds MaxBytes: %d bytes", chunk.Index, len(chunk.Content))
+		}
+	}
+
+	chunks, err = ChunkFile(path, ChunkOptions{MaxTokens: 5})
+	if err != nil {
+		t.Fatalf("ChunkFile by tokens failed: %v", err)
+	}
+	if len(chunks) != 5 {
+		t.Errorf("Expected 5 chunks by tokens, got %d", len(chunks))
+	}
+
+	// A single line larger than the limit still forms its own chunk.
+	path = writeChunkFile(t, strings.Repeat("x", 50)+"\nshort\n")
+	chunks, err = ChunkFile(path, ChunkOptions{MaxBytes: 10})
+	if err != nil {
+		t.Fatalf("ChunkFile with oversized line failed: %v", err)
+	}
+	if len(chunks) != 2 || chunks[0].EndLine != 1 || chunks[1].StartLine != 2 {
+		t.Errorf("Unexpected chunks for oversized line: %+v", chunks)
+	}
+
+	if _, err = ChunkFile(path, ChunkOptions{}); err == nil {
+		t.Error("Expected an error when no limit is set")
+	}
+}
+
+// countingTokenizer counts one token per byte and records how many bytes it tokenized.
+type countingTokenizer struct {
+	bytes int
+}
+
+func (t *countingTokenizer) CountTokens(text string) int {
+	t.bytes += len(text)
+	return len(text)
+}
+
+// squareTokenizer counts the square of the number of lines, so that windows have more
+// tokens than their lines add up to.
+type squareTokenizer struct{}
+
+func (squareTokenizer) CountTokens(text string) int {
+	lines := strings.Count(text, "\n")
+	return lines * lines
+}
+
+func TestChunkContent_TokenWindows(t *testing.T) {
+	content := strings.Repeat("abcdefgh\n", 1000)
+	tokenizer := &countingTokenizer{}
+	chunks, err := chunkContent(content, ChunkOptions{MaxTokens: 900, Tokenizer: tokenizer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 10 {
+		t.Fatalf("Expected 10 chunks, got %d", len(chunks))
+	}
+	// Every line once, plus a few windows per chunk to confirm where it ends.
+	if tokenizer.bytes > 4*len(content) {
+		t.Errorf("Expected at most %d bytes to be tokenized, got %d", 4*len(content), tokenizer.bytes)
+	}
+
+	chunks, err = chunkContent(strings.Repeat("line\n", 10), ChunkOptions{MaxTokens: 9, Tokenizer: squareTokenizer{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 4 || chunks[0].EndLine != 3 || chunks[3].StartLine != 10 {
+		t.Errorf("Expected windows of 3 lines confirmed by the tokenizer, got %+v", chunks)
+	}
+}
@@ -1,43 +1,188 @@
 package core
 
+import (
+	"context"
+	"io"
+	"io/fs"
+)
+
 // ReadFile reads the content of a file at the given path.
 func ReadFile(path string) ([]byte, error) {
-	return readFile(path)
+	return readFile(defaultBackend, path)
 }
 
 // WriteFile writes data to a file at the given path.
 func WriteFile(path string, data []byte) error {
-	return writeFile(path, data)
+	return writeFile(defaultBackend, path, data)
+}
+
+// WriteFileWithOptions writes data to a file at the given path according to options.
+func WriteFileWithOptions(path string, data []byte, options WriteOptions) error {
+	return writeFileWith(defaultBackend, path, data, options)
 }
 
 // DeleteFile removes the file at the given path.
 func DeleteFile(path string) error {
-	return deleteFile(path)
+	return deleteFile(defaultBackend, path)
+}
+
+// Stat returns the file info of a path, following links.
+func Stat(path string) (fs.FileInfo, error) {
+	return statFile(defaultBackend, path)
+}
+
+// Exists reports whether something exists at path, without following a final link.
+func Exists(path string) (bool, error) {
+	return exists(defaultBackend, path)
+}
+
+// AppendFile appends data to a file, creating it if it does not exist.
+func AppendFile(path string, data []byte) error {
+	return appendFile(defaultBackend, path, data)
+}
+
+// OpenFile opens a file for reading.
+func OpenFile(path string) (fs.File, error) {
+	return openFile(defaultBackend, path)
+}
+
+// CreateFile returns a writer for a new content of a file, which replaces the file
+// atomically when the writer is closed.
+func CreateFile(path string) (io.WriteCloser, error) {
+	return createFile(defaultBackend, path)
+}
+
+// MoveFile moves a file or directory, copying and deleting it when it cannot be renamed
+// across devices.
+func MoveFile(oldPath, newPath string) error {
+	return moveFile(defaultBackend, oldPath, newPath)
+}
+
+// CopyFile copies a file with its mode and modification time.
+func CopyFile(src, dst string) error {
+	return copyFile(defaultBackend, src, dst)
+}
+
+// Chmod changes the permission bits of a file or directory.
+func Chmod(path string, mode fs.FileMode) error {
+	return chmod(defaultBackend, path, mode)
+}
+
+// LockFile takes an exclusive advisory lock on a file, waiting for other lock holders until
+// ctx is done.
+func LockFile(ctx context.Context, path string) (*FileLock, error) {
+	return lockFile(ctx, defaultBackend, path)
+}
+
+// TryLockFile takes an exclusive advisory lock on a file, failing with ErrLocked if another
+// lock holder has it.
+func TryLockFile(path string) (*FileLock, error) {
+	return tryLockFile(defaultBackend, path)
 }
 
 // CreateDir creates a directory at the specified path.
 func CreateDir(path string) error {
-	return createDir(path)
+	return createDir(defaultBackend, path)
 }
 
 // DeleteDir removes a directory at the specified path.
 func DeleteDir(path string) error {
-	return deleteDir(path)
+	return deleteDir(defaultBackend, path)
+}
+
+// MoveToTrash moves a file or directory into the default trash directory.
+func MoveToTrash(path string) (TrashItem, error) {
+	trash, err := DefaultTrashDir()
+	if err != nil {
+		return TrashItem{}, err
+	}
+	return trashPath(defaultBackend, trash, path)
+}
+
+// ListTrash returns the entries of the default trash directory, oldest first.
+func ListTrash() ([]TrashItem, error) {
+	trash, err := DefaultTrashDir()
+	if err != nil {
+		return nil, err
+	}
+	return listTrash(defaultBackend, trash)
+}
+
+// RestoreFromTrash moves the entry of the default trash directory called name back to
+// where it was deleted from.
+func RestoreFromTrash(name string) (TrashItem, error) {
+	trash, err := DefaultTrashDir()
+	if err != nil {
+		return TrashItem{}, err
+	}
+	return restoreTrash(defaultBackend, trash, name)
+}
+
+// EmptyTrash permanently deletes every entry of the default trash directory.
+func EmptyTrash() error {
+	trash, err := DefaultTrashDir()
+	if err != nil {
+		return err
+	}
+	return emptyTrash(defaultBackend, trash)
+}
+
+// ListDir returns the entries of a directory sorted by name.
+func ListDir(path string) ([]fs.DirEntry, error) {
+	return listDir(defaultBackend, path)
+}
+
+// WalkDir walks the tree at root like fs.WalkDir, calling fn with paths joined to root.
+// Links below root are not followed.
+func WalkDir(root string, fn fs.WalkDirFunc) error {
+	return walkDir(defaultBackend, root, fn)
+}
+
+// Glob returns the paths below root whose slash-separated path relative to root matches
+// pattern, where a "**" segment matches any number of directories.
+func Glob(root, pattern string) ([]string, error) {
+	return glob(defaultBackend, root, pattern)
+}
+
+// CopyDir copies a directory recursively, keeping the modes and modification times of
+// its entries. Links are recreated as links.
+func CopyDir(src, dst string) error {
+	return copyDir(defaultBackend, src, dst)
+}
+
+// DirSize returns the total size of the regular files below a directory.
+func DirSize(path string) (int64, error) {
+	return dirSize(defaultBackend, path)
+}
+
+// IsEmptyDir reports whether a directory has no entries.
+func IsEmptyDir(path string) (bool, error) {
+	return isEmptyDir(defaultBackend, path)
+}
+
+// OpenArchive returns a read-only Backend serving the files of a tar, tar.gz or zip archive.
+func OpenArchive(path string) (Backend, error) {
+	return openArchive(defaultBackend, path)
+}
+
+// ExportArchive writes the entries of a directory tree to a new tar, tar.gz or zip archive.
+func ExportArchive(tree DirectoryTree, dst string, options ArchiveOptions) error {
+	return exportArchive(defaultBackend, tree, dst, options)
 }
 
 // ApplyPatch applies a patch to a file.
 func ApplyPatch(request FileEditRequest, verbose, prompt, highlight bool) error {
-	return editFileWorkflow(request, verbose, prompt, highlight)
+	return editFileWorkflow(defaultBackend, request, verbose, prompt, highlight)
 }
 
 // SearchFiles performs a concurrent search for a query in a given path.
 func SearchFiles(rootPath, query string, options SearchOptions) ([]SearchResult, error) {
-	return search(rootPath, query, options)
+	return search(defaultBackend, rootPath, query, options)
 }
 
 // WorkingDirectoryTree returns a tree of the current working directory
-func WorkingDirectoryTree(include, exclude []string) (DirectoryTree, error) {
-	tree, err := workingDirectoryTree(include, exclude)
+func WorkingDirectoryTree(options TreeOptions) (DirectoryTree, error) {
+	tree, err := workingDirectoryTree(options)
 	return tree, err
 }
 
@@ -56,14 +201,63 @@ func GetTreeMinifiedJSON(tree DirectoryTree) (string, error) {
 }
 
 // BuildDirTree builds a tree based on path provided
-func BuildDirTree(path string, include, exclude []string) (DirectoryTree, error) {
-	tree, err := buildDirectoryTree(path, include, exclude)
+func BuildDirTree(path string, options TreeOptions) (DirectoryTree, error) {
+	tree, err := buildDirectoryTree(defaultBackend, path, options)
 	return tree, err
 }
 
+// TreeErrors returns the errors recorded on the directories of a tree for entries that
+// could not be read, in depth-first order.
+func TreeErrors(tree DirectoryTree) []*TreeError {
+	return collectTreeErrors(tree)
+}
+
+// DiffTrees compares an older directory tree a with a newer tree b and returns the
+// entries that were added, removed, modified or renamed between them.
+func DiffTrees(a, b DirectoryTree) TreeDiff {
+	return diffTrees(a, b)
+}
+
+// SaveTreeSnapshot writes a directory tree to a file so it can be diffed later.
+func SaveTreeSnapshot(tree DirectoryTree, path string) error {
+	return saveTreeSnapshot(defaultBackend, tree, path)
+}
+
+// LoadTreeSnapshot reads a directory tree written by SaveTreeSnapshot.
+func LoadTreeSnapshot(path string) (DirectoryTree, error) {
+	return loadTreeSnapshot(defaultBackend, path)
+}
+
+// Watch starts watching the directory root for changes, using inotify on Linux and
+// polling elsewhere. Close the returned Watcher to stop it.
+func Watch(root string, options WatchOptions) (*Watcher, error) {
+	return watch(root, options)
+}
+
+// LoadPolicy reads an access policy from a .json, .yaml or .yml file and validates it.
+func LoadPolicy(path string) (Policy, error) {
+	return loadPolicy(defaultBackend, path)
+}
+
+// ParsePolicy parses an access policy in the "json" or "yaml" format and validates it.
+func ParsePolicy(data []byte, format string) (Policy, error) {
+	return parsePolicy(data, format)
+}
+
+// ReadAuditLog reads the events of an audit log written by a JSONLSink.
+func ReadAuditLog(r io.Reader) ([]AuditEvent, error) {
+	return readAuditLog(r)
+}
+
+// ReplayAudit applies the successful writes, patches, deletions, renames and directory
+// creations of recorded events, in order, to reconstruct the files of a session.
+func ReplayAudit(events []AuditEvent) error {
+	return replayAudit(defaultBackend, events)
+}
+
 // ReadFileLines reads the lines of a file at the given path.
 func ReadFileLines(path string) ([]string, error) {
-	return readFileLines(path)
+	return readFileLines(defaultBackend, path)
 }
 
 // ValidateEdits validates the edits against the file content.
@@ -98,5 +292,57 @@ func ApplyEdits(lines []string, edits []EditInstruction) ([]string, error) {
 
 // WriteFileLines writes the lines to a file at the given path.
 func WriteFileLines(path string, lines []string) error {
-	return writeFileLines(path, lines)
+	return writeFileLines(defaultBackend, path, lines)
+}
+
+// ApplyStructuredEdit applies path-based edits to a JSON, YAML or TOML file.
+func ApplyStructuredEdit(request StructuredEditRequest, verbose, prompt, highlight bool) error {
+	return structuredEditWorkflow(defaultBackend, request, verbose, prompt, highlight)
+}
+
+// ParseJSONPatch parses an RFC 6902 JSON Patch document into structured edits.
+func ParseJSONPatch(data []byte) ([]StructuredEdit, error) {
+	return parseJSONPatch(data)
+}
+
+// ParseMergePatch parses an RFC 7396 JSON Merge Patch document into structured edits.
+func ParseMergePatch(data []byte) ([]StructuredEdit, error) {
+	return parseMergePatch(data)
+}
+
+// ReadLines reads lines start through end (1-based, inclusive) of a file.
+// An end of 0 or less reads to the end of the file.
+func ReadLines(path string, start, end int) ([]string, error) {
+	return readLines(defaultBackend, path, start, end)
+}
+
+// ReadBytes reads up to length bytes of a file starting at offset.
+func ReadBytes(path string, offset, length int64) ([]byte, error) {
+	return readBytes(defaultBackend, path, offset, length)
+}
+
+// ChunkFile splits a file into line-aligned, optionally overlapping chunks.
+func ChunkFile(path string, options ChunkOptions) ([]Chunk, error) {
+	return chunkFile(defaultBackend, path, options)
+}
+
+// LoadBPETokenizer loads a byte pair encoding tokenizer from a tiktoken-format vocabulary file.
+func LoadBPETokenizer(path string) (*BPETokenizer, error) {
+	return loadBPETokenizer(path)
+}
+
+// AnnotateTreeTokens sets estimated token counts on every node of a directory tree.
+// A nil tokenizer uses the ApproxTokenizer.
+func AnnotateTreeTokens(tree *DirectoryTree, tokenizer Tokenizer) error {
+	return annotateTreeTokens(defaultBackend, tree, tokenizer)
+}
+
+// SearchContextItems turns search results into context items for a ContextPacker.
+func SearchContextItems(results []SearchResult, contextLines, priority int) []ContextItem {
+	return searchContextItems(results, contextLines, priority)
+}
+
+// RenderTree renders a directory tree in one of the TreeFormat encodings.
+func RenderTree(tree DirectoryTree, format string, options RenderOptions) (string, error) {
+	return renderTree(tree, format, options)
 }
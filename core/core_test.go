@@ -44,7 +44,7 @@ func TestWorkingDirectoryTree(t *testing.T) {
 	}
 
 	// Test with no include/exclude
-	tree, err := WorkingDirectoryTree(nil, nil)
+	tree, err := WorkingDirectoryTree(TreeOptions{})
 	if err != nil {
 		t.Fatalf("WorkingDirectoryTree failed: %v", err)
 	}
@@ -56,7 +56,7 @@ func TestWorkingDirectoryTree(t *testing.T) {
 	}
 
 	// Test with include
-	tree, err = WorkingDirectoryTree([]string{"*.txt"}, nil)
+	tree, err = WorkingDirectoryTree(TreeOptions{Include: []string{"*.txt"}})
 	if err != nil {
 		t.Fatalf("WorkingDirectoryTree with include failed: %v", err)
 	}
@@ -65,7 +65,7 @@ func TestWorkingDirectoryTree(t *testing.T) {
 	}
 
 	// Test with exclude
-	tree, err = WorkingDirectoryTree(nil, []string{"subdir"})
+	tree, err = WorkingDirectoryTree(TreeOptions{Exclude: []string{"subdir"}})
 	if err != nil {
 		t.Fatalf("WorkingDirectoryTree with exclude failed: %v", err)
 	}
@@ -216,7 +216,7 @@ func TestWorkingDirectoryTree_Error(t *testing.T) {
 		t.Fatalf("Failed to chmod temp dir: %v", err)
 	}
 
-	_, err = WorkingDirectoryTree(nil, nil)
+	_, err = WorkingDirectoryTree(TreeOptions{})
 	if err == nil {
 		t.Error("WorkingDirectoryTree should have failed with an unreadable directory")
 	}
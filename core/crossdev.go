@@ -0,0 +1,13 @@
+//go:build !plan9
+
+package core
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isCrossDevice reports whether err is the failure of a rename across devices.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
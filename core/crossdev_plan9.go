@@ -0,0 +1,6 @@
+package core
+
+// isCrossDevice reports false, as renames across devices cannot be told apart on Plan 9.
+func isCrossDevice(err error) bool {
+	return false
+}
@@ -0,0 +1,41 @@
+//go:build !plan9
+
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// crossDeviceBackend fails every rename as if it crossed devices.
+type crossDeviceBackend struct {
+	OSBackend
+}
+
+func (crossDeviceBackend) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+}
+
+func TestMoveFile_CrossDevice(t *testing.T) {
+	root := setupLimitTree(t)
+	if err := os.Symlink(filepath.Join("b", "c.txt"), filepath.Join(root, "deep", "a", "link.txt")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	fsys := NewFS(crossDeviceBackend{})
+	dst := filepath.Join(t.TempDir(), "moved")
+	if err := fsys.MoveFile(filepath.Join(root, "deep"), dst); err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "deep")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the source still exists: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dst, "a", "b", "c.txt")); err != nil || string(content) != "abc" {
+		t.Errorf("moved file content = %q, %v", content, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "a", "link.txt")); err != nil || target != filepath.Join("b", "c.txt") {
+		t.Errorf("moved link has target %q, %v", target, err)
+	}
+}
@@ -0,0 +1,262 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// maxDiffCells bounds the size of the LCS table used by diffLines. Inputs whose
+// differing regions exceed it are reported as a single replacement block.
+const maxDiffCells = 4 << 20
+
+// lineOp is a single step of a line-based edit script.
+type lineOp struct {
+	kind byte // ' ' for an unchanged line, '-' for a removed line, '+' for an added line
+	line string
+}
+
+// diffHunk is a contiguous block of changed lines along with its surrounding context,
+// shaped so that it can be rendered by printDiff.
+type diffHunk struct {
+	oldStart    int // 1-based line number of the first line of the hunk in the old content
+	newStart    int // 1-based line number of the first line of the hunk in the new content
+	topLines    []string
+	original    []string
+	updated     []string
+	bottomLines []string
+}
+
+// diffLines computes a line-based edit script that turns a into b.
+func diffLines(a, b []string) []lineOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]lineOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, lineOp{' ', line})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, lineOp{' ', line})
+	}
+	return ops
+}
+
+// diffMiddle computes the edit script for the differing middle section of two inputs
+// using a longest common subsequence table.
+func diffMiddle(a, b []string) []lineOp {
+	var ops []lineOp
+	if len(a)*len(b) > maxDiffCells || len(a) == 0 || len(b) == 0 {
+		for _, line := range a {
+			ops = append(ops, lineOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, lineOp{'+', line})
+		}
+		return ops
+	}
+
+	// lcs[i][j] holds the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, lineOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, lineOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, lineOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, lineOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, lineOp{'+', b[j]})
+	}
+	return ops
+}
+
+// diffHunks groups an edit script into hunks, one per block of consecutive changes,
+// each carrying up to contextLines unchanged lines before and after it.
+func diffHunks(ops []lineOp, contextLines int) []diffHunk {
+	var hunks []diffHunk
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		var hunk diffHunk
+		for k := max(0, i-contextLines); k < i; k++ {
+			hunk.topLines = append(hunk.topLines, ops[k].line)
+		}
+		hunk.oldStart = oldLine - len(hunk.topLines)
+		hunk.newStart = newLine - len(hunk.topLines)
+
+		for ; i < len(ops) && ops[i].kind != ' '; i++ {
+			if ops[i].kind == '-' {
+				hunk.original = append(hunk.original, ops[i].line)
+				oldLine++
+			} else {
+				hunk.updated = append(hunk.updated, ops[i].line)
+				newLine++
+			}
+		}
+
+		for k := i; k < len(ops) && k < i+contextLines && ops[k].kind == ' '; k++ {
+			hunk.bottomLines = append(hunk.bottomLines, ops[k].line)
+		}
+		hunks = append(hunks, hunk)
+	}
+	return hunks
+}
+
+// unifiedContextLines is the number of unchanged lines shown around changes by
+// unifiedDiff, as in diff -u.
+const unifiedContextLines = 3
+
+// splitDiffLines splits content into lines for diffing. A final line without a trailing
+// newline keeps a "\n" suffix, so that it differs from the same line with one and can be
+// marked when rendered.
+func splitDiffLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	text := string(content)
+	if strings.HasSuffix(text, "\n") {
+		return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	lines := strings.Split(text, "\n")
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+// diffName returns the name of path in a diff header with a side prefix such as "a" or "b",
+// joined by a slash as git does: "a/src/main.go" for both "src/main.go" and "/src/main.go".
+func diffName(side, path string) string {
+	return side + "/" + strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
+
+// unifiedDiff renders the changes from oldContent to newContent in the unified format
+// of diff -u, labelling the two sides oldName and newName. It returns "" when the
+// contents are equal.
+func unifiedDiff(oldName, newName string, oldContent, newContent []byte) string {
+	ops := diffLines(splitDiffLines(oldContent), splitDiffLines(newContent))
+
+	// Group changes into hunks, merging those whose context would overlap.
+	type span struct{ start, end int }
+	var spans []span
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		start, end := max(0, i-unifiedContextLines), min(len(ops), i+unifiedContextLines+1)
+		if len(spans) > 0 && start <= spans[len(spans)-1].end {
+			spans[len(spans)-1].end = end
+		} else {
+			spans = append(spans, span{start, end})
+		}
+	}
+	if len(spans) == 0 {
+		return ""
+	}
+
+	// oldLines[i] and newLines[i] count the lines of each side before ops[i].
+	oldLines, newLines := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLines[i+1], newLines[i+1] = oldLines[i], newLines[i]
+		if op.kind != '+' {
+			oldLines[i+1]++
+		}
+		if op.kind != '-' {
+			newLines[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for _, s := range spans {
+		oldCount, newCount := oldLines[s.end]-oldLines[s.start], newLines[s.end]-newLines[s.start]
+		oldStart, newStart := oldLines[s.start], newLines[s.start]
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, op := range ops[s.start:s.end] {
+			if line, ok := strings.CutSuffix(op.line, "\n"); ok {
+				fmt.Fprintf(&out, "%c%s\n\\ No newline at end of file\n", op.kind, line)
+			} else {
+				fmt.Fprintf(&out, "%c%s\n", op.kind, op.line)
+			}
+		}
+	}
+	return out.String()
+}
+
+// writeContentWorkflow shows the changes between the current and updated content of a file,
+// optionally asks the user for confirmation, and then writes the updated content.
+// It follows the same verbose, prompt and highlight conventions as editFileWorkflow.
+func writeContentWorkflow(backend WritableBackend, path string, current, updated []byte, verbose, prompt, highlight bool) error {
+	if string(current) == string(updated) {
+		if verbose {
+			fmt.Printf("No changes for %s\n", path)
+		}
+		return nil
+	}
+
+	if verbose {
+		fmt.Printf("Proposed changes for %s:\n", path)
+		ops := diffLines(strings.Split(string(current), "\n"), strings.Split(string(updated), "\n"))
+		for _, hunk := range diffHunks(ops, 2) {
+			fmt.Printf("\nChange at line %d:\n", hunk.oldStart+len(hunk.topLines))
+			printDiff(hunk.topLines, hunk.original, hunk.updated, hunk.bottomLines, hunk.oldStart, highlight)
+		}
+	}
+
+	if prompt {
+		if !promptUser("\nApply these changes? (y/n): ") {
+			return fmt.Errorf("user aborted the file edit operation")
+		}
+	}
+
+	if err := writeFile(backend, path, updated); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+
+	if verbose {
+		fmt.Printf("Successfully updated file %s\n", path)
+	}
+	return nil
+}
@@ -2,9 +2,16 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type DirectoryTree struct {
@@ -14,105 +21,732 @@ type DirectoryTree struct {
 	IsBinary bool            `json:"is_binary,omitempty"`
 	Children []DirectoryTree `json:"children,omitempty"`
 	Size     int64           `json:"size"`
+	Tokens   int             `json:"tokens,omitempty"`  // estimated token count, set by AnnotateTreeTokens
+	Omitted  *TreeSummary    `json:"omitted,omitempty"` // set on placeholder nodes standing in for omitted entries
+
+	IsSymlink  bool   `json:"is_symlink,omitempty"`  // the entry is a symbolic link
+	LinkTarget string `json:"link_target,omitempty"` // the link's target as stored in the link
+
+	// Optional metadata, filled in as selected by TreeOptions.Metadata.
+	ModTime  time.Time   `json:"mod_time,omitzero"`
+	Mode     fs.FileMode `json:"mode,omitempty"`
+	Owner    string      `json:"owner,omitempty"`
+	MIMEType string      `json:"mime_type,omitempty"`
+	Language string      `json:"language,omitempty"`
+	Lines    int         `json:"lines,omitempty"` // line count of text files
+	Hash     string      `json:"hash,omitempty"`  // hex-encoded SHA-256 of file content
+
+	// Errors lists the entries of this directory that could not be read and were left out.
+	Errors []*TreeError `json:"errors,omitempty"`
+}
+
+// TreeError records an entry that could not be read while building a tree.
+type TreeError struct {
+	Path string
+	Err  error
+}
+
+func (e *TreeError) Error() string {
+	return fmt.Sprintf("could not read %s: %v", e.Path, e.Err)
+}
+
+func (e *TreeError) Unwrap() error {
+	return e.Err
+}
+
+// treeErrorJSON is the serialized form of a TreeError.
+type treeErrorJSON struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// MarshalJSON encodes the error as its path and message.
+func (e *TreeError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(treeErrorJSON{Path: e.Path, Error: e.Err.Error()})
+}
+
+// UnmarshalJSON decodes an error encoded by MarshalJSON. Only the message of the
+// underlying error survives the round trip.
+func (e *TreeError) UnmarshalJSON(data []byte) error {
+	var decoded treeErrorJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	e.Path, e.Err = decoded.Path, errors.New(decoded.Error)
+	return nil
+}
+
+// TreeSummary describes entries left out of a tree by its limits.
+type TreeSummary struct {
+	Files int   `json:"files"`
+	Dirs  int   `json:"dirs"`
+	Size  int64 `json:"size"`
+}
+
+// TreeOptions controls how a directory tree is built. Entries cut by MaxDepth,
+// MaxChildrenPerDir or MaxTotalEntries are replaced by a placeholder node per directory
+// whose Omitted field summarizes what was left out.
+type TreeOptions struct {
+	Include []string `json:"include,omitempty"` // file name patterns to include; empty includes everything
+	Exclude []string `json:"exclude,omitempty"` // file and directory name patterns to exclude
+
+	MaxDepth          int `json:"max_depth,omitempty"`            // levels expanded below the root; 0 means unlimited
+	MaxChildrenPerDir int `json:"max_children_per_dir,omitempty"` // entries kept per directory; 0 means unlimited
+	MaxTotalEntries   int `json:"max_total_entries,omitempty"`    // entries kept in the whole tree, breadth first; 0 means unlimited
+
+	// Workers bounds the number of goroutines building the tree concurrently and
+	// defaults to the number of CPUs. Children are always returned in directory order.
+	Workers int `json:"workers,omitempty"`
+	// SkipBinaryCheck leaves IsBinary unset instead of reading the start of every file.
+	// Use IsBinary on individual nodes to check them lazily.
+	SkipBinaryCheck bool `json:"skip_binary_check,omitempty"`
+	// Symlinks selects how symbolic links are handled and defaults to SymlinkList.
+	Symlinks SymlinkPolicy `json:"symlinks,omitempty"`
+	// Metadata selects the optional metadata filled in on every node.
+	Metadata MetadataOptions `json:"metadata,omitzero"`
+
+	// FailFast stops at the first entry that cannot be read and returns its *TreeError,
+	// instead of recording it in the Errors of the directory containing it.
+	FailFast bool `json:"fail_fast,omitempty"`
+	// Logger, when set, receives a warning for every entry that cannot be read.
+	Logger *slog.Logger `json:"-"`
+
+	// Tokenizer, when set, fills in the estimated Tokens of every node.
+	Tokenizer Tokenizer `json:"-"`
+}
+
+// treeBuilder builds directory trees concurrently with a bounded number of goroutines.
+type treeBuilder struct {
+	backend Backend
+	options TreeOptions
+	slots   chan struct{} // one slot per extra goroutine allowed
+
+	failed   atomic.Bool // set once a FailFast build has hit an error
+	failOnce sync.Once
+	failure  *TreeError
+
+	// With MaxTotalEntries set, directories are expanded breadth first by buildLimited.
+	// pending holds those whose children have not been built yet, by path.
+	pendingMu sync.Mutex
+	pending   map[string]pendingDir
+}
+
+// pendingDir is a directory whose children buildLimited has yet to build.
+type pendingDir struct {
+	depth     int
+	ancestors []fs.FileInfo // from the root down to the directory itself
 }
 
 // createDir creates a directory at the specified path, along with any necessary parents.
 // If the directory already exists, createDir does nothing and returns nil.
-func createDir(path string) error {
-	return os.MkdirAll(path, os.ModePerm)
+func createDir(backend WritableBackend, path string) error {
+	return backend.MkdirAll(path, os.ModePerm)
 }
 
 // deleteDir removes a directory at the specified path, along with any children it contains.
-// If the path does not exist, deleteDir does nothing and returns nil.
-func deleteDir(path string) error {
-	return os.RemoveAll(path)
+// If the path does not exist, deleteDir does nothing and returns nil. Symbolic links are
+// never followed: a link, whether it is path itself or inside it, is removed as a link
+// and its target is left untouched. Directories containing the home directory or the
+// working directory are refused with ErrProtectedPath.
+func deleteDir(backend WritableBackend, path string) error {
+	if err := checkDeletable("remove", path); err != nil {
+		return err
+	}
+	info, err := backend.Lstat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if isSymlink(info) {
+		return backend.Remove(path)
+	}
+	return backend.RemoveAll(path)
+}
+
+// copyDir copies the directory at src to dst, merging it into any directory already at
+// dst. Files and directories keep their modes and modification times. Links below src are
+// recreated as links with the same targets, whether they point to files, to directories or
+// nowhere; copying fails on backends that cannot create links rather than dropping them.
+func copyDir(backend WritableBackend, src, dst string) error {
+	info, err := backend.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "copy", Path: src, Err: errors.New("not a directory")}
+	}
+	if isWithin(filepath.Clean(dst), filepath.Clean(src)) {
+		return &fs.PathError{Op: "copy", Path: src, Err: errors.New("cannot copy a directory into itself")}
+	}
+	return copyEntry(backend, src, dst, info)
 }
 
-// buildDirectoryTree recursively builds a DirectoryTree from a given path.
-func buildDirectoryTree(path string, include, exclude []string) (DirectoryTree, error) {
-	info, err := os.Stat(path)
+// copyEntry copies the file, directory or link at src, described by info, to dst, reading
+// the real content of files like copyFile and recreating links like copyDir.
+func copyEntry(backend WritableBackend, src, dst string, info fs.FileInfo) error {
+	backend = forOperation(backend, AuditCopy)
+	if isSymlink(info) {
+		return copySymlink(backend, src, dst)
+	}
+	if !info.IsDir() {
+		return copyFile(backend, src, dst)
+	}
+	if err := backend.MkdirAll(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	entries, err := backend.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		childInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		child := filepath.Join(src, entry.Name())
+		if err := copyEntry(backend, child, filepath.Join(dst, entry.Name()), childInfo); err != nil {
+			return err
+		}
+	}
+	// The mode and time are set last, as adding entries changes the time and the mode may
+	// not allow them to be added.
+	if err := backend.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return backend.Chtimes(dst, info.ModTime())
+}
+
+// dirSize returns the total size of the regular files below path. Links are not followed.
+func dirSize(backend Backend, path string) (int64, error) {
+	var size int64
+	err := walkDir(backend, path, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// isEmptyDir reports whether the directory at path has no entries.
+func isEmptyDir(backend Backend, path string) (bool, error) {
+	entries, err := listDir(backend, path)
+	if err != nil {
+		return false, err
+	}
+	return len(entries) == 0, nil
+}
+
+// newTreeBuilder returns a treeBuilder reading from backend with up to options.Workers
+// goroutines.
+func newTreeBuilder(backend Backend, options TreeOptions) *treeBuilder {
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &treeBuilder{backend: backend, options: options, slots: make(chan struct{}, workers-1)}
+}
+
+// buildDirectoryTree builds a DirectoryTree from a given path, applying the limits and
+// annotations requested in options.
+func buildDirectoryTree(backend Backend, path string, options TreeOptions) (DirectoryTree, error) {
+	backend = forOperation(backend, AuditTree)
+	tree, err := buildTree(backend, path, options)
+	if err := recordAudit(backend, AuditEvent{Op: AuditTree, Path: path}, err); err != nil {
+		return DirectoryTree{}, err
+	}
+	return tree, nil
+}
+
+func buildTree(backend Backend, path string, options TreeOptions) (DirectoryTree, error) {
+	builder := newTreeBuilder(backend, options)
+	build := builder.build
+	if options.MaxTotalEntries > 0 {
+		build = builder.buildLimited
+	}
+	tree, err := build(path, 0, nil)
 	if err != nil {
 		return DirectoryTree{}, err
 	}
+	if builder.failure != nil {
+		return DirectoryTree{}, builder.failure
+	}
+	if options.Tokenizer != nil {
+		if err := annotateTreeTokens(backend, &tree, options.Tokenizer); err != nil {
+			return DirectoryTree{}, err
+		}
+	}
+	return tree, nil
+}
 
-	// Check exclude patterns against the base name.
+// isExcluded reports whether a base name matches any of the exclude patterns.
+func isExcluded(name string, exclude []string) bool {
 	for _, pattern := range exclude {
-		if matched, _ := filepath.Match(pattern, info.Name()); matched {
-			return DirectoryTree{}, nil // Excluded
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isIncluded reports whether a file name matches the include patterns.
+// An empty list of patterns includes every file.
+func isIncluded(name string, include []string) bool {
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// build recursively builds the node for path, which sits depth levels below the root.
+// ancestors holds the directories from the root down to the parent of path and is used
+// to detect symlink cycles. The root itself is always resolved, even if it is a link.
+func (b *treeBuilder) build(path string, depth int, ancestors []fs.FileInfo) (DirectoryTree, error) {
+	options := b.options
+	if b.failed.Load() {
+		return DirectoryTree{}, nil // the result is discarded anyway
+	}
+
+	stat := b.backend.Lstat
+	if depth == 0 {
+		stat = b.backend.Stat
+	}
+	info, err := stat(path)
+	if err != nil {
+		return DirectoryTree{}, err
+	}
+
+	// Check exclude patterns against the base name.
+	if isExcluded(info.Name(), options.Exclude) {
+		return DirectoryTree{}, nil // Excluded
+	}
+	if err := checkAccess(b.backend, PolicyTree, path); err != nil {
+		if depth == 0 {
+			return DirectoryTree{}, err
 		}
+		return DirectoryTree{}, nil // Hidden by the backend's policy
+	}
+
+	var linkTarget string
+	if isSymlink(info) {
+		if options.Symlinks == SymlinkSkip {
+			return DirectoryTree{}, nil
+		}
+		linkTarget, _ = b.backend.ReadLink(path)
+		target, err := b.backend.Stat(path)
+		if options.Symlinks != SymlinkFollow || err != nil || (target.IsDir() && isVisited(target, ancestors)) {
+			// Listed, dangling or cyclic links become leaves.
+			return linkNode(path, info.Name(), linkTarget, target, options.Include), nil
+		}
+		info = target
 	}
 
 	if !info.IsDir() {
 		// It's a file. Check include patterns.
-		if len(include) > 0 {
-			included := false
-			for _, pattern := range include {
-				if matched, _ := filepath.Match(pattern, info.Name()); matched {
-					included = true
-					break
-				}
-			}
-			if !included {
-				return DirectoryTree{}, nil
-			}
+		if !isIncluded(info.Name(), options.Include) {
+			return DirectoryTree{}, nil
 		}
 		// Included file.
-		return DirectoryTree{
-				Path:     path,
-				Name:     info.Name(),
-				IsFile:   true,
-				IsBinary: IsBinary(path),
-				Size:     info.Size(),
-			},
-			nil
-	}
-
-	// It's a directory. Recurse.
-	entries, err := os.ReadDir(path)
+		tree := DirectoryTree{
+			Path:       path,
+			Name:       info.Name(),
+			IsFile:     true,
+			IsBinary:   !options.SkipBinaryCheck && isBinary(b.backend, path),
+			Size:       info.Size(),
+			IsSymlink:  linkTarget != "",
+			LinkTarget: linkTarget,
+		}
+		if err := fillMetadata(b.backend, &tree, info, options.Metadata); err != nil {
+			return DirectoryTree{}, err
+		}
+		return tree, nil
+	}
+
+	// It's a directory past the depth limit: summarize it instead of recursing.
+	if options.MaxDepth > 0 && depth >= options.MaxDepth {
+		summary, _, err := countTree(b.backend, path, options, ancestors)
+		if err != nil {
+			return DirectoryTree{}, err
+		}
+		if summary.Files == 0 && len(options.Include) > 0 {
+			return DirectoryTree{}, nil
+		}
+		tree := DirectoryTree{Path: path, Name: info.Name(), Size: summary.Size, IsSymlink: linkTarget != "", LinkTarget: linkTarget}
+		if summary.Files > 0 || summary.Dirs > 0 {
+			tree.Children = []DirectoryTree{newSummaryNode(path, summary, false)}
+		}
+		if err := fillMetadata(b.backend, &tree, info, options.Metadata); err != nil {
+			return DirectoryTree{}, err
+		}
+		return tree, nil
+	}
+
+	// It's a directory. With a total entry limit, its children are built later, breadth
+	// first, by buildLimited. Otherwise recurse.
+	ancestors = withAncestor(ancestors, info)
+	if options.MaxTotalEntries > 0 {
+		return b.deferDir(path, info, linkTarget, depth, ancestors)
+	}
+	children, treeErrors, err := b.buildEntries(path, depth, ancestors, -1)
 	if err != nil {
 		return DirectoryTree{}, err
 	}
 
-	var children []DirectoryTree
+	// If it's a directory, it's only included if it has children after filtering,
+	// unless there are no include patterns (in which case empty dirs are fine). Directories
+	// with errors are kept so that the errors are not lost.
+	if len(children) == 0 && len(treeErrors) == 0 && len(options.Include) > 0 {
+		return DirectoryTree{}, nil
+	}
+
 	var size int64
-	for _, entry := range entries {
-		childPath := filepath.Join(path, entry.Name())
-		child, err := buildDirectoryTree(childPath, include, exclude)
+	for _, child := range children {
+		size += child.Size
+	}
+	tree := DirectoryTree{
+		Path:       path,
+		Name:       info.Name(),
+		IsFile:     false,
+		Children:   children,
+		Size:       size,
+		IsSymlink:  linkTarget != "",
+		LinkTarget: linkTarget,
+		Errors:     treeErrors,
+	}
+	if err := fillMetadata(b.backend, &tree, info, options.Metadata); err != nil {
+		return DirectoryTree{}, err
+	}
+	return tree, nil
+}
+
+// buildEntries builds the children of the directory at path, which sits depth levels
+// below the root. Unless limit is negative, at most limit children are built. Children past
+// limit or options.MaxChildrenPerDir are only counted, into a trailing placeholder node.
+func (b *treeBuilder) buildEntries(path string, depth int, ancestors []fs.FileInfo, limit int) ([]DirectoryTree, []*TreeError, error) {
+	options := b.options
+	entries, err := b.backend.ReadDir(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paths := make([]string, len(entries))
+	for i, entry := range entries {
+		paths[i] = filepath.Join(path, entry.Name())
+	}
+
+	// Build children in batches no larger than what the limits still allow, since
+	// filtered-out entries do not count towards them.
+	var children []DirectoryTree
+	var treeErrors []*TreeError
+	next := 0
+	for next < len(paths) {
+		batch := len(paths) - next
+		if options.MaxChildrenPerDir > 0 {
+			batch = min(batch, options.MaxChildrenPerDir-len(children))
+		}
+		if limit >= 0 {
+			batch = min(batch, limit-len(children))
+		}
+		if batch <= 0 {
+			break
+		}
+		built, errs := b.buildChildren(paths[next:next+batch], depth+1, ancestors)
+		for _, child := range built {
+			if child.Path != "" { // If not excluded/filtered
+				children = append(children, child)
+			}
+		}
+		treeErrors = append(treeErrors, errs...)
+		next += batch
+	}
+
+	// Past the limits, only count what is left.
+	var omitted TreeSummary
+	for _, childPath := range paths[next:] {
+		summary, isDir, err := countTree(b.backend, childPath, options, ancestors)
 		if err != nil {
-			// Log error and continue
-			fmt.Printf("error processing %s: %v\n", childPath, err)
+			if treeErr := b.recordError(childPath, err); treeErr != nil {
+				treeErrors = append(treeErrors, treeErr)
+			}
 			continue
 		}
-		if child.Path != "" { // If not excluded/filtered
-			children = append(children, child)
-			size += child.Size
+		if isDir {
+			omitted.Dirs++
 		}
+		omitted.add(summary)
 	}
+	if omitted.Files > 0 || omitted.Dirs > 0 {
+		children = append(children, newSummaryNode(path, omitted, len(children) > 0))
+	}
+	return children, treeErrors, nil
+}
 
-	// If it's a directory, it's only included if it has children after filtering,
-	// unless there are no include patterns (in which case empty dirs are fine).
-	if len(children) == 0 && len(include) > 0 {
+// deferDir returns the node for a directory whose children buildLimited builds later.
+// ancestors already includes the directory. With include patterns, directories without
+// matching files are dropped right away so that they do not use up the entry limit.
+func (b *treeBuilder) deferDir(path string, info fs.FileInfo, linkTarget string, depth int, ancestors []fs.FileInfo) (DirectoryTree, error) {
+	if depth > 0 && len(b.options.Include) > 0 {
+		summary, _, err := countTree(b.backend, path, b.options, ancestors[:len(ancestors)-1])
+		if err == nil && summary.Files == 0 {
+			return DirectoryTree{}, nil
+		}
+	}
+	tree := DirectoryTree{Path: path, Name: info.Name(), IsSymlink: linkTarget != "", LinkTarget: linkTarget}
+	if err := fillMetadata(b.backend, &tree, info, b.options.Metadata); err != nil {
+		return DirectoryTree{}, err
+	}
+	b.pendingMu.Lock()
+	b.pending[path] = pendingDir{depth: depth, ancestors: ancestors}
+	b.pendingMu.Unlock()
+	return tree, nil
+}
+
+// buildLimited builds the tree at path like build, but keeps at most
+// options.MaxTotalEntries entries below the root, chosen breadth first so that the top
+// levels of the tree stay visible. Directories are only expanded while entries are left,
+// so nothing is read for entries that are cut; the rest of each directory is counted into
+// a single placeholder node.
+func (b *treeBuilder) buildLimited(path string, depth int, ancestors []fs.FileInfo) (DirectoryTree, error) {
+	b.pending = make(map[string]pendingDir)
+	tree, err := b.build(path, depth, ancestors)
+	if err != nil {
+		return DirectoryTree{}, err
+	}
+
+	left := b.options.MaxTotalEntries
+	queue := []*DirectoryTree{&tree}
+	for len(queue) > 0 && !b.failed.Load() {
+		dir := queue[0]
+		queue = queue[1:]
+		pending, ok := b.pending[dir.Path]
+		if !ok {
+			continue // a file, a link or a directory already summarized
+		}
+
+		children, treeErrors, err := b.buildEntries(dir.Path, pending.depth, pending.ancestors, left)
+		if err != nil {
+			if dir == &tree {
+				return DirectoryTree{}, err
+			}
+			if treeErr := b.recordError(dir.Path, err); treeErr != nil {
+				dir.Errors = append(dir.Errors, treeErr)
+			}
+			continue
+		}
+		dir.Children = children
+		dir.Errors = append(dir.Errors, treeErrors...)
+		for i := range dir.Children {
+			if dir.Children[i].Omitted == nil {
+				left--
+				queue = append(queue, &dir.Children[i])
+			}
+		}
+	}
+	sumTreeSizes(&tree)
+
+	if len(tree.Children) == 0 && len(tree.Errors) == 0 && len(b.options.Include) > 0 {
 		return DirectoryTree{}, nil
 	}
+	return tree, nil
+}
+
+// sumTreeSizes sets the size of every expanded directory in tree to the total of its
+// children and returns the size of tree.
+func sumTreeSizes(tree *DirectoryTree) int64 {
+	if tree.IsFile || tree.Children == nil {
+		return tree.Size
+	}
+	tree.Size = 0
+	for i := range tree.Children {
+		tree.Size += sumTreeSizes(&tree.Children[i])
+	}
+	return tree.Size
+}
+
+// linkNode returns the leaf node for a symbolic link that is listed rather than followed.
+// target describes what the link points to and is nil for dangling links, which are
+// treated like files. Links to directories are dropped when include patterns are set,
+// since they have no children that could match.
+func linkNode(path, name, linkTarget string, target fs.FileInfo, include []string) DirectoryTree {
+	isFile := target == nil || !target.IsDir()
+	if (isFile && !isIncluded(name, include)) || (!isFile && len(include) > 0) {
+		return DirectoryTree{}
+	}
+	return DirectoryTree{Path: path, Name: name, IsFile: isFile, IsSymlink: true, LinkTarget: linkTarget}
+}
+
+// buildChildren builds the nodes for paths, using spare worker slots to build them
+// concurrently and falling back to the calling goroutine when none are free. Results are
+// returned in the order of paths; children that fail are left empty and their errors are
+// returned in the same order.
+func (b *treeBuilder) buildChildren(paths []string, depth int, ancestors []fs.FileInfo) ([]DirectoryTree, []*TreeError) {
+	children := make([]DirectoryTree, len(paths))
+	failures := make([]*TreeError, len(paths))
+	buildChild := func(i int) {
+		child, err := b.build(paths[i], depth, ancestors)
+		if err != nil {
+			failures[i] = b.recordError(paths[i], err)
+			return
+		}
+		children[i] = child
+	}
+
+	var wg sync.WaitGroup
+	for i := range paths {
+		select {
+		case b.slots <- struct{}{}:
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-b.slots }()
+				buildChild(i)
+			}(i)
+		default:
+			buildChild(i)
+		}
+	}
+	wg.Wait()
+
+	var treeErrors []*TreeError
+	for _, treeErr := range failures {
+		if treeErr != nil {
+			treeErrors = append(treeErrors, treeErr)
+		}
+	}
+	return children, treeErrors
+}
+
+// recordError logs an entry that could not be read and returns it as a *TreeError. With
+// FailFast set, it stops the build instead and returns nil.
+func (b *treeBuilder) recordError(path string, err error) *TreeError {
+	treeErr := &TreeError{Path: path, Err: err}
+	if b.options.Logger != nil {
+		b.options.Logger.Warn("could not read tree entry", "path", path, "error", err)
+	}
+	if b.options.FailFast {
+		b.failOnce.Do(func() {
+			b.failure = treeErr
+			b.failed.Store(true)
+		})
+		return nil
+	}
+	return treeErr
+}
+
+// collectTreeErrors returns the errors recorded anywhere in a tree, in depth-first order.
+func collectTreeErrors(tree DirectoryTree) []*TreeError {
+	errs := append([]*TreeError(nil), tree.Errors...)
+	for _, child := range tree.Children {
+		errs = append(errs, collectTreeErrors(child)...)
+	}
+	return errs
+}
+
+// add accumulates another summary into s.
+func (s *TreeSummary) add(other TreeSummary) {
+	s.Files += other.Files
+	s.Dirs += other.Dirs
+	s.Size += other.Size
+}
+
+// countTree counts the files, directories and bytes under path that the include and
+// exclude patterns in options would keep, without building nodes for them. Symbolic links
+// are handled like buildDirectoryTree handles them, with listed links counted as entries
+// of no size. isDir reports whether path itself would be kept as a directory.
+func countTree(backend Backend, path string, options TreeOptions, ancestors []fs.FileInfo) (summary TreeSummary, isDir bool, err error) {
+	info, err := backend.Lstat(path)
+	if err != nil {
+		return summary, false, err
+	}
+	if isExcluded(info.Name(), options.Exclude) || checkAccess(backend, PolicyTree, path) != nil {
+		return summary, false, nil
+	}
+	if isSymlink(info) {
+		if options.Symlinks == SymlinkSkip {
+			return summary, false, nil
+		}
+		target, err := backend.Stat(path)
+		if options.Symlinks != SymlinkFollow || err != nil || (target.IsDir() && isVisited(target, ancestors)) {
+			node := linkNode(path, info.Name(), "", target, options.Include)
+			if node.Path != "" && node.IsFile {
+				summary.Files = 1
+			}
+			return summary, node.Path != "" && !node.IsFile, nil
+		}
+		info = target
+	}
+	if !info.IsDir() {
+		if isIncluded(info.Name(), options.Include) {
+			summary.Files = 1
+			summary.Size = info.Size()
+		}
+		return summary, false, nil
+	}
+
+	entries, err := backend.ReadDir(path)
+	if err != nil {
+		return summary, false, err
+	}
+	ancestors = withAncestor(ancestors, info)
+	for _, entry := range entries {
+		child, childIsDir, err := countTree(backend, filepath.Join(path, entry.Name()), options, ancestors)
+		if err != nil {
+			continue
+		}
+		if childIsDir {
+			summary.Dirs++
+		}
+		summary.add(child)
+	}
+	return summary, summary.Files > 0 || len(options.Include) == 0, nil
+}
+
+// newSummaryNode returns a placeholder node standing in for omitted entries of the
+// directory at path. more indicates that some of the directory's entries are shown.
+func newSummaryNode(path string, summary TreeSummary, more bool) DirectoryTree {
+	files := "files"
+	if summary.Files == 1 {
+		files = "file"
+	}
+	name := fmt.Sprintf("… %d %s", summary.Files, files)
+	if more {
+		name = fmt.Sprintf("… %d more %s", summary.Files, files)
+	}
+	if summary.Dirs > 0 {
+		dirs := "dirs"
+		if summary.Dirs == 1 {
+			dirs = "dir"
+		}
+		name += fmt.Sprintf(" in %d %s", summary.Dirs, dirs)
+	}
+	name += ", " + formatSize(summary.Size)
 
-	return DirectoryTree{
-			Path:     path,
-			Name:     info.Name(),
-			IsFile:   false,
-			Children: children,
-			Size:     size,
-		},
-		nil
+	omitted := summary
+	return DirectoryTree{Path: path, Name: name, Size: summary.Size, Omitted: &omitted}
 }
 
 // workingDirectoryTree constructs and prints a directory tree of the current working directory.
-func workingDirectoryTree(include, exclude []string) (DirectoryTree, error) {
+func workingDirectoryTree(options TreeOptions) (DirectoryTree, error) {
 	dir, err := os.Getwd()
 	if err != nil {
 		return DirectoryTree{}, fmt.Errorf("could not get working directory: %w", err)
 	}
 
-	tree, err := buildDirectoryTree(dir, include, exclude)
+	tree, err := buildDirectoryTree(defaultBackend, dir, options)
 	if err != nil {
 		return DirectoryTree{}, fmt.Errorf("could not build directory tree for %q: %w", dir, err)
 	}
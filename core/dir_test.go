@@ -1,9 +1,17 @@
 package core
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateDir_AlreadyExists(t *testing.T) {
@@ -102,7 +110,7 @@ func TestBuildDirectoryTree(t *testing.T) {
 	}
 
 	// Build the directory tree
-	tree, err := buildDirectoryTree(tmpDir, nil, nil)
+	tree, err := buildDirectoryTree(defaultBackend, tmpDir, TreeOptions{})
 	if err != nil {
 		t.Fatalf("buildDirectoryTree failed: %v", err)
 	}
@@ -146,13 +154,13 @@ func TestBuildDirectoryTree(t *testing.T) {
 	}
 
 	// Test stat error
-	_, err = buildDirectoryTree("non-existent-dir", nil, nil)
+	_, err = buildDirectoryTree(defaultBackend, "non-existent-dir", TreeOptions{})
 	if err == nil {
 		t.Error("buildDirectoryTree with non-existent directory should have returned an error")
 	}
 
 	// Test include filter
-	tree, err = buildDirectoryTree(tmpDir, []string{"*.txt"}, nil)
+	tree, err = buildDirectoryTree(defaultBackend, tmpDir, TreeOptions{Include: []string{"*.txt"}})
 	if err != nil {
 		t.Fatalf("buildDirectoryTree with include filter failed: %v", err)
 	}
@@ -161,7 +169,7 @@ func TestBuildDirectoryTree(t *testing.T) {
 	}
 
 	// Test exclude filter
-	tree, err = buildDirectoryTree(tmpDir, nil, []string{"*.bin"})
+	tree, err = buildDirectoryTree(defaultBackend, tmpDir, TreeOptions{Exclude: []string{"*.bin"}})
 	if err != nil {
 		t.Fatalf("buildDirectoryTree with exclude filter failed: %v", err)
 	}
@@ -177,7 +185,7 @@ func TestBuildDirectoryTree(t *testing.T) {
 	if err = os.Chmod(unreadableDir, 0000); err != nil {
 		t.Fatalf("Failed to chmod unreadable dir: %v", err)
 	}
-	tree, err = buildDirectoryTree(tmpDir, nil, nil)
+	tree, err = buildDirectoryTree(defaultBackend, tmpDir, TreeOptions{})
 	if err != nil {
 		t.Fatalf("buildDirectoryTree with unreadable dir failed: %v", err)
 	}
@@ -190,3 +198,534 @@ func TestBuildDirectoryTree(t *testing.T) {
 		t.Fatalf("Failed to chmod unreadable dir: %v", err)
 	}
 }
+
+// setupLimitTree creates a tree with a wide top level and a deep chain:
+//
+//	root/
+//	  f0.txt .. f4.txt (10 bytes each)
+//	  deep/a/b/c.txt (3 bytes)
+func setupLimitTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(filepath.Join(root, "f"+string(rune('0'+i))+".txt"), []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(root, "deep", "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "deep", "a", "b", "c.txt"), []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestBuildDirTree_MaxDepth(t *testing.T) {
+	root := setupLimitTree(t)
+
+	tree, err := BuildDirTree(root, TreeOptions{MaxDepth: 2})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	if tree.Size != 53 {
+		t.Errorf("Expected total size 53 including summarized entries, got %d", tree.Size)
+	}
+
+	deep := tree.Children[0]
+	if deep.Name != "deep" || len(deep.Children) != 1 {
+		t.Fatalf("Unexpected deep node: %+v", deep)
+	}
+	a := deep.Children[0]
+	if a.Name != "a" || len(a.Children) != 1 || a.Children[0].Omitted == nil {
+		t.Fatalf("Expected a to hold a single placeholder, got %+v", a)
+	}
+	placeholder := a.Children[0]
+	if *placeholder.Omitted != (TreeSummary{Files: 1, Dirs: 1, Size: 3}) {
+		t.Errorf("Unexpected summary: %+v", *placeholder.Omitted)
+	}
+	if placeholder.Name != "… 1 file in 1 dir, 3 B" {
+		t.Errorf("Unexpected placeholder name: %q", placeholder.Name)
+	}
+
+	// Include patterns apply to summarized directories too.
+	tree, err = BuildDirTree(root, TreeOptions{MaxDepth: 1, Include: []string{"*.go"}})
+	if err != nil {
+		t.Fatalf("BuildDirTree with include failed: %v", err)
+	}
+	if len(tree.Children) != 0 {
+		t.Errorf("Expected no entries to match *.go, got %+v", tree.Children)
+	}
+}
+
+func TestBuildDirTree_MaxChildrenPerDir(t *testing.T) {
+	root := setupLimitTree(t)
+
+	tree, err := BuildDirTree(root, TreeOptions{MaxChildrenPerDir: 2})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	if len(tree.Children) != 3 {
+		t.Fatalf("Expected 2 entries and a placeholder, got %d children", len(tree.Children))
+	}
+	placeholder := tree.Children[2]
+	if placeholder.Omitted == nil || *placeholder.Omitted != (TreeSummary{Files: 4, Size: 40}) {
+		t.Errorf("Unexpected placeholder: %+v", placeholder)
+	}
+	if placeholder.Name != "… 4 more files, 40 B" {
+		t.Errorf("Unexpected placeholder name: %q", placeholder.Name)
+	}
+	if tree.Size != 53 {
+		t.Errorf("Expected total size 53, got %d", tree.Size)
+	}
+}
+
+func TestBuildDirTree_MaxTotalEntries(t *testing.T) {
+	root := setupLimitTree(t)
+
+	tree, err := BuildDirTree(root, TreeOptions{MaxTotalEntries: 6})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+
+	// Breadth first: the six top-level entries are kept, everything below deep/ is summarized.
+	if len(tree.Children) != 6 {
+		t.Fatalf("Expected 6 top-level entries, got %d", len(tree.Children))
+	}
+	deep := tree.Children[0]
+	if len(deep.Children) != 1 || deep.Children[0].Omitted == nil {
+		t.Fatalf("Expected deep/ to hold a single placeholder, got %+v", deep.Children)
+	}
+	if *deep.Children[0].Omitted != (TreeSummary{Files: 1, Dirs: 2, Size: 3}) {
+		t.Errorf("Unexpected summary: %+v", *deep.Children[0].Omitted)
+	}
+
+	outline, err := RenderTree(tree, TreeFormatOutline, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(outline, "  deep/\n    … 1 file in 2 dirs, 3 B\n") {
+		t.Errorf("Placeholder not rendered as expected:\n%s", outline)
+	}
+}
+
+func TestBuildDirTree_MaxTotalEntriesSkipsDropped(t *testing.T) {
+	memory := NewMemoryBackend()
+	for i := 0; i < 5; i++ {
+		if err := memory.WriteFile(fmt.Sprintf("/f%d.txt", i), []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := memory.MkdirAll("/deep/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.WriteFile("/deep/a/b/c.txt", []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	backend := &readCountingBackend{Backend: memory}
+
+	options := TreeOptions{MaxTotalEntries: 3, SkipBinaryCheck: true, Metadata: MetadataOptions{Hash: true}}
+	tree, err := buildDirectoryTree(backend, "/", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// deep/, f0.txt and f1.txt are kept; only the two kept files are hashed.
+	if backend.reads != 2 {
+		t.Errorf("Expected 2 files to be read, got %d", backend.reads)
+	}
+	if len(tree.Children) != 4 || tree.Children[3].Omitted == nil {
+		t.Fatalf("Expected 3 entries and a placeholder, got %+v", tree.Children)
+	}
+	if *tree.Children[3].Omitted != (TreeSummary{Files: 3, Size: 30}) {
+		t.Errorf("Unexpected summary: %+v", *tree.Children[3].Omitted)
+	}
+	if deep := tree.Children[0]; len(deep.Children) != 1 || *deep.Children[0].Omitted != (TreeSummary{Files: 1, Dirs: 2, Size: 3}) {
+		t.Errorf("Expected deep/ to be summarized, got %+v", deep.Children)
+	}
+	if tree.Size != 53 {
+		t.Errorf("Expected total size 53 including summarized entries, got %d", tree.Size)
+	}
+}
+
+// createSyntheticTree creates files spread over nested directories, fanout entries per
+// directory, and returns the root.
+func createSyntheticTree(tb testing.TB, root string, files, fanout int) {
+	tb.Helper()
+	for i := 0; i < files; i++ {
+		dir := root
+		for n := i / fanout; n > 0; n /= fanout {
+			dir = filepath.Join(dir, fmt.Sprintf("d%d", n%fanout))
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.txt", i)), []byte("synthetic file content\n"), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestBuildDirTree_Concurrent(t *testing.T) {
+	root := t.TempDir()
+	createSyntheticTree(t, root, 2000, 10)
+
+	sequential, err := BuildDirTree(root, TreeOptions{Workers: 1})
+	if err != nil {
+		t.Fatalf("sequential BuildDirTree failed: %v", err)
+	}
+	parallel, err := BuildDirTree(root, TreeOptions{Workers: 8})
+	if err != nil {
+		t.Fatalf("parallel BuildDirTree failed: %v", err)
+	}
+
+	sequentialJSON, _ := GetTreeMinifiedJSON(sequential)
+	parallelJSON, _ := GetTreeMinifiedJSON(parallel)
+	if sequentialJSON != parallelJSON {
+		t.Error("Concurrent tree building should produce the same tree as sequential building")
+	}
+
+	limited, err := BuildDirTree(root, TreeOptions{Workers: 8, MaxChildrenPerDir: 3})
+	if err != nil {
+		t.Fatalf("limited BuildDirTree failed: %v", err)
+	}
+	if len(limited.Children) != 4 || limited.Children[3].Omitted == nil {
+		t.Errorf("Expected 3 entries and a placeholder, got %d children", len(limited.Children))
+	}
+	if limited.Size != sequential.Size {
+		t.Errorf("Limited tree size %d should match full tree size %d", limited.Size, sequential.Size)
+	}
+}
+
+func TestBuildDirTree_SkipBinaryCheck(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "binary.bin"), []byte{0, 1, 2}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := BuildDirTree(root, TreeOptions{SkipBinaryCheck: true})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	if tree.Children[0].IsBinary {
+		t.Error("IsBinary should be left unset when SkipBinaryCheck is enabled")
+	}
+	if !IsBinary(tree.Children[0].Path) {
+		t.Error("IsBinary should still detect the file lazily")
+	}
+}
+
+// createSymlinkTree creates a directory with a file, a link to the file, a link back to
+// the root that forms a cycle, and a dangling link.
+func createSymlinkTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "file.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"sub/link.txt": "file.txt",
+		"sub/loop":     "..",
+		"dangling":     "missing",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	return root
+}
+
+// findNode returns the node at the slash-separated path below tree.
+func findNode(tree DirectoryTree, path string) (DirectoryTree, bool) {
+	for _, name := range strings.Split(path, "/") {
+		found := false
+		for _, child := range tree.Children {
+			if child.Name == name {
+				tree, found = child, true
+				break
+			}
+		}
+		if !found {
+			return DirectoryTree{}, false
+		}
+	}
+	return tree, true
+}
+
+func TestBuildDirTree_Symlinks(t *testing.T) {
+	root := createSymlinkTree(t)
+
+	listed, err := BuildDirTree(root, TreeOptions{})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	loop, ok := findNode(listed, "sub/loop")
+	if !ok || !loop.IsSymlink || loop.LinkTarget != ".." || loop.IsFile || len(loop.Children) != 0 {
+		t.Errorf("Listed link to a directory should be a leaf with its target, got %+v", loop)
+	}
+	link, ok := findNode(listed, "sub/link.txt")
+	if !ok || !link.IsSymlink || !link.IsFile || link.Size != 0 {
+		t.Errorf("Listed link to a file should be a leaf of no size, got %+v", link)
+	}
+	if dangling, ok := findNode(listed, "dangling"); !ok || !dangling.IsSymlink || dangling.LinkTarget != "missing" {
+		t.Errorf("Dangling link should be listed, got %+v", dangling)
+	}
+
+	skipped, err := BuildDirTree(root, TreeOptions{Symlinks: SymlinkSkip})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	for _, path := range []string{"sub/loop", "sub/link.txt", "dangling"} {
+		if _, ok := findNode(skipped, path); ok {
+			t.Errorf("Link %s should be skipped", path)
+		}
+	}
+
+	followed, err := BuildDirTree(root, TreeOptions{Symlinks: SymlinkFollow})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	link, ok = findNode(followed, "sub/link.txt")
+	if !ok || !link.IsSymlink || link.Size != 5 {
+		t.Errorf("Followed link to a file should take the file's size, got %+v", link)
+	}
+	loop, ok = findNode(followed, "sub/loop")
+	if !ok || !loop.IsSymlink || len(loop.Children) != 0 {
+		t.Errorf("Link cycle should be listed instead of followed, got %+v", loop)
+	}
+}
+
+func TestBuildDirTree_FollowedLinkIntoSibling(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "file.txt"), []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a", filepath.Join(root, "b")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+
+	tree, err := BuildDirTree(root, TreeOptions{Symlinks: SymlinkFollow, MaxDepth: 1})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	b, ok := findNode(tree, "b")
+	if !ok || !b.IsSymlink || len(b.Children) != 1 || b.Children[0].Omitted == nil || b.Children[0].Omitted.Files != 1 {
+		t.Errorf("Link to a sibling directory is not a cycle and should be followed, got %+v", b)
+	}
+}
+
+func TestDeleteDir_Symlink(t *testing.T) {
+	root := createSymlinkTree(t)
+	target := t.TempDir()
+	if err := os.WriteFile(filepath.Join(target, "keep.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "outside")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteDir(link); err != nil {
+		t.Fatalf("DeleteDir failed: %v", err)
+	}
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Error("DeleteDir should remove the link itself")
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteDir(root); err != nil {
+		t.Fatalf("DeleteDir failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "keep.txt")); err != nil {
+		t.Errorf("DeleteDir should never remove the targets of links: %v", err)
+	}
+}
+
+// BenchmarkBuildDirTree compares sequential and concurrent tree building on a synthetic
+// 100k-file tree. Run with: go test ./core -run '^$' -bench BuildDirTree -benchtime 3x
+func BenchmarkBuildDirTree(b *testing.B) {
+	root := b.TempDir()
+	createSyntheticTree(b, root, 100_000, 20)
+
+	benchmarks := []struct {
+		name    string
+		options TreeOptions
+	}{
+		{"sequential", TreeOptions{Workers: 1}},
+		{"parallel", TreeOptions{Workers: 8}},
+		{"sequential-skip-binary", TreeOptions{Workers: 1, SkipBinaryCheck: true}},
+		{"parallel-skip-binary", TreeOptions{Workers: 8, SkipBinaryCheck: true}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := BuildDirTree(root, bm.options); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// createUnreadableEntry creates a Unix socket at path, which cannot be opened even by
+// root, so reading its content fails.
+func createUnreadableEntry(t *testing.T, path string) {
+	t.Helper()
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+}
+
+func TestBuildDirTree_Errors(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "ok.txt"), []byte("ok"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(root, "sub", "sock")
+	createUnreadableEntry(t, socket)
+	options := TreeOptions{Metadata: MetadataOptions{MIMEType: true}}
+
+	var logs bytes.Buffer
+	options.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	tree, err := BuildDirTree(root, options)
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	sub := tree.Children[0]
+	if len(sub.Children) != 1 || sub.Children[0].Name != "ok.txt" {
+		t.Errorf("Unreadable entries should be left out, got %+v", sub.Children)
+	}
+	errs := TreeErrors(tree)
+	if len(errs) != 1 || errs[0].Path != socket || len(sub.Errors) != 1 {
+		t.Fatalf("Expected one error recorded on the parent directory, got %v", errs)
+	}
+	if !strings.Contains(logs.String(), "could not read tree entry") || !strings.Contains(logs.String(), socket) {
+		t.Errorf("Expected the error to be logged, got %q", logs.String())
+	}
+
+	minified, err := GetTreeMinifiedJSON(tree)
+	if err != nil {
+		t.Fatalf("GetTreeMinifiedJSON failed: %v", err)
+	}
+	var decoded DirectoryTree
+	if err := json.Unmarshal([]byte(minified), &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decodedErrs := TreeErrors(decoded); len(decodedErrs) != 1 || decodedErrs[0].Error() != errs[0].Error() {
+		t.Errorf("Errors should survive a JSON round trip, got %v", decodedErrs)
+	}
+
+	options.Logger = nil
+	options.FailFast = true
+	_, err = BuildDirTree(root, options)
+	var treeErr *TreeError
+	if !errors.As(err, &treeErr) || treeErr.Path != socket {
+		t.Errorf("Expected a *TreeError for %s with FailFast, got %v", socket, err)
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	root := createSymlinkTree(t)
+	if err := os.Chmod(filepath.Join(root, "sub", "file.txt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	for _, name := range []string{"sub/file.txt", "sub"} {
+		if err := os.Chtimes(filepath.Join(root, name), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "copy")
+	if err := CopyDir(filepath.Join(root, "sub"), dst); err != nil {
+		t.Fatalf("CopyDir failed: %v", err)
+	}
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, " ") != "file.txt link.txt loop" {
+		t.Fatalf("unexpected entries in copy: %v", entries)
+	}
+	for name, want := range map[string]string{"link.txt": "file.txt", "loop": ".."} {
+		if target, err := os.Readlink(filepath.Join(dst, name)); err != nil || target != want {
+			t.Errorf("%s was not copied as a link to %s: %q, %v", name, want, target, err)
+		}
+	}
+	for _, name := range []string{"file.txt", "."} {
+		info, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("%s has time %v, want %v", name, info.ModTime(), modTime)
+		}
+	}
+	if info, _ := os.Stat(filepath.Join(dst, "file.txt")); info.Mode().Perm() != 0600 {
+		t.Errorf("copied file has mode %v, want 0600", info.Mode().Perm())
+	}
+
+	if err := CopyDir(root, filepath.Join(root, "sub", "nested")); err == nil {
+		t.Error("copying a directory into itself should have failed")
+	}
+	if err := CopyDir(filepath.Join(root, "sub", "file.txt"), dst); err == nil {
+		t.Error("copying a file with CopyDir should have failed")
+	}
+
+	// Copying the dangling link replaces the link already copied there.
+	dangling := filepath.Join(root, "dangling")
+	info, err := os.Lstat(dangling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := copyEntry(OSBackend{}, dangling, filepath.Join(dst, "link.txt"), info); err != nil {
+		t.Fatalf("copying a dangling link failed: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link.txt")); err != nil || target != "missing" {
+		t.Errorf("dangling link copied as %q, %v", target, err)
+	}
+
+	// Links are never dropped: backends that cannot create them fail the copy.
+	overlay := NewFS(NewOverlayBackend(OSBackend{}, NewMemoryBackend()))
+	if err := overlay.CopyDir(filepath.Join(root, "sub"), filepath.Join(root, "overlay")); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("copying links on an overlay: got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestDirSizeAndIsEmptyDir(t *testing.T) {
+	root := setupLimitTree(t)
+	size, err := DirSize(root)
+	if err != nil {
+		t.Fatalf("DirSize failed: %v", err)
+	}
+	if size != 5*10+3 {
+		t.Errorf("DirSize = %d, want %d", size, 5*10+3)
+	}
+
+	empty := filepath.Join(root, "empty")
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{root: false, empty: true} {
+		if got, err := IsEmptyDir(path); err != nil || got != want {
+			t.Errorf("IsEmptyDir(%s) = %v, %v; want %v", path, got, err, want)
+		}
+	}
+}
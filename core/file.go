@@ -2,56 +2,217 @@ package core
 
 import (
 	"bytes"
-	"os"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
 )
 
 // readFile reads the content of a file at the given path and returns it as a byte slice.
 // It returns an error if the file cannot be read.
-func readFile(path string) ([]byte, error) {
-	return os.ReadFile(path)
+func readFile(backend Backend, path string) ([]byte, error) {
+	return backend.ReadFile(path)
+}
+
+// WriteOptions control how a file is written.
+type WriteOptions struct {
+	// Perm is the mode of the file if it is created, 0644 when zero. Existing files keep
+	// their mode.
+	Perm fs.FileMode `json:"perm,omitempty"`
+	// CreateDirs creates missing parent directories instead of failing.
+	CreateDirs bool `json:"create_dirs,omitempty"`
+	// Lock holds an exclusive lock on the file during the write, see FileLock, waiting up
+	// to LockTimeout for other lock holders, or without limit when it is zero.
+	Lock        bool          `json:"lock,omitempty"`
+	LockTimeout time.Duration `json:"lock_timeout,omitempty"`
 }
 
 // writeFile writes data to a file at the given path, creating the file if it doesn't exist.
-// To ensure data integrity, it performs an atomic write by first writing to a temporary file
-// and then renaming it to the final destination.
-func writeFile(path string, data []byte) error {
-	tempFile, err := os.CreateTemp("", "ffs-")
-	if err != nil {
-		return err
-	}
-	defer os.Remove(tempFile.Name())
+// The OS backend performs an atomic write by first writing to a temporary file in the same
+// directory and then renaming it to the final destination.
+func writeFile(backend WritableBackend, path string, data []byte) error {
+	return writeFileWith(backend, path, data, WriteOptions{})
+}
 
-	if _, err := tempFile.Write(data); err != nil {
-		return err
+// writeFileWith writes data to a file at the given path according to options.
+func writeFileWith(backend WritableBackend, path string, data []byte, options WriteOptions) error {
+	perm := options.Perm
+	if perm == 0 {
+		perm = 0644
 	}
-
-	if err := tempFile.Close(); err != nil {
-		return err
+	if options.CreateDirs {
+		if err := backend.MkdirAll(filepath.Dir(path), fs.ModePerm); err != nil {
+			return err
+		}
 	}
-
-	return os.Rename(tempFile.Name(), path)
+	if options.Lock {
+		lock, err := lockWithTimeout(backend, path, options.LockTimeout)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	}
+	return backend.WriteFile(path, data, perm)
 }
 
 // deleteFile removes the file at the given path.
-// It returns an error if the file cannot be removed.
-func deleteFile(path string) error {
-	return os.Remove(path)
+// It returns an error if the file cannot be removed, and ErrProtectedPath for the root
+// of the filesystem, the home directory or the working directory.
+func deleteFile(backend WritableBackend, path string) error {
+	if err := checkDeletable("remove", path); err != nil {
+		return err
+	}
+	return backend.Remove(path)
 }
 
 // IsBinary checks if a file is likely binary by reading its first 1024 bytes
 // and checking for the presence of null bytes.
 func IsBinary(path string) bool {
-	file, err := os.Open(path)
+	return isBinary(defaultBackend, path)
+}
+
+// isBinary is IsBinary for files of any backend.
+func isBinary(backend Backend, path string) bool {
+	file, err := backend.Open(path)
 	if err != nil {
 		return false // Or handle error appropriately
 	}
 	defer file.Close()
 
-	buffer := make([]byte, 1024)
-	n, err := file.Read(buffer)
-	if err != nil && err.Error() != "EOF" {
+	buffer := make([]byte, binaryCheckSize)
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
 		return false // Or handle error
 	}
 
-	return bytes.Contains(buffer[:n], []byte{0})
+	return isBinaryContent(buffer[:n])
+}
+
+// binaryCheckSize is how many bytes at the start of a file are checked for binary content.
+const binaryCheckSize = 1024
+
+// isBinaryContent reports whether head, the start of a file, holds binary content.
+func isBinaryContent(head []byte) bool {
+	return bytes.Contains(head, []byte{0})
+}
+
+// statFile returns the file info of a path, following links.
+func statFile(backend Backend, path string) (fs.FileInfo, error) {
+	return backend.Stat(path)
+}
+
+// exists reports whether something exists at path, without following a final link.
+func exists(backend Backend, path string) (bool, error) {
+	_, err := backend.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// appendFile appends data to a file, creating it if it does not exist. Wrapping backends
+// see the append as a patch of the file.
+func appendFile(backend WritableBackend, path string, data []byte) error {
+	backend = forOperation(backend, AuditPatch)
+	content, err := backend.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return writeFile(backend, path, append(content, data...))
+}
+
+// openFile opens a file for reading.
+func openFile(backend Backend, path string) (fs.File, error) {
+	file, err := backend.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		file.Close()
+		return nil, &fs.PathError{Op: "open", Path: path, Err: errors.New("is a directory")}
+	}
+	return file, nil
+}
+
+// createFile returns a writer for a new content of the file at path, which is written when
+// the writer is closed. Until then the file is unchanged.
+func createFile(backend WritableBackend, path string) (io.WriteCloser, error) {
+	if info, err := backend.Stat(filepath.Dir(path)); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, &fs.PathError{Op: "create", Path: path, Err: errors.New("not a directory")}
+	}
+	return &fileWriter{backend: backend, path: path}, nil
+}
+
+// fileWriter buffers the content of a file until it is closed.
+type fileWriter struct {
+	backend WritableBackend
+	path    string
+	buffer  bytes.Buffer
+	closed  bool
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, &fs.PathError{Op: "write", Path: w.path, Err: fs.ErrClosed}
+	}
+	return w.buffer.Write(p)
+}
+
+// Close writes the buffered content to the file.
+func (w *fileWriter) Close() error {
+	if w.closed {
+		return &fs.PathError{Op: "close", Path: w.path, Err: fs.ErrClosed}
+	}
+	w.closed = true
+	return writeFile(w.backend, w.path, w.buffer.Bytes())
+}
+
+// moveFile moves a file, directory or link, copying and then removing it when it cannot be
+// renamed across devices. Links are moved as links, like copyDir copies them.
+func moveFile(backend WritableBackend, oldPath, newPath string) error {
+	err := backend.Rename(oldPath, newPath)
+	if !isCrossDevice(err) {
+		return err
+	}
+	info, err := backend.Lstat(oldPath)
+	if err != nil {
+		return err
+	}
+	if err := copyEntry(backend, oldPath, newPath, info); err != nil {
+		return err
+	}
+	return backend.RemoveAll(oldPath)
+}
+
+// copyFile copies a file with its mode and modification time, replacing any file at dst.
+// Like patches, copies read the real content of the file, so that wrappers such as
+// RedactBackend copy secrets as they are instead of writing placeholders.
+func copyFile(backend WritableBackend, src, dst string) error {
+	backend = forOperation(backend, AuditCopy)
+	info, err := backend.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &fs.PathError{Op: "copy", Path: src, Err: errors.New("is a directory")}
+	}
+	data, err := backend.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := backend.WriteFile(dst, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := backend.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return backend.Chtimes(dst, info.ModTime())
+}
+
+// chmod changes the permission bits of a file or directory.
+func chmod(backend WritableBackend, path string, mode fs.FileMode) error {
+	return backend.Chmod(path, mode)
 }
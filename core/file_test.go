@@ -1,8 +1,13 @@
 package core
 
 import (
+	"errors"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestReadFile_NonExistent(t *testing.T) {
@@ -165,3 +170,191 @@ func TestIsBinary(t *testing.T) {
 	}
 	os.Remove(name)
 }
+
+func TestWriteFile_KeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("#!/bin/sh\necho hi\n")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("mode after WriteFile = %v, want 0755", info.Mode().Perm())
+	}
+}
+
+func TestAppendFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+	if err := AppendFile(path, []byte("one\n")); err != nil {
+		t.Fatalf("AppendFile on a missing file failed: %v", err)
+	}
+	if err := AppendFile(path, []byte("two\n")); err != nil {
+		t.Fatalf("AppendFile failed: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "one\ntwo\n" {
+		t.Errorf("content = %q, want %q", content, "one\ntwo\n")
+	}
+}
+
+func TestCreateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := CreateFile(path)
+	if err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	io.WriteString(w, "new ")
+	io.WriteString(w, "content")
+	if content, _ := os.ReadFile(path); string(content) != "old" {
+		t.Errorf("file changed before Close: %q", content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "new content" {
+		t.Errorf("content = %q, want %q", content, "new content")
+	}
+	if _, err := w.Write([]byte("more")); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("writing after Close: got %v, want ErrClosed", err)
+	}
+	if _, err := CreateFile(filepath.Join(path, "child")); err == nil {
+		t.Error("creating a file below a file should have failed")
+	}
+
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+	if content, _ := io.ReadAll(f); string(content) != "new content" {
+		t.Errorf("OpenFile read %q", content)
+	}
+	if _, err := OpenFile(filepath.Dir(path)); err == nil {
+		t.Error("opening a directory should have failed")
+	}
+}
+
+func TestMoveAndCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "run.sh")
+	if err := os.WriteFile(src, []byte("#!/bin/sh\n"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "copy.sh")
+	if err := CopyFile(src, dst); err != nil {
+		t.Fatalf("CopyFile failed: %v", err)
+	}
+	info, err := Stat(dst)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0750 || !info.ModTime().Equal(modTime) {
+		t.Errorf("copy has mode %v and time %v, want 0750 and %v", info.Mode().Perm(), info.ModTime(), modTime)
+	}
+	if err := CopyFile(dir, filepath.Join(dir, "dir-copy")); err == nil {
+		t.Error("copying a directory should have failed")
+	}
+
+	moved := filepath.Join(dir, "moved.sh")
+	if err := MoveFile(src, moved); err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+	if ok, err := Exists(src); ok || err != nil {
+		t.Errorf("Exists(src) after move = %v, %v", ok, err)
+	}
+	if ok, err := Exists(moved); !ok || err != nil {
+		t.Errorf("Exists(moved) = %v, %v", ok, err)
+	}
+
+	if err := Chmod(moved, 0600); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	if info, _ := os.Stat(moved); info.Mode().Perm() != 0600 {
+		t.Errorf("mode after Chmod = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestWriteFile_Atomic(t *testing.T) {
+	// Temporary files are created next to the target, so os.TempDir does not matter.
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, backend := range []WritableBackend{OSBackend{}, OSBackend{NoSync: true}} {
+		if err := NewFS(backend).WriteFile(path, []byte(`{"a":1}`)); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files were left behind: %v", entries)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode after WriteFile = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestWriteFile_Symlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	link := filepath.Join(dir, "link.txt")
+	if err := os.WriteFile(target, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("target.txt", link); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	if err := WriteFile(link, []byte("new")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("the link was replaced: %v, %v", info, err)
+	}
+	if content, _ := os.ReadFile(target); string(content) != "new" {
+		t.Errorf("target content = %q, want %q", content, "new")
+	}
+}
+
+func TestWriteFileWithOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a", "b", "run.sh")
+	if err := WriteFileWithOptions(path, []byte("#!/bin/sh\n"), WriteOptions{}); err == nil {
+		t.Error("writing into a missing directory should have failed")
+	}
+	if err := WriteFileWithOptions(path, []byte("#!/bin/sh\n"), WriteOptions{Perm: 0750, CreateDirs: true}); err != nil {
+		t.Fatalf("WriteFileWithOptions failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("mode of new file = %v, want 0750", info.Mode().Perm())
+	}
+	if err := WriteFileWithOptions(path, []byte("#!/bin/sh\necho\n"), WriteOptions{Perm: 0600}); err != nil {
+		t.Fatalf("WriteFileWithOptions failed: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0750 {
+		t.Errorf("mode of existing file = %v, want 0750", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,303 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// ErrReadOnly is returned by operations that modify a backend that cannot be written to.
+var ErrReadOnly = errors.New("filesystem is read-only")
+
+// FS runs the operations of this package against a backend instead of the operating
+// system's filesystem. Its methods behave like the package-level functions of the same
+// name. Backends that do not implement WritableBackend can be read, searched and turned
+// into trees; modifying them fails with ErrReadOnly.
+type FS struct {
+	backend Backend
+}
+
+// NewFS returns an FS operating on backend.
+func NewFS(backend Backend) *FS {
+	return &FS{backend: backend}
+}
+
+// Backend returns the backend the FS operates on.
+func (f *FS) Backend() Backend {
+	return f.backend
+}
+
+// ReadFile reads the content of a file at the given path.
+func (f *FS) ReadFile(path string) ([]byte, error) {
+	return readFile(f.backend, path)
+}
+
+// WriteFile writes data to a file at the given path.
+func (f *FS) WriteFile(path string, data []byte) error {
+	backend, err := writableBackend(f.backend, "write", path)
+	if err != nil {
+		return err
+	}
+	return writeFile(backend, path, data)
+}
+
+// WriteFileWithOptions writes data to a file at the given path according to options.
+func (f *FS) WriteFileWithOptions(path string, data []byte, options WriteOptions) error {
+	backend, err := writableBackend(f.backend, "write", path)
+	if err != nil {
+		return err
+	}
+	return writeFileWith(backend, path, data, options)
+}
+
+// DeleteFile removes the file at the given path.
+func (f *FS) DeleteFile(path string) error {
+	backend, err := writableBackend(f.backend, "remove", path)
+	if err != nil {
+		return err
+	}
+	return deleteFile(backend, path)
+}
+
+// Stat returns the file info of a path, following links.
+func (f *FS) Stat(path string) (fs.FileInfo, error) {
+	return statFile(f.backend, path)
+}
+
+// Exists reports whether something exists at path, without following a final link.
+func (f *FS) Exists(path string) (bool, error) {
+	return exists(f.backend, path)
+}
+
+// AppendFile appends data to a file, creating it if it does not exist.
+func (f *FS) AppendFile(path string, data []byte) error {
+	backend, err := writableBackend(f.backend, "write", path)
+	if err != nil {
+		return err
+	}
+	return appendFile(backend, path, data)
+}
+
+// OpenFile opens a file for reading.
+func (f *FS) OpenFile(path string) (fs.File, error) {
+	return openFile(f.backend, path)
+}
+
+// CreateFile returns a writer for a new content of a file, which is written when the
+// writer is closed.
+func (f *FS) CreateFile(path string) (io.WriteCloser, error) {
+	backend, err := writableBackend(f.backend, "create", path)
+	if err != nil {
+		return nil, err
+	}
+	return createFile(backend, path)
+}
+
+// MoveFile moves a file or directory.
+func (f *FS) MoveFile(oldPath, newPath string) error {
+	backend, err := writableBackend(f.backend, "rename", oldPath)
+	if err != nil {
+		return err
+	}
+	return moveFile(backend, oldPath, newPath)
+}
+
+// CopyFile copies a file with its mode and modification time.
+func (f *FS) CopyFile(src, dst string) error {
+	backend, err := writableBackend(f.backend, "copy", dst)
+	if err != nil {
+		return err
+	}
+	return copyFile(backend, src, dst)
+}
+
+// Chmod changes the permission bits of a file or directory.
+func (f *FS) Chmod(path string, mode fs.FileMode) error {
+	backend, err := writableBackend(f.backend, "chmod", path)
+	if err != nil {
+		return err
+	}
+	return chmod(backend, path, mode)
+}
+
+// LockFile takes an exclusive advisory lock on a file, waiting for other lock holders until
+// ctx is done. Backends other than the operating system's and RootBackend cannot be
+// locked.
+func (f *FS) LockFile(ctx context.Context, path string) (*FileLock, error) {
+	backend, err := writableBackend(f.backend, "lock", path)
+	if err != nil {
+		return nil, err
+	}
+	return lockFile(ctx, backend, path)
+}
+
+// TryLockFile takes an exclusive advisory lock on a file, failing with ErrLocked if another
+// lock holder has it.
+func (f *FS) TryLockFile(path string) (*FileLock, error) {
+	backend, err := writableBackend(f.backend, "lock", path)
+	if err != nil {
+		return nil, err
+	}
+	return tryLockFile(backend, path)
+}
+
+// CreateDir creates a directory at the specified path.
+func (f *FS) CreateDir(path string) error {
+	backend, err := writableBackend(f.backend, "mkdir", path)
+	if err != nil {
+		return err
+	}
+	return createDir(backend, path)
+}
+
+// DeleteDir removes a directory at the specified path.
+func (f *FS) DeleteDir(path string) error {
+	backend, err := writableBackend(f.backend, "remove", path)
+	if err != nil {
+		return err
+	}
+	return deleteDir(backend, path)
+}
+
+// ListDir returns the entries of a directory sorted by name.
+func (f *FS) ListDir(path string) ([]fs.DirEntry, error) {
+	return listDir(f.backend, path)
+}
+
+// WalkDir walks the tree at root like fs.WalkDir, calling fn with paths joined to root.
+func (f *FS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return walkDir(f.backend, root, fn)
+}
+
+// Glob returns the paths below root matching pattern, which may contain "**" segments.
+func (f *FS) Glob(root, pattern string) ([]string, error) {
+	return glob(f.backend, root, pattern)
+}
+
+// CopyDir copies a directory recursively, keeping the modes and modification times of
+// its entries. Links are recreated as links.
+func (f *FS) CopyDir(src, dst string) error {
+	backend, err := writableBackend(f.backend, "copy", dst)
+	if err != nil {
+		return err
+	}
+	return copyDir(backend, src, dst)
+}
+
+// DirSize returns the total size of the regular files below a directory.
+func (f *FS) DirSize(path string) (int64, error) {
+	return dirSize(f.backend, path)
+}
+
+// IsEmptyDir reports whether a directory has no entries.
+func (f *FS) IsEmptyDir(path string) (bool, error) {
+	return isEmptyDir(f.backend, path)
+}
+
+// OpenArchive returns a read-only Backend serving the files of a tar, tar.gz or zip archive.
+func (f *FS) OpenArchive(path string) (Backend, error) {
+	return openArchive(f.backend, path)
+}
+
+// ExportArchive writes the entries of a directory tree to a new tar, tar.gz or zip archive.
+func (f *FS) ExportArchive(tree DirectoryTree, dst string, options ArchiveOptions) error {
+	backend, err := writableBackend(f.backend, "write", dst)
+	if err != nil {
+		return err
+	}
+	return exportArchive(backend, tree, dst, options)
+}
+
+// BuildDirTree builds a tree based on path provided.
+func (f *FS) BuildDirTree(path string, options TreeOptions) (DirectoryTree, error) {
+	return buildDirectoryTree(f.backend, path, options)
+}
+
+// IsBinary reports whether the file at path looks binary.
+func (f *FS) IsBinary(path string) bool {
+	return isBinary(f.backend, path)
+}
+
+// ReadLines reads lines start through end (1-based, inclusive) of a file.
+// An end of 0 or less reads to the end of the file.
+func (f *FS) ReadLines(path string, start, end int) ([]string, error) {
+	return readLines(f.backend, path, start, end)
+}
+
+// ReadBytes reads up to length bytes of a file starting at offset.
+func (f *FS) ReadBytes(path string, offset, length int64) ([]byte, error) {
+	return readBytes(f.backend, path, offset, length)
+}
+
+// ChunkFile splits a file into line-aligned, optionally overlapping chunks.
+func (f *FS) ChunkFile(path string, options ChunkOptions) ([]Chunk, error) {
+	return chunkFile(f.backend, path, options)
+}
+
+// ReadFileLines reads the lines of a file at the given path.
+func (f *FS) ReadFileLines(path string) ([]string, error) {
+	return readFileLines(f.backend, path)
+}
+
+// WriteFileLines writes the lines to a file at the given path.
+func (f *FS) WriteFileLines(path string, lines []string) error {
+	backend, err := writableBackend(f.backend, "write", path)
+	if err != nil {
+		return err
+	}
+	return writeFileLines(backend, path, lines)
+}
+
+// ApplyPatch applies a patch to a file.
+func (f *FS) ApplyPatch(request FileEditRequest, verbose, prompt, highlight bool) error {
+	backend, err := writableBackend(f.backend, "write", request.FilePath)
+	if err != nil {
+		return err
+	}
+	return editFileWorkflow(backend, request, verbose, prompt, highlight)
+}
+
+// ApplyStructuredEdit applies path-based edits to a JSON, YAML or TOML file.
+func (f *FS) ApplyStructuredEdit(request StructuredEditRequest, verbose, prompt, highlight bool) error {
+	backend, err := writableBackend(f.backend, "write", request.FilePath)
+	if err != nil {
+		return err
+	}
+	return structuredEditWorkflow(backend, request, verbose, prompt, highlight)
+}
+
+// SearchFiles performs a concurrent search for a query in a given path.
+func (f *FS) SearchFiles(rootPath, query string, options SearchOptions) ([]SearchResult, error) {
+	return search(f.backend, rootPath, query, options)
+}
+
+// AnnotateTreeTokens sets estimated token counts on every node of a directory tree.
+// A nil tokenizer uses the ApproxTokenizer.
+func (f *FS) AnnotateTreeTokens(tree *DirectoryTree, tokenizer Tokenizer) error {
+	return annotateTreeTokens(f.backend, tree, tokenizer)
+}
+
+// SaveTreeSnapshot writes a directory tree to a file so it can be diffed later.
+func (f *FS) SaveTreeSnapshot(tree DirectoryTree, path string) error {
+	backend, err := writableBackend(f.backend, "write", path)
+	if err != nil {
+		return err
+	}
+	return saveTreeSnapshot(backend, tree, path)
+}
+
+// LoadTreeSnapshot reads a directory tree written by SaveTreeSnapshot.
+func (f *FS) LoadTreeSnapshot(path string) (DirectoryTree, error) {
+	return loadTreeSnapshot(f.backend, path)
+}
+
+// ReplayAudit applies the successful writes, patches, deletions, renames and directory
+// creations of recorded events, in order.
+func (f *FS) ReplayAudit(events []AuditEvent) error {
+	backend, err := writableBackend(f.backend, "replay", "")
+	if err != nil {
+		return err
+	}
+	return replayAudit(backend, events)
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestFS_MemoryBackend(t *testing.T) {
+	fsys := NewFS(NewMemoryBackend())
+	if err := fsys.CreateDir("/repo/config"); err != nil {
+		t.Fatalf("CreateDir failed: %v", err)
+	}
+	if err := fsys.WriteFile("/repo/main.go", []byte("package main\n\nfunc main() {\n}\n")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := fsys.WriteFile("/repo/config/app.json", []byte(`{"port": 8080}`)); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// Patching reads and writes through the backend.
+	err := fsys.ApplyPatch(FileEditRequest{
+		FilePath: "/repo/main.go",
+		Edits:    []EditInstruction{{Action: "insert", LineNumber: 4, NewContent: "\tprintln(\"hi\")"}},
+	}, false, false, false)
+	if err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	content, _ := fsys.ReadFile("/repo/main.go")
+	if string(content) != "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n" {
+		t.Errorf("unexpected patched content: %q", content)
+	}
+
+	err = fsys.ApplyStructuredEdit(StructuredEditRequest{
+		FilePath: "/repo/config/app.json",
+		Edits:    []StructuredEdit{{Op: OpSet, Path: "port", Value: 9090}},
+	}, false, false, false)
+	if err != nil {
+		t.Fatalf("ApplyStructuredEdit failed: %v", err)
+	}
+	content, _ = fsys.ReadFile("/repo/config/app.json")
+	if want := `{"port":9090}`; string(content) != want {
+		t.Errorf("unexpected edited content: got %q, want %q", content, want)
+	}
+
+	// Searching and diffing see the same files.
+	results, err := fsys.SearchFiles("/repo", "println", SearchOptions{})
+	if err != nil || len(results) != 1 || results[0].LineNumber != 4 {
+		t.Errorf("SearchFiles = %+v, %v", results, err)
+	}
+
+	options := TreeOptions{Metadata: MetadataOptions{Hash: true}}
+	before, err := fsys.BuildDirTree("/repo", options)
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	if err := fsys.SaveTreeSnapshot(before, "/repo.snapshot"); err != nil {
+		t.Fatalf("SaveTreeSnapshot failed: %v", err)
+	}
+	fsys.Backend().(WritableBackend).Rename("/repo/main.go", "/repo/app.go")
+	after, _ := fsys.BuildDirTree("/repo", options)
+	snapshot, err := fsys.LoadTreeSnapshot("/repo.snapshot")
+	if err != nil {
+		t.Fatalf("LoadTreeSnapshot failed: %v", err)
+	}
+	diff := DiffTrees(snapshot, after)
+	if len(diff.Renamed) != 1 || diff.Renamed[0].Path != "app.go" {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+}
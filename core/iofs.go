@@ -0,0 +1,122 @@
+package core
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// FromFS returns a read-only Backend serving the files of an io/fs.FS such as an
+// embed.FS, a zip.Reader or an fstest.MapFS. Paths are resolved against the root of fsys,
+// so "/a/b", "a/b" and "./a/b" all name the same file. Lstat and ReadLink are passed on
+// when fsys provides them; otherwise Lstat is Stat and there are no links.
+func FromFS(fsys fs.FS) Backend {
+	return ioFSBackend{fsys: fsys}
+}
+
+// ioFSBackend adapts an io/fs.FS to the Backend interface.
+type ioFSBackend struct {
+	fsys fs.FS
+}
+
+// fsName converts a path given to a core function into a valid io/fs name.
+func fsName(name string) string {
+	parts := memoryPath(name)
+	if len(parts) == 0 {
+		return "."
+	}
+	return strings.Join(parts, "/")
+}
+
+func (b ioFSBackend) Open(name string) (fs.File, error) {
+	return b.fsys.Open(fsName(name))
+}
+
+func (b ioFSBackend) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(b.fsys, fsName(name))
+}
+
+func (b ioFSBackend) Lstat(name string) (fs.FileInfo, error) {
+	if fsys, ok := b.fsys.(interface {
+		Lstat(name string) (fs.FileInfo, error)
+	}); ok {
+		return fsys.Lstat(fsName(name))
+	}
+	return b.Stat(name)
+}
+
+func (b ioFSBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(b.fsys, fsName(name))
+}
+
+func (b ioFSBackend) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(b.fsys, fsName(name))
+}
+
+func (b ioFSBackend) ReadLink(name string) (string, error) {
+	if fsys, ok := b.fsys.(interface {
+		ReadLink(name string) (string, error)
+	}); ok {
+		return fsys.ReadLink(fsName(name))
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+}
+
+// AsFS returns an io/fs.FS view of the directory root of a backend, for use with the
+// standard library's fs.WalkDir, fs.Glob, template.ParseFS or http.FS.
+func AsFS(backend Backend, root string) fs.FS {
+	return backendFS{backend: backend, root: root}
+}
+
+// backendFS adapts a directory of a Backend to the io/fs.FS interface.
+type backendFS struct {
+	backend Backend
+	root    string
+}
+
+// path returns the backend path of an io/fs name, rejecting invalid names.
+func (f backendFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(f.root, filepath.FromSlash(name)), nil
+}
+
+func (f backendFS) Open(name string) (fs.File, error) {
+	path, err := f.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.backend.Open(path)
+}
+
+func (f backendFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := f.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.backend.Stat(path)
+}
+
+func (f backendFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, err := f.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.backend.ReadDir(path)
+}
+
+func (f backendFS) ReadFile(name string) ([]byte, error) {
+	path, err := f.path("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.backend.ReadFile(path)
+}
+
+var (
+	_ Backend       = ioFSBackend{}
+	_ fs.ReadDirFS  = backendFS{}
+	_ fs.ReadFileFS = backendFS{}
+	_ fs.StatFS     = backendFS{}
+)
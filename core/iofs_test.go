@@ -0,0 +1,61 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAsFS(t *testing.T) {
+	m := NewMemoryBackend()
+	m.MkdirAll("/project/docs", 0755)
+	m.WriteFile("/project/README.md", []byte("# project\n"), 0644)
+	m.WriteFile("/project/docs/guide.md", []byte("guide\n"), 0644)
+
+	if err := fstest.TestFS(AsFS(m, "/project"), "README.md", "docs/guide.md"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AsFS(m, "/project").Open("../etc/passwd"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("opening an invalid name: got %v, want ErrInvalid", err)
+	}
+}
+
+func TestFromFS(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"src/main.go":   {Data: []byte("package main\n\nfunc main() {}\n")},
+		"src/util.go":   {Data: []byte("package main\n\nfunc helper() {}\n")},
+		"assets/a.bin":  {Data: []byte{0, 1, 2}},
+		"assets/notes":  {Data: []byte("func in notes\n")},
+		"vendor/x/x.go": {Data: []byte("package x\n")},
+	}
+	fsys := NewFS(FromFS(mapFS))
+
+	tree, err := fsys.BuildDirTree("/", TreeOptions{Exclude: []string{"vendor"}})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	if len(tree.Children) != 2 {
+		t.Fatalf("unexpected children: %+v", tree.Children)
+	}
+	if node, ok := findNode(tree, "assets/a.bin"); !ok || !node.IsBinary {
+		t.Errorf("assets/a.bin was not detected as binary: %+v", node)
+	}
+
+	results, err := fsys.SearchFiles("src", "func", SearchOptions{})
+	if err != nil {
+		t.Fatalf("SearchFiles failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("expected 2 results, got %d: %+v", len(results), results)
+	}
+
+	lines, err := fsys.ReadLines("src/main.go", 3, 3)
+	if err != nil || len(lines) != 1 || lines[0] != "func main() {}" {
+		t.Errorf("ReadLines = %q, %v", lines, err)
+	}
+
+	if err := fsys.WriteFile("src/main.go", nil); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("writing to an io/fs backend: got %v, want ErrReadOnly", err)
+	}
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned when a file is locked by another lock holder and the caller does
+// not wait for it.
+var ErrLocked = errors.New("file is locked")
+
+// lockPollInterval is how often a waiting lock retries, since waiting in the kernel could
+// not be interrupted by a context.
+const lockPollInterval = 10 * time.Millisecond
+
+// FileLock is an exclusive advisory lock on a file, held until Unlock. Locks exclude other
+// locks on the same file, whether from this process or from others, but do not keep anyone
+// from reading or writing it without locking.
+//
+// The lock is taken on a hidden sidecar file in the same directory, named after the file
+// as ".<name>.ffs-lock", since atomic writes replace the file itself. Sidecar files are
+// left in place when unlocking, as removing them would race with other lockers.
+type FileLock struct {
+	path string
+	mu   sync.Mutex
+	file *os.File // nil once unlocked
+}
+
+// Path returns the path of the locked file.
+func (l *FileLock) Path() string {
+	return l.path
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return &fs.PathError{Op: "unlock", Path: l.path, Err: fs.ErrClosed}
+	}
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	if err != nil {
+		return &fs.PathError{Op: "unlock", Path: l.path, Err: err}
+	}
+	return nil
+}
+
+// fileLocker is implemented by backends whose files can be locked against other processes.
+type fileLocker interface {
+	// openLockFile opens the sidecar file that locks on name are taken on, creating it if
+	// needed.
+	openLockFile(name string) (*os.File, error)
+}
+
+// lockPath returns the path of the sidecar file that locks on the file at path are taken
+// on. The name cannot collide with files of its own like "Gemfile.lock".
+func lockPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".ffs-lock")
+}
+
+// lockFile takes an exclusive lock on the file at path, waiting for other lock holders
+// until ctx is done.
+func lockFile(ctx context.Context, backend Backend, path string) (*FileLock, error) {
+	return acquireLock(ctx, backend, path, true)
+}
+
+// tryLockFile takes an exclusive lock on the file at path, failing with ErrLocked if
+// another lock holder has it.
+func tryLockFile(backend Backend, path string) (*FileLock, error) {
+	return acquireLock(context.Background(), backend, path, false)
+}
+
+// lockWithTimeout takes an exclusive lock on the file at path, waiting up to timeout for
+// it, or without limit when timeout is zero.
+func lockWithTimeout(backend Backend, path string, timeout time.Duration) (*FileLock, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return lockFile(ctx, backend, path)
+}
+
+// acquireLock takes the lock on the file at path. Locking is checked against policies like
+// writing the file is, and so is creating or opening its sidecar file.
+func acquireLock(ctx context.Context, backend Backend, path string, wait bool) (*FileLock, error) {
+	for _, name := range []string{path, lockPath(path)} {
+		op := PolicyCreate
+		if _, err := backend.Lstat(name); err == nil {
+			op = PolicyWrite
+		}
+		if err := checkAccess(backend, op, name); err != nil {
+			return nil, err
+		}
+	}
+	var locker fileLocker
+	for _, backend := range wrappedBackends(backend) {
+		if l, ok := backend.(fileLocker); ok {
+			locker = l
+			break
+		}
+	}
+	if locker == nil {
+		return nil, &fs.PathError{Op: "lock", Path: path, Err: errors.ErrUnsupported}
+	}
+	file, err := locker.openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err := tryLock(file)
+		if err == nil {
+			return &FileLock{path: path, file: file}, nil
+		}
+		if !errors.Is(err, ErrLocked) || !wait {
+			file.Close()
+			return nil, &fs.PathError{Op: "lock", Path: path, Err: err}
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, &fs.PathError{Op: "lock", Path: path, Err: ctx.Err()}
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !(unix && !aix && !zos) && !windows
+
+package core
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLock fails, as files cannot be locked on this platform.
+func tryLock(f *os.File) error {
+	return errors.ErrUnsupported
+}
+
+// unlockFile fails, as files cannot be locked on this platform.
+func unlockFile(f *os.File) error {
+	return errors.ErrUnsupported
+}
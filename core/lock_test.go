@@ -0,0 +1,265 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLockHelperProcess is not a real test: it is run by other tests as a separate
+// process, which locks the file named by FFS_LOCK_FILE and holds the lock until its
+// standard input is closed, or increments the counter in that file FFS_LOCK_COUNT times.
+func TestLockHelperProcess(t *testing.T) {
+	path := os.Getenv("FFS_LOCK_FILE")
+	if path == "" {
+		t.Skip("only run as a helper process")
+	}
+	if count := os.Getenv("FFS_LOCK_COUNT"); count != "" {
+		n, _ := strconv.Atoi(count)
+		for i := 0; i < n; i++ {
+			if err := incrementCounter(path); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}
+	lock, err := LockFile(context.Background(), path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println("locked")
+	bufio.NewReader(os.Stdin).ReadString('\n')
+	lock.Unlock()
+	os.Exit(0)
+}
+
+// incrementCounter increments the number in the file at path under a lock.
+func incrementCounter(path string) error {
+	lock, err := LockFile(context.Background(), path)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	data, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, []byte(strconv.Itoa(n+1)))
+}
+
+// skipUnlessLockable skips the test if path cannot be locked on this platform.
+func skipUnlessLockable(t *testing.T, path string) {
+	t.Helper()
+	lock, err := TryLockFile(path)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("file locking is not supported on this platform")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+}
+
+// lockHelper starts a helper process with the given environment.
+func lockHelper(t *testing.T, env ...string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+func TestLockFile_AcrossProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.txt")
+	if err := os.WriteFile(path, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	skipUnlessLockable(t, path)
+
+	helper := lockHelper(t, "FFS_LOCK_FILE="+path)
+	stdin, err := helper.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := helper.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := helper.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer helper.Wait()
+	defer stdin.Close()
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+		t.Fatalf("helper process did not lock the file: %q, %v", line, err)
+	}
+
+	if _, err := TryLockFile(path); !errors.Is(err, ErrLocked) {
+		t.Errorf("TryLockFile on a locked file: got %v, want ErrLocked", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := LockFile(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("LockFile with a deadline: got %v, want DeadlineExceeded", err)
+	}
+	err = WriteFileWithOptions(path, []byte("1"), WriteOptions{Lock: true, LockTimeout: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("locked write: got %v, want DeadlineExceeded", err)
+	}
+
+	// Once the helper releases the lock, waiting lockers get it.
+	done := make(chan error, 1)
+	go func() {
+		done <- ApplyPatch(FileEditRequest{
+			FilePath: path,
+			Edits:    []EditInstruction{{Action: "replace", LineNumber: 1, NewContent: "patched"}},
+			Lock:     true,
+		}, false, false, false)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	stdin.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("locked ApplyPatch failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("locked ApplyPatch did not get the lock")
+	}
+	if content, _ := os.ReadFile(path); string(content) != "patched" {
+		t.Errorf("content after ApplyPatch = %q, want %q", content, "patched")
+	}
+}
+
+func TestLockFile_Counter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter.txt")
+	if err := os.WriteFile(path, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	skipUnlessLockable(t, path)
+
+	const processes, goroutines, increments = 3, 3, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, processes+goroutines)
+	for i := 0; i < processes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- lockHelper(t, "FFS_LOCK_FILE="+path, "FFS_LOCK_COUNT="+strconv.Itoa(increments)).Run()
+		}()
+	}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				if err := incrementCounter(path); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if content, _ := os.ReadFile(path); string(content) != strconv.Itoa((processes+goroutines)*increments) {
+		t.Errorf("counter = %s, want %d", content, (processes+goroutines)*increments)
+	}
+}
+
+func TestFileLock_Unlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	lock, err := TryLockFile(path)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("file locking is not supported on this platform")
+	}
+	if err != nil {
+		t.Fatalf("TryLockFile failed: %v", err)
+	}
+	if lock.Path() != path {
+		t.Errorf("Path = %q, want %q", lock.Path(), path)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if err := lock.Unlock(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("second Unlock: got %v, want ErrClosed", err)
+	}
+	again, err := TryLockFile(path)
+	if err != nil {
+		t.Fatalf("locking an unlocked file failed: %v", err)
+	}
+	again.Unlock()
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 || entries[0].Name() != ".file.txt.ffs-lock" {
+		t.Errorf("unexpected sidecar files: %v, %v", entries, err)
+	}
+
+	if _, err := NewFS(NewMemoryBackend()).TryLockFile("/file.txt"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("locking a memory backend: got %v, want ErrUnsupported", err)
+	}
+	if _, err := NewFS(NewReadOnlyBackend(OSBackend{})).TryLockFile(path); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("locking a read-only backend: got %v, want ErrReadOnly", err)
+	}
+}
+
+func TestLockFile_Policy(t *testing.T) {
+	dir := t.TempDir()
+	newFS := func(rules ...PolicyRule) *FS {
+		backend, err := NewPolicyBackend(OSBackend{}, Policy{Root: dir, Rules: rules})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewFS(backend)
+	}
+	path := filepath.Join(dir, "new.txt")
+
+	// A file that does not exist yet is locked to be created.
+	createOnly := newFS(PolicyRule{Effect: PolicyDeny, Operations: []string{PolicyWrite}, Paths: []string{"*.txt"}})
+	lock, err := createOnly.TryLockFile(path)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("file locking is not supported on this platform")
+	}
+	if err != nil {
+		t.Fatalf("locking a new file under a create-only policy failed: %v", err)
+	}
+	lock.Unlock()
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var policyErr *PolicyError
+	if _, err := createOnly.TryLockFile(path); !errors.As(err, &policyErr) {
+		t.Errorf("locking an existing file without write access: got %v, want a PolicyError", err)
+	}
+
+	// The sidecar file is checked too.
+	noSidecars := newFS(PolicyRule{Effect: PolicyDeny, Paths: []string{"*.ffs-lock"}})
+	if _, err := noSidecars.TryLockFile(filepath.Join(dir, "other.txt")); !errors.As(err, &policyErr) {
+		t.Errorf("locking with a denied sidecar file: got %v, want a PolicyError", err)
+	}
+	if _, err := os.Stat(lockPath(filepath.Join(dir, "other.txt"))); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a denied sidecar file was created: %v", err)
+	}
+}
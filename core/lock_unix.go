@@ -0,0 +1,30 @@
+//go:build unix && !aix && !zos
+
+package core
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tryLock takes an exclusive flock on f without waiting, failing with ErrLocked if it is
+// held through another open file.
+func tryLock(f *os.File) error {
+	err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err == unix.EWOULDBLOCK {
+		return ErrLocked
+	}
+	if err != nil {
+		return os.NewSyscallError("flock", err)
+	}
+	return nil
+}
+
+// unlockFile releases the flock on f.
+func unlockFile(f *os.File) error {
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_UN); err != nil {
+		return os.NewSyscallError("flock", err)
+	}
+	return nil
+}
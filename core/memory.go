@@ -0,0 +1,402 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryBackend is a WritableBackend that keeps files and directories in memory. Paths are
+// interpreted relative to its root, so "/a/b", "a/b" and "./a/b" all name the same file.
+// It has no symbolic links. A MemoryBackend is safe for concurrent use.
+type MemoryBackend struct {
+	mu   sync.RWMutex
+	root *memoryNode
+	now  func() time.Time
+}
+
+// memoryNode is a file or directory of a MemoryBackend.
+type memoryNode struct {
+	name     string
+	mode     fs.FileMode
+	modTime  time.Time
+	data     []byte
+	children map[string]*memoryNode // nil for files
+}
+
+// NewMemoryBackend returns an empty MemoryBackend containing only its root directory.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		root: &memoryNode{name: "/", mode: fs.ModeDir | 0755, modTime: time.Now(), children: map[string]*memoryNode{}},
+		now:  time.Now,
+	}
+}
+
+// memoryPath splits a path into its components below the root.
+func memoryPath(name string) []string {
+	cleaned := path.Clean("/" + filepath.ToSlash(name))
+	if cleaned == "/" {
+		return nil
+	}
+	return strings.Split(cleaned[1:], "/")
+}
+
+// lookup returns the node at name, or an *fs.PathError wrapping fs.ErrNotExist.
+func (m *MemoryBackend) lookup(op, name string) (*memoryNode, error) {
+	node := m.root
+	for _, part := range memoryPath(name) {
+		if node.children == nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+		}
+		child, ok := node.children[part]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// parent returns the directory containing name and the base name of name.
+func (m *MemoryBackend) parent(op, name string) (*memoryNode, string, error) {
+	parts := memoryPath(name)
+	if len(parts) == 0 {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	dir, err := m.lookup(op, strings.Join(parts[:len(parts)-1], "/"))
+	if err != nil {
+		return nil, "", err
+	}
+	if dir.children == nil {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+	}
+	return dir, parts[len(parts)-1], nil
+}
+
+// Open opens a file or directory for reading. The returned file reads a snapshot of the
+// content at the time it was opened.
+func (m *MemoryBackend) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file := &memoryFile{info: node.info()}
+	if node.children == nil {
+		file.reader = bytes.NewReader(node.data)
+	} else {
+		file.entries = node.entries()
+	}
+	return file, nil
+}
+
+// Stat returns the file info of a path.
+func (m *MemoryBackend) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(), nil
+}
+
+// Lstat returns the file info of a path, like Stat.
+func (m *MemoryBackend) Lstat(name string) (fs.FileInfo, error) {
+	return m.Stat(name)
+}
+
+// ReadDir returns the entries of a directory sorted by name.
+func (m *MemoryBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, err := m.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if node.children == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return node.entries(), nil
+}
+
+// ReadFile returns a copy of the content of a file.
+func (m *MemoryBackend) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, err := m.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if node.children != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	return bytes.Clone(node.data), nil
+}
+
+// ReadLink always fails, as a MemoryBackend has no symbolic links.
+func (m *MemoryBackend) ReadLink(name string) (string, error) {
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+}
+
+// WriteFile replaces the content of a file, keeping its mode, or creates it with perm.
+// The parent directory must exist.
+func (m *MemoryBackend) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, err := m.parent("write", name)
+	if err != nil {
+		return err
+	}
+	node, ok := dir.children[base]
+	if ok && node.children != nil {
+		return &fs.PathError{Op: "write", Path: name, Err: errors.New("is a directory")}
+	}
+	if !ok {
+		node = &memoryNode{name: base, mode: perm.Perm()}
+		dir.children[base] = node
+		dir.modTime = m.now()
+	}
+	node.data = bytes.Clone(data)
+	node.modTime = m.now()
+	return nil
+}
+
+// MkdirAll creates a directory along with any missing parents.
+func (m *MemoryBackend) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node := m.root
+	for _, part := range memoryPath(name) {
+		child, ok := node.children[part]
+		if !ok {
+			child = &memoryNode{name: part, mode: fs.ModeDir | perm.Perm(), modTime: m.now(), children: map[string]*memoryNode{}}
+			node.children[part] = child
+			node.modTime = m.now()
+		} else if child.children == nil {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}
+		}
+		node = child
+	}
+	return nil
+}
+
+// Remove removes a file or an empty directory.
+func (m *MemoryBackend) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, err := m.parent("remove", name)
+	if err != nil {
+		return err
+	}
+	node, ok := dir.children[base]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if len(node.children) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+	}
+	delete(dir.children, base)
+	dir.modTime = m.now()
+	return nil
+}
+
+// RemoveAll removes a path and everything below it, succeeding if it does not exist.
+// Removing the root empties it.
+func (m *MemoryBackend) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(memoryPath(name)) == 0 {
+		m.root.children = map[string]*memoryNode{}
+		return nil
+	}
+	dir, base, err := m.parent("removeall", name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := dir.children[base]; ok {
+		delete(dir.children, base)
+		dir.modTime = m.now()
+	}
+	return nil
+}
+
+// Rename moves a file or directory, replacing any file or empty directory at newname.
+func (m *MemoryBackend) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldDir, oldBase, err := m.parent("rename", oldname)
+	if err != nil {
+		return err
+	}
+	node, ok := oldDir.children[oldBase]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	newDir, newBase, err := m.parent("rename", newname)
+	if err != nil {
+		return err
+	}
+	if node.children != nil {
+		for dir := newDir; ; {
+			if dir == node {
+				return &fs.PathError{Op: "rename", Path: newname, Err: errors.New("cannot move a directory into itself")}
+			}
+			parent := m.parentOf(dir)
+			if parent == nil {
+				break
+			}
+			dir = parent
+		}
+	}
+	if existing, ok := newDir.children[newBase]; ok && existing != node {
+		if (existing.children == nil) != (node.children == nil) || len(existing.children) > 0 {
+			return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrExist}
+		}
+	}
+	delete(oldDir.children, oldBase)
+	node.name = newBase
+	newDir.children[newBase] = node
+	oldDir.modTime, newDir.modTime = m.now(), m.now()
+	return nil
+}
+
+// parentOf returns the directory containing target, or nil for the root.
+func (m *MemoryBackend) parentOf(target *memoryNode) *memoryNode {
+	var find func(dir *memoryNode) *memoryNode
+	find = func(dir *memoryNode) *memoryNode {
+		for _, child := range dir.children {
+			if child == target {
+				return dir
+			}
+			if child.children != nil {
+				if found := find(child); found != nil {
+					return found
+				}
+			}
+		}
+		return nil
+	}
+	return find(m.root)
+}
+
+// Chmod changes the permission bits of a file or directory.
+func (m *MemoryBackend) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.lookup("chmod", name)
+	if err != nil {
+		return err
+	}
+	node.mode = node.mode.Type() | mode.Perm()
+	return nil
+}
+
+// Chtimes changes the modification time of a file or directory.
+func (m *MemoryBackend) Chtimes(name string, modTime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+	node.modTime = modTime
+	return nil
+}
+
+// info returns a snapshot of the file info of a node.
+func (n *memoryNode) info() memoryFileInfo {
+	return memoryFileInfo{name: n.name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// entries returns the directory entries of a node sorted by name.
+func (n *memoryNode) entries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, name := range sortedKeys(n.children) {
+		entries = append(entries, fs.FileInfoToDirEntry(n.children[name].info()))
+	}
+	return entries
+}
+
+// memoryFileInfo is the fs.FileInfo of a MemoryBackend entry.
+type memoryFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i memoryFileInfo) Name() string       { return i.name }
+func (i memoryFileInfo) Size() int64        { return i.size }
+func (i memoryFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i memoryFileInfo) ModTime() time.Time { return i.modTime }
+func (i memoryFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memoryFileInfo) Sys() any           { return nil }
+
+// memoryFile is an open file or directory of a MemoryBackend, or a directory listing
+// assembled by another backend.
+type memoryFile struct {
+	info    fs.FileInfo
+	reader  *bytes.Reader // nil for directories
+	entries []fs.DirEntry
+	offset  int // entries already returned by ReadDir
+}
+
+func (f *memoryFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *memoryFile) Read(p []byte) (int, error) {
+	if f.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.info.Name(), Err: errors.New("is a directory")}
+	}
+	return f.reader.Read(p)
+}
+
+func (f *memoryFile) ReadAt(p []byte, offset int64) (int, error) {
+	if f.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.info.Name(), Err: errors.New("is a directory")}
+	}
+	return f.reader.ReadAt(p, offset)
+}
+
+func (f *memoryFile) Seek(offset int64, whence int) (int64, error) {
+	if f.reader == nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.Name(), Err: errors.New("is a directory")}
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (f *memoryFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.reader != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: f.info.Name(), Err: errors.New("not a directory")}
+	}
+	remaining := f.entries[f.offset:]
+	if n <= 0 {
+		f.offset = len(f.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(remaining))
+	f.offset += n
+	return remaining[:n], nil
+}
+
+func (f *memoryFile) Close() error {
+	return nil
+}
+
+var _ WritableBackend = (*MemoryBackend)(nil)
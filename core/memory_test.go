@@ -0,0 +1,121 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	m := NewMemoryBackend()
+	if err := m.MkdirAll("/src/pkg", 0750); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := m.WriteFile("src/pkg/a.go", []byte("package pkg\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// Paths are resolved against the root however they are written.
+	data, err := m.ReadFile("./src/../src/pkg/a.go")
+	if err != nil || string(data) != "package pkg\n" {
+		t.Fatalf("ReadFile = %q, %v", data, err)
+	}
+
+	// Modes are kept across writes.
+	info, err := m.Stat("/src/pkg/a.go")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode() != 0600 || info.Size() != 12 || info.IsDir() {
+		t.Errorf("unexpected file info: mode %v, size %d", info.Mode(), info.Size())
+	}
+	if err := m.Chmod("/src/pkg/a.go", 0644); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	if err := m.WriteFile("/src/pkg/a.go", []byte("package pkg\n\nvar x int\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if info, _ := m.Stat("/src/pkg/a.go"); info.Mode() != 0644 {
+		t.Errorf("mode after rewrite = %v, want 0644", info.Mode())
+	}
+	if info, _ := m.Stat("/src/pkg"); info.Mode() != fs.ModeDir|0750 {
+		t.Errorf("directory mode = %v, want %v", info.Mode(), fs.ModeDir|0750)
+	}
+
+	// Writes update the modification time.
+	past := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := m.Chtimes("/src/pkg/a.go", past); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	if info, _ := m.Stat("/src/pkg/a.go"); !info.ModTime().Equal(past) {
+		t.Errorf("mod time = %v, want %v", info.ModTime(), past)
+	}
+	m.WriteFile("/src/pkg/a.go", []byte("package pkg\n"), 0)
+	if info, _ := m.Stat("/src/pkg/a.go"); !info.ModTime().After(past) {
+		t.Errorf("mod time was not updated by a write: %v", info.ModTime())
+	}
+
+	// Writing needs an existing parent directory.
+	if err := m.WriteFile("/missing/a.go", nil, 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("WriteFile into a missing directory: got %v, want ErrNotExist", err)
+	}
+	if err := m.MkdirAll("/src/pkg/a.go/b", 0755); err == nil {
+		t.Error("MkdirAll through a file should have failed")
+	}
+
+	// Remove only removes empty directories, RemoveAll removes everything.
+	if err := m.Remove("/src"); err == nil {
+		t.Error("Remove of a non-empty directory should have failed")
+	}
+	if err := m.Rename("/src", "/src/pkg/moved"); err == nil {
+		t.Error("moving a directory into itself should have failed")
+	}
+	if err := m.Rename("/src/pkg", "/pkg"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, err := m.Stat("/pkg/a.go"); err != nil {
+		t.Errorf("renamed file is missing: %v", err)
+	}
+	if err := m.RemoveAll("/pkg"); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	if err := m.RemoveAll("/pkg"); err != nil {
+		t.Errorf("RemoveAll of a missing path failed: %v", err)
+	}
+	if entries, _ := m.ReadDir("/"); len(entries) != 1 || entries[0].Name() != "src" {
+		t.Errorf("unexpected root entries: %v", entries)
+	}
+}
+
+func TestBuildDirTree_MemoryBackend(t *testing.T) {
+	m := NewMemoryBackend()
+	m.MkdirAll("/project/cmd", 0755)
+	m.MkdirAll("/project/node_modules/dep", 0755)
+	m.WriteFile("/project/cmd/main.go", []byte("package main\n\nfunc main() {}\n"), 0644)
+	m.WriteFile("/project/logo.bin", []byte{0x89, 0x00, 0x01}, 0644)
+	m.WriteFile("/project/node_modules/dep/index.js", []byte("module.exports = {}\n"), 0644)
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m.Chtimes("/project/cmd/main.go", modTime)
+
+	tree, err := NewFS(m).BuildDirTree("/project", TreeOptions{
+		Exclude:  []string{"node_modules"},
+		Metadata: MetadataOptions{ModTime: true, Mode: true, Language: true, LineCount: true},
+	})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	if len(tree.Children) != 2 || tree.Size != 32 {
+		t.Fatalf("unexpected tree: %d children, size %d", len(tree.Children), tree.Size)
+	}
+	if logo, ok := findNode(tree, "logo.bin"); !ok || !logo.IsBinary {
+		t.Errorf("logo.bin was not detected as binary: %+v", logo)
+	}
+	main, ok := findNode(tree, "cmd/main.go")
+	if !ok {
+		t.Fatal("cmd/main.go is missing from the tree")
+	}
+	if main.IsBinary || main.Language != "Go" || main.Lines != 3 || main.Mode != 0644 || !main.ModTime.Equal(modTime) {
+		t.Errorf("unexpected metadata: %+v", main)
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// MetadataOptions selects the optional metadata filled in on tree nodes. Everything is off
+// by default; ModTime, Mode and Owner come from the file info the tree is built from,
+// MIMEType reads at most the first 512 bytes of a file, and LineCount and Hash read it
+// entirely.
+type MetadataOptions struct {
+	ModTime   bool `json:"mod_time,omitempty"`   // last modification time
+	Mode      bool `json:"mode,omitempty"`       // permission bits and file type
+	Owner     bool `json:"owner,omitempty"`      // owning user name, or uid when it cannot be resolved
+	MIMEType  bool `json:"mime_type,omitempty"`  // MIME type from the extension, sniffed from content otherwise
+	Language  bool `json:"language,omitempty"`   // programming language from the file name
+	LineCount bool `json:"line_count,omitempty"` // number of lines of text files
+	Hash      bool `json:"hash,omitempty"`       // hex-encoded SHA-256 of the content
+}
+
+// languages maps lowercase file extensions to programming languages.
+var languages = map[string]string{
+	".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++", ".cxx": "C++", ".hpp": "C++",
+	".cs": "C#", ".css": "CSS", ".dart": "Dart", ".ex": "Elixir", ".exs": "Elixir",
+	".erl": "Erlang", ".go": "Go", ".graphql": "GraphQL", ".hs": "Haskell", ".html": "HTML",
+	".htm": "HTML", ".java": "Java", ".js": "JavaScript", ".mjs": "JavaScript",
+	".cjs": "JavaScript", ".jsx": "JavaScript", ".json": "JSON", ".kt": "Kotlin",
+	".kts": "Kotlin", ".lua": "Lua", ".md": "Markdown", ".m": "Objective-C", ".php": "PHP",
+	".pl": "Perl", ".proto": "Protocol Buffers", ".py": "Python", ".r": "R", ".rb": "Ruby",
+	".rs": "Rust", ".scala": "Scala", ".scss": "SCSS", ".sh": "Shell", ".bash": "Shell",
+	".zsh": "Shell", ".sql": "SQL", ".svelte": "Svelte", ".swift": "Swift", ".toml": "TOML",
+	".ts": "TypeScript", ".tsx": "TypeScript", ".vue": "Vue", ".xml": "XML", ".yaml": "YAML",
+	".yml": "YAML", ".zig": "Zig",
+}
+
+// languageFiles maps well-known file names without a telling extension to languages.
+var languageFiles = map[string]string{
+	"Dockerfile": "Dockerfile", "Makefile": "Makefile", "GNUmakefile": "Makefile",
+	"CMakeLists.txt": "CMake", "Gemfile": "Ruby", "Rakefile": "Ruby", "go.mod": "Go Module",
+}
+
+// detectLanguage returns the programming language of a file from its name, or "" when it
+// is not recognized.
+func detectLanguage(name string) string {
+	if language, ok := languageFiles[name]; ok {
+		return language
+	}
+	return languages[strings.ToLower(filepath.Ext(name))]
+}
+
+// detectMIMEType returns the MIME type registered for the extension of path, falling back
+// to sniffing the start of its content.
+func detectMIMEType(backend Backend, path string) (string, error) {
+	if mimeType := mime.TypeByExtension(filepath.Ext(path)); mimeType != "" {
+		return mimeType, nil
+	}
+	header, err := readBytes(backend, path, 0, 512)
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(header), nil
+}
+
+// countLines returns the number of lines in content, counting a final line without a
+// trailing newline.
+func countLines(content []byte) int {
+	lines := bytes.Count(content, []byte("\n"))
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
+
+// fillMetadata sets the metadata requested by options on the node for path. info
+// describes path, or the target of path when it is a followed link. Content-based fields
+// are only computed for files, and line counts only for text files.
+func fillMetadata(backend Backend, node *DirectoryTree, info fs.FileInfo, options MetadataOptions) error {
+	if options.ModTime {
+		node.ModTime = info.ModTime()
+	}
+	if options.Mode {
+		node.Mode = info.Mode()
+	}
+	if options.Owner {
+		node.Owner = fileOwner(info)
+	}
+	if !node.IsFile {
+		return nil
+	}
+	if options.Language {
+		node.Language = detectLanguage(node.Name)
+	}
+	if options.MIMEType {
+		mimeType, err := detectMIMEType(backend, node.Path)
+		if err != nil {
+			return err
+		}
+		node.MIMEType = mimeType
+	}
+	if options.LineCount || options.Hash {
+		content, err := backend.ReadFile(node.Path)
+		if err != nil {
+			return err
+		}
+		if options.LineCount && !bytes.Contains(content[:min(len(content), 1024)], []byte{0}) {
+			node.Lines = countLines(content)
+		}
+		if options.Hash {
+			sum := sha256.Sum256(content)
+			node.Hash = hex.EncodeToString(sum[:])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildDirTree_Metadata(t *testing.T) {
+	root := t.TempDir()
+	files := map[string][]byte{
+		"main.go":   []byte("package main\n\nfunc main() {}\n"),
+		"notes":     []byte("no trailing newline"),
+		"image.png": {0x89, 'P', 'N', 'G', 0, 0},
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), content, 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(root, "main.go"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := BuildDirTree(root, TreeOptions{})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	for _, child := range plain.Children {
+		if !child.ModTime.IsZero() || child.Mode != 0 || child.Hash != "" || child.Lines != 0 || child.MIMEType != "" {
+			t.Errorf("Metadata should be left unset unless requested, got %+v", child)
+		}
+	}
+	if minified, _ := GetTreeMinifiedJSON(plain); strings.Contains(minified, "mod_time") {
+		t.Errorf("Unset metadata should be omitted from JSON, got %s", minified)
+	}
+
+	tree, err := BuildDirTree(root, TreeOptions{Metadata: MetadataOptions{
+		ModTime: true, Mode: true, Owner: true, MIMEType: true, Language: true, LineCount: true, Hash: true,
+	}})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	nodes := make(map[string]DirectoryTree)
+	for _, child := range tree.Children {
+		nodes[child.Name] = child
+	}
+
+	main := nodes["main.go"]
+	if !main.ModTime.Equal(modTime) {
+		t.Errorf("Expected mod time %v, got %v", modTime, main.ModTime)
+	}
+	if main.Mode.Perm() != 0640 {
+		t.Errorf("Expected mode 0640, got %v", main.Mode)
+	}
+	if main.Language != "Go" || main.Lines != 3 {
+		t.Errorf("Expected a 3-line Go file, got language %q and %d lines", main.Language, main.Lines)
+	}
+	if main.Hash != "55a60bb97151b2b4b680462447ce60ec34511b14fa10d77440c97b9777101566" {
+		t.Errorf("Expected a SHA-256 hash, got %q", main.Hash)
+	}
+	if tree.Owner == "" || !tree.Mode.IsDir() {
+		t.Errorf("Directories should carry owner and mode, got %q and %v", tree.Owner, tree.Mode)
+	}
+	if tree.Hash != "" || tree.Lines != 0 {
+		t.Error("Directories should not have content metadata")
+	}
+
+	if notes := nodes["notes"]; notes.Lines != 1 || notes.MIMEType != "text/plain; charset=utf-8" || notes.Language != "" {
+		t.Errorf("Unexpected metadata for an extensionless text file: %+v", notes)
+	}
+	if image := nodes["image.png"]; image.Lines != 0 || image.MIMEType != "image/png" {
+		t.Errorf("Unexpected metadata for a binary file: %+v", image)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]string{
+		"main.go":    "Go",
+		"App.TSX":    "TypeScript",
+		"Dockerfile": "Dockerfile",
+		"README":     "",
+	}
+	for name, expected := range tests {
+		if language := detectLanguage(name); language != expected {
+			t.Errorf("detectLanguage(%q) = %q, want %q", name, language, expected)
+		}
+	}
+}
@@ -0,0 +1,732 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of change reported by OverlayBackend.Changes.
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+)
+
+// OverlayChange is a path that differs between the merged view of an overlay and its
+// lower layer.
+type OverlayChange struct {
+	Kind  string `json:"kind"`
+	Path  string `json:"path"`
+	IsDir bool   `json:"is_dir"`
+}
+
+// OverlayBackend is a copy-on-write WritableBackend. Reads see the upper layer merged over
+// the lower one, while every modification goes to the upper layer, leaving the lower layer
+// untouched until Commit. Deleting an entry of the lower layer records a whiteout that
+// hides it. A directory that is deleted and created again hides everything the lower
+// layer has below it.
+//
+// Paths are made absolute before use, so both layers must accept absolute paths. Links in
+// the lower layer are read through: renaming a directory copies the files its links point
+// to. An OverlayBackend is safe for concurrent use.
+type OverlayBackend struct {
+	mu        sync.RWMutex
+	lower     Backend
+	upper     WritableBackend
+	whiteouts map[string]bool
+}
+
+// NewOverlayBackend returns an overlay of upper over lower. upper should start out empty,
+// and may be a MemoryBackend or a DirBackend on a scratch directory.
+func NewOverlayBackend(lower Backend, upper WritableBackend) *OverlayBackend {
+	return &OverlayBackend{lower: lower, upper: upper, whiteouts: make(map[string]bool)}
+}
+
+// overlayPath returns the absolute, cleaned form of name used as the key of both layers.
+func overlayPath(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return filepath.Clean(name)
+}
+
+// hidden reports whether the lower layer's entry at path is hidden by a whiteout on it
+// or on one of its parents.
+func (o *OverlayBackend) hidden(path string) bool {
+	for {
+		if o.whiteouts[path] {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// inUpper reports whether the upper layer has an entry at path.
+func (o *OverlayBackend) inUpper(path string) bool {
+	_, err := o.upper.Lstat(path)
+	return err == nil
+}
+
+// stat returns the merged file info of path, using the lower layer's stat or lstat.
+func (o *OverlayBackend) stat(op, path string, follow bool) (fs.FileInfo, error) {
+	upperStat, lowerStat := o.upper.Lstat, o.lower.Lstat
+	if follow {
+		upperStat, lowerStat = o.upper.Stat, o.lower.Stat
+	}
+	if info, err := upperStat(path); err == nil {
+		return info, nil
+	}
+	if o.hidden(path) {
+		return nil, &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+	}
+	return lowerStat(path)
+}
+
+// Stat returns the merged file info of a path, following links.
+func (o *OverlayBackend) Stat(name string) (fs.FileInfo, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.stat("stat", overlayPath(name), true)
+}
+
+// Lstat returns the merged file info of a path without following a final link.
+func (o *OverlayBackend) Lstat(name string) (fs.FileInfo, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.stat("lstat", overlayPath(name), false)
+}
+
+// readDir returns the merged entries of the directory at path sorted by name.
+func (o *OverlayBackend) readDir(path string) ([]fs.DirEntry, error) {
+	info, err := o.stat("readdir", path, true)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: path, Err: errors.New("not a directory")}
+	}
+
+	merged := make(map[string]fs.DirEntry)
+	if !o.hidden(path) {
+		if entries, err := o.lower.ReadDir(path); err == nil {
+			for _, entry := range entries {
+				if !o.whiteouts[filepath.Join(path, entry.Name())] {
+					merged[entry.Name()] = entry
+				}
+			}
+		} else if !o.inUpper(path) {
+			return nil, err
+		}
+	}
+	if entries, err := o.upper.ReadDir(path); err == nil {
+		for _, entry := range entries {
+			merged[entry.Name()] = entry
+		}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, name := range sortedKeys(merged) {
+		entries = append(entries, merged[name])
+	}
+	return entries, nil
+}
+
+// ReadDir returns the merged entries of a directory sorted by name.
+func (o *OverlayBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.readDir(overlayPath(name))
+}
+
+// Open opens a file of the upper layer, or of the lower layer when it is not shadowed.
+// Directories are opened as their merged listing.
+func (o *OverlayBackend) Open(name string) (fs.File, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	path := overlayPath(name)
+	info, err := o.stat("open", path, true)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, err := o.readDir(path)
+		if err != nil {
+			return nil, err
+		}
+		return &memoryFile{info: info, entries: entries}, nil
+	}
+	if o.inUpper(path) {
+		return o.upper.Open(path)
+	}
+	return o.lower.Open(path)
+}
+
+// ReadFile returns the content of a file from the upper layer, or from the lower layer
+// when it is not shadowed.
+func (o *OverlayBackend) ReadFile(name string) ([]byte, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.readFile(overlayPath(name))
+}
+
+func (o *OverlayBackend) readFile(path string) ([]byte, error) {
+	if o.inUpper(path) {
+		return o.upper.ReadFile(path)
+	}
+	if o.hidden(path) {
+		return nil, &fs.PathError{Op: "read", Path: path, Err: fs.ErrNotExist}
+	}
+	return o.lower.ReadFile(path)
+}
+
+// ReadLink returns the target of a symbolic link of the merged view.
+func (o *OverlayBackend) ReadLink(name string) (string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	path := overlayPath(name)
+	if o.inUpper(path) {
+		return o.upper.ReadLink(path)
+	}
+	if o.hidden(path) {
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrNotExist}
+	}
+	return o.lower.ReadLink(path)
+}
+
+// copyUpDir makes sure the upper layer has the directory at path, which must be a
+// directory of the merged view.
+func (o *OverlayBackend) copyUpDir(op, path string) error {
+	info, err := o.stat(op, path, true)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: op, Path: path, Err: errors.New("not a directory")}
+	}
+	if o.inUpper(path) {
+		return nil
+	}
+	if parent := filepath.Dir(path); parent != path {
+		if err := o.copyUpDir(op, parent); err != nil {
+			return err
+		}
+	}
+	// The mode is set again as creating the directory applies the umask.
+	if err := o.upper.MkdirAll(path, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return o.upper.Chmod(path, info.Mode().Perm())
+}
+
+// WriteFile writes a file to the upper layer, keeping the mode of a file it shadows.
+func (o *OverlayBackend) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.writeFile(overlayPath(name), data, perm)
+}
+
+func (o *OverlayBackend) writeFile(path string, data []byte, perm fs.FileMode) error {
+	if err := o.copyUpDir("write", filepath.Dir(path)); err != nil {
+		return err
+	}
+	if info, err := o.stat("write", path, true); err == nil {
+		if info.IsDir() {
+			return &fs.PathError{Op: "write", Path: path, Err: errors.New("is a directory")}
+		}
+		perm = info.Mode().Perm()
+	}
+	return o.upper.WriteFile(path, data, perm)
+}
+
+// MkdirAll creates a directory and any missing parents in the upper layer.
+func (o *OverlayBackend) MkdirAll(name string, perm fs.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.mkdirAll(overlayPath(name), perm)
+}
+
+func (o *OverlayBackend) mkdirAll(path string, perm fs.FileMode) error {
+	if info, err := o.stat("mkdir", path, true); err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: errors.New("not a directory")}
+		}
+		return o.copyUpDir("mkdir", path)
+	}
+	if parent := filepath.Dir(path); parent != path {
+		if err := o.mkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	return o.upper.MkdirAll(path, perm)
+}
+
+// whiteout hides the lower layer's entry at path, if it has a visible one.
+func (o *OverlayBackend) whiteout(path string) {
+	if o.hidden(path) {
+		return
+	}
+	if _, err := o.lower.Lstat(path); err == nil {
+		o.whiteouts[path] = true
+	}
+}
+
+// Remove removes a file or an empty directory from the merged view.
+func (o *OverlayBackend) Remove(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	path := overlayPath(name)
+	info, err := o.stat("remove", path, false)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := o.readDir(path)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: path, Err: errors.New("directory not empty")}
+		}
+	}
+	if err := o.upper.RemoveAll(path); err != nil {
+		return err
+	}
+	o.whiteout(path)
+	return nil
+}
+
+// RemoveAll removes a path and everything below it from the merged view.
+func (o *OverlayBackend) RemoveAll(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.removeAll(overlayPath(name))
+}
+
+func (o *OverlayBackend) removeAll(path string) error {
+	if err := o.upper.RemoveAll(path); err != nil {
+		return err
+	}
+	o.whiteout(path)
+	return nil
+}
+
+// Rename moves a file or directory by copying it to newname in the upper layer and
+// removing oldname.
+func (o *OverlayBackend) Rename(oldname, newname string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	oldPath, newPath := overlayPath(oldname), overlayPath(newname)
+	info, err := o.stat("rename", oldPath, false)
+	if err != nil {
+		return err
+	}
+	if oldPath == newPath {
+		return nil
+	}
+	if info.IsDir() && isWithin(newPath, oldPath) {
+		return &fs.PathError{Op: "rename", Path: newPath, Err: errors.New("cannot move a directory into itself")}
+	}
+	if existing, err := o.stat("rename", newPath, false); err == nil {
+		if existing.IsDir() != info.IsDir() {
+			return &fs.PathError{Op: "rename", Path: newPath, Err: fs.ErrExist}
+		}
+		if existing.IsDir() {
+			if entries, _ := o.readDir(newPath); len(entries) > 0 {
+				return &fs.PathError{Op: "rename", Path: newPath, Err: errors.New("directory not empty")}
+			}
+		}
+		if err := o.removeAll(newPath); err != nil {
+			return err
+		}
+	}
+	if err := o.copyUpDir("rename", filepath.Dir(newPath)); err != nil {
+		return err
+	}
+	if err := o.copyTree(oldPath, newPath, info); err != nil {
+		return err
+	}
+	return o.removeAll(oldPath)
+}
+
+// Chmod changes the mode of a file or directory, copying it up to the upper layer first.
+func (o *OverlayBackend) Chmod(name string, mode fs.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	path := overlayPath(name)
+	if err := o.copyUp("chmod", path); err != nil {
+		return err
+	}
+	return o.upper.Chmod(path, mode)
+}
+
+// Chtimes changes the modification time of a file or directory, copying it up to the
+// upper layer first.
+func (o *OverlayBackend) Chtimes(name string, modTime time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	path := overlayPath(name)
+	if err := o.copyUp("chtimes", path); err != nil {
+		return err
+	}
+	return o.upper.Chtimes(path, modTime)
+}
+
+// copyUp copies the merged entry at path to the upper layer, unless it is already there.
+// Directories are copied without their entries.
+func (o *OverlayBackend) copyUp(op, path string) error {
+	info, err := o.stat(op, path, true)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return o.copyUpDir(op, path)
+	}
+	if o.inUpper(path) {
+		return nil
+	}
+	if err := o.copyUpDir(op, filepath.Dir(path)); err != nil {
+		return err
+	}
+	data, err := o.readFile(path)
+	if err != nil {
+		return err
+	}
+	return o.upper.WriteFile(path, data, info.Mode().Perm())
+}
+
+// copyTree copies the merged entry at src, described by info, to dst in the upper layer.
+func (o *OverlayBackend) copyTree(src, dst string, info fs.FileInfo) error {
+	if !info.IsDir() {
+		data, err := o.readFile(src)
+		if err != nil {
+			return err
+		}
+		return o.upper.WriteFile(dst, data, info.Mode().Perm())
+	}
+	if err := o.upper.MkdirAll(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	entries, err := o.readDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		child := filepath.Join(src, entry.Name())
+		childInfo, err := o.stat("rename", child, true)
+		if err != nil {
+			return err
+		}
+		if err := o.copyTree(child, filepath.Join(dst, entry.Name()), childInfo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isWithin reports whether path is dir or below it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// overlayRoot returns the filesystem root both layers are walked from.
+func overlayRoot() string {
+	return filepath.VolumeName(overlayPath(".")) + string(filepath.Separator)
+}
+
+// touched returns every path the overlay may have changed: everything in the upper
+// layer and everything below a whiteout in the lower layer.
+func (o *OverlayBackend) touched() map[string]bool {
+	paths := make(map[string]bool)
+	var walk func(backend Backend, path string)
+	walk = func(backend Backend, path string) {
+		paths[path] = true
+		info, err := backend.Lstat(path)
+		if err != nil || !info.IsDir() {
+			return
+		}
+		entries, err := backend.ReadDir(path)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			walk(backend, filepath.Join(path, entry.Name()))
+		}
+	}
+	walk(o.upper, overlayRoot())
+	for path := range o.whiteouts {
+		walk(o.lower, path)
+	}
+	return paths
+}
+
+// Changes lists the paths whose merged view differs from the lower layer, sorted by path.
+// Files count as modified when their content or mode differs, and directories when their
+// mode does.
+func (o *OverlayBackend) Changes() ([]OverlayChange, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.changes()
+}
+
+func (o *OverlayBackend) changes() ([]OverlayChange, error) {
+	var changes []OverlayChange
+	for _, path := range sortedKeys(o.touched()) {
+		lowerInfo, lowerErr := o.lower.Lstat(path)
+		mergedInfo, mergedErr := o.stat("lstat", path, false)
+		switch {
+		case lowerErr != nil && mergedErr != nil:
+		case lowerErr != nil:
+			changes = append(changes, OverlayChange{Kind: ChangeAdded, Path: path, IsDir: mergedInfo.IsDir()})
+		case mergedErr != nil:
+			changes = append(changes, OverlayChange{Kind: ChangeDeleted, Path: path, IsDir: lowerInfo.IsDir()})
+		case lowerInfo.IsDir() != mergedInfo.IsDir():
+			changes = append(changes, OverlayChange{Kind: ChangeModified, Path: path, IsDir: mergedInfo.IsDir()})
+		case mergedInfo.IsDir() && o.inUpper(path):
+			if lowerInfo.Mode().Perm() != mergedInfo.Mode().Perm() {
+				changes = append(changes, OverlayChange{Kind: ChangeModified, Path: path, IsDir: true})
+			}
+		case !mergedInfo.IsDir() && o.inUpper(path):
+			before, err := o.lower.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			after, err := o.upper.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(before, after) || lowerInfo.Mode() != mergedInfo.Mode() {
+				changes = append(changes, OverlayChange{Kind: ChangeModified, Path: path})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// Diff renders the changes to files as unified diffs, in path order. Added and deleted
+// files are diffed against /dev/null, and binary files are only named. Changes of the
+// modes of files and directories are noted on lines of their own.
+func (o *OverlayBackend) Diff() (string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	changes, err := o.changes()
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	for _, change := range changes {
+		if change.Kind == ChangeModified {
+			lowerInfo, lowerErr := o.lower.Lstat(change.Path)
+			mergedInfo, mergedErr := o.stat("lstat", change.Path, false)
+			if lowerErr == nil && mergedErr == nil && lowerInfo.IsDir() == mergedInfo.IsDir() &&
+				lowerInfo.Mode() != mergedInfo.Mode() {
+				fmt.Fprintf(&out, "Mode of %s changed from %v to %v\n", change.Path, lowerInfo.Mode(), mergedInfo.Mode())
+			}
+		}
+		if change.IsDir {
+			continue
+		}
+		oldName, newName := diffName("a", change.Path), diffName("b", change.Path)
+		var before, after []byte
+		if change.Kind == ChangeAdded {
+			oldName = "/dev/null"
+		} else if info, err := o.lower.Stat(change.Path); err == nil && !info.IsDir() {
+			if before, err = o.lower.ReadFile(change.Path); err != nil {
+				return "", err
+			}
+		}
+		if change.Kind == ChangeDeleted {
+			newName = "/dev/null"
+		} else if after, err = o.readFile(change.Path); err != nil {
+			return "", err
+		}
+		if bytes.IndexByte(before, 0) >= 0 || bytes.IndexByte(after, 0) >= 0 {
+			fmt.Fprintf(&out, "Binary files %s and %s differ\n", oldName, newName)
+			continue
+		}
+		out.WriteString(unifiedDiff(oldName, newName, before, after))
+	}
+	return out.String(), nil
+}
+
+// Commit applies the changes of the overlay to the lower layer, which must be writable,
+// and then discards them. A failed commit may leave the lower layer partly updated; the
+// overlay keeps its changes so the commit can be retried.
+func (o *OverlayBackend) Commit() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	lower, ok := o.lower.(WritableBackend)
+	if !ok {
+		return &fs.PathError{Op: "commit", Path: overlayRoot(), Err: ErrReadOnly}
+	}
+	changes, err := o.changes()
+	if err != nil {
+		return err
+	}
+
+	// Deletions go first so that replaced entries make room for their successors.
+	for _, change := range changes {
+		replaced := false
+		if change.Kind == ChangeModified && change.IsDir {
+			info, err := lower.Lstat(change.Path)
+			replaced = err == nil && !info.IsDir()
+		}
+		if change.Kind == ChangeDeleted || replaced {
+			if err := lower.RemoveAll(change.Path); err != nil {
+				return err
+			}
+		}
+	}
+	var dirs []string
+	for _, change := range changes {
+		if change.Kind == ChangeDeleted {
+			continue
+		}
+		info, err := o.upper.Lstat(change.Path)
+		if err != nil {
+			return err
+		}
+		if change.IsDir {
+			err = lower.MkdirAll(change.Path, info.Mode().Perm())
+			dirs = append(dirs, change.Path)
+		} else {
+			if change.Kind == ChangeModified {
+				if lowerInfo, err := lower.Lstat(change.Path); err == nil && lowerInfo.IsDir() {
+					if err := lower.RemoveAll(change.Path); err != nil {
+						return err
+					}
+				}
+			}
+			var data []byte
+			if data, err = o.upper.ReadFile(change.Path); err == nil {
+				err = lower.WriteFile(change.Path, data, info.Mode().Perm())
+			}
+			if err == nil {
+				err = lower.Chmod(change.Path, info.Mode().Perm())
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// The modes of directories are set last, deepest first, as they may not allow their
+	// entries to be added.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := o.upper.Lstat(dirs[i])
+		if err != nil {
+			return err
+		}
+		if err := lower.Chmod(dirs[i], info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return o.discard()
+}
+
+// Discard drops every change of the overlay, restoring the view of the lower layer.
+func (o *OverlayBackend) Discard() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.discard()
+}
+
+func (o *OverlayBackend) discard() error {
+	root := overlayRoot()
+	entries, err := o.upper.ReadDir(root)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, entry := range entries {
+		if err := o.upper.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			return err
+		}
+	}
+	o.whiteouts = make(map[string]bool)
+	return nil
+}
+
+// NewDirBackend returns a WritableBackend that stores every path it is given below dir on
+// the operating system's filesystem, so /src/main.go is kept at dir/src/main.go. It lets a
+// scratch directory serve as the upper layer of an OverlayBackend.
+func NewDirBackend(dir string) WritableBackend {
+	return dirBackend{dir: dir}
+}
+
+// dirBackend nests all paths below a directory.
+type dirBackend struct {
+	dir string
+}
+
+// path returns where name is stored on disk.
+func (d dirBackend) path(name string) string {
+	return filepath.Join(d.dir, filepath.Join(string(filepath.Separator), name))
+}
+
+func (d dirBackend) Open(name string) (fs.File, error) {
+	return os.Open(d.path(name))
+}
+
+func (d dirBackend) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(d.path(name))
+}
+
+func (d dirBackend) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(d.path(name))
+}
+
+func (d dirBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(d.path(name))
+}
+
+func (d dirBackend) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(d.path(name))
+}
+
+func (d dirBackend) ReadLink(name string) (string, error) {
+	return os.Readlink(d.path(name))
+}
+
+func (d dirBackend) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return OSBackend{}.WriteFile(d.path(name), data, perm)
+}
+
+func (d dirBackend) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(d.path(name), perm)
+}
+
+func (d dirBackend) Remove(name string) error {
+	return os.Remove(d.path(name))
+}
+
+func (d dirBackend) RemoveAll(name string) error {
+	return os.RemoveAll(d.path(name))
+}
+
+func (d dirBackend) Rename(oldname, newname string) error {
+	return os.Rename(d.path(oldname), d.path(newname))
+}
+
+func (d dirBackend) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(d.path(name), mode)
+}
+
+func (d dirBackend) Chtimes(name string, modTime time.Time) error {
+	return os.Chtimes(d.path(name), time.Time{}, modTime)
+}
+
+var (
+	_ WritableBackend = (*OverlayBackend)(nil)
+	_ WritableBackend = dirBackend{}
+)
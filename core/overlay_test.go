@@ -0,0 +1,298 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// createOverlayLower creates the lower layer used by the overlay tests.
+func createOverlayLower(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		"main.go":         "package main\n\nfunc main() {\n\trun()\n}\n",
+		"run.go":          "package main\n\nfunc run() {}\n",
+		"docs/guide.md":   "# guide\n",
+		"docs/intro.md":   "# intro\n",
+		"scripts/build":   "#!/bin/sh\ngo build\n",
+		"assets/logo.bin": "\x89PNG\x00",
+	} {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(dir, "scripts/build"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestOverlayBackend(t *testing.T) {
+	for name, upper := range map[string]func(t *testing.T) WritableBackend{
+		"memory": func(t *testing.T) WritableBackend { return NewMemoryBackend() },
+		"dir":    func(t *testing.T) WritableBackend { return NewDirBackend(t.TempDir()) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			testOverlayBackend(t, upper(t))
+		})
+	}
+}
+
+func testOverlayBackend(t *testing.T, upper WritableBackend) {
+	dir := createOverlayLower(t)
+	overlay := NewOverlayBackend(OSBackend{}, upper)
+	fsys := NewFS(overlay)
+	join := func(path string) string { return filepath.Join(dir, path) }
+
+	// Modify, add, delete and replace entries.
+	if err := fsys.ApplyPatch(FileEditRequest{
+		FilePath: join("main.go"),
+		Edits:    []EditInstruction{{Action: "replace", LineNumber: 4, NewContent: "\trun()\n\tcleanup()"}},
+	}, false, false, false); err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	if err := fsys.WriteFile(join("scripts/build"), []byte("#!/bin/sh\ngo build ./...\n")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := fsys.CreateDir(join("internal/util")); err != nil {
+		t.Fatalf("CreateDir failed: %v", err)
+	}
+	if err := fsys.WriteFile(join("internal/util/cleanup.go"), []byte("package util\n")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := fsys.DeleteFile(join("run.go")); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	if err := fsys.DeleteDir(join("docs")); err != nil {
+		t.Fatalf("DeleteDir failed: %v", err)
+	}
+	if err := fsys.CreateDir(join("docs")); err != nil {
+		t.Fatalf("CreateDir failed: %v", err)
+	}
+	if err := fsys.WriteFile(join("docs/guide.md"), []byte("# new guide\n")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := overlay.Rename(join("assets"), join("static")); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if err := fsys.WriteFile(join("missing/file.go"), nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("writing into a missing directory: got %v, want ErrNotExist", err)
+	}
+
+	// The lower layer is untouched.
+	if data, _ := os.ReadFile(join("main.go")); string(data) != "package main\n\nfunc main() {\n\trun()\n}\n" {
+		t.Errorf("lower layer was modified: %q", data)
+	}
+	if _, err := os.Stat(join("run.go")); err != nil {
+		t.Errorf("lower layer lost run.go: %v", err)
+	}
+
+	// Reads, trees and searches see the merged view.
+	if _, err := fsys.ReadFile(join("run.go")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("reading a deleted file: got %v, want ErrNotExist", err)
+	}
+	if info, err := overlay.Stat(join("scripts/build")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("rewritten file lost its mode: %v, %v", info, err)
+	}
+	tree, err := fsys.BuildDirTree(dir, TreeOptions{})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	var names []string
+	for _, child := range tree.Children {
+		names = append(names, child.Name)
+	}
+	if want := []string{"docs", "internal", "main.go", "scripts", "static"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("unexpected merged entries: got %v, want %v", names, want)
+	}
+	if docs, _ := findNode(tree, "docs"); len(docs.Children) != 1 {
+		t.Errorf("recreated directory shows lower entries: %+v", docs.Children)
+	}
+	if logo, ok := findNode(tree, "static/logo.bin"); !ok || !logo.IsBinary {
+		t.Errorf("renamed binary file is missing: %+v", logo)
+	}
+	results, err := fsys.SearchFiles(dir, "cleanup", SearchOptions{})
+	if err != nil || len(results) != 1 || results[0].FilePath != join("main.go") {
+		t.Errorf("SearchFiles = %+v, %v", results, err)
+	}
+
+	changes, err := overlay.Changes()
+	if err != nil {
+		t.Fatalf("Changes failed: %v", err)
+	}
+	want := []OverlayChange{
+		{Kind: ChangeDeleted, Path: join("assets"), IsDir: true},
+		{Kind: ChangeDeleted, Path: join("assets/logo.bin")},
+		{Kind: ChangeModified, Path: join("docs/guide.md")},
+		{Kind: ChangeDeleted, Path: join("docs/intro.md")},
+		{Kind: ChangeAdded, Path: join("internal"), IsDir: true},
+		{Kind: ChangeAdded, Path: join("internal/util"), IsDir: true},
+		{Kind: ChangeAdded, Path: join("internal/util/cleanup.go")},
+		{Kind: ChangeModified, Path: join("main.go")},
+		{Kind: ChangeDeleted, Path: join("run.go")},
+		{Kind: ChangeModified, Path: join("scripts/build")},
+		{Kind: ChangeAdded, Path: join("static"), IsDir: true},
+		{Kind: ChangeAdded, Path: join("static/logo.bin")},
+	}
+	// A memory upper layer applies no umask, so the recreated docs directory may differ in
+	// mode from the one it replaces.
+	lowerDocs, err := os.Stat(join("docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := overlay.Stat(join("docs")); err == nil && info.Mode().Perm() != lowerDocs.Mode().Perm() {
+		want = append(want[:2], append([]OverlayChange{{Kind: ChangeModified, Path: join("docs"), IsDir: true}}, want[2:]...)...)
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("unexpected changes:\n got %+v\nwant %+v", changes, want)
+	}
+
+	diff, err := overlay.Diff()
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	for _, expected := range []string{
+		"--- a" + filepath.ToSlash(join("main.go")) + "\n+++ b" + filepath.ToSlash(join("main.go")) + "\n" +
+			"@@ -2,4 +2,5 @@\n \n func main() {\n \trun()\n+\tcleanup()\n }\n",
+		"--- a" + filepath.ToSlash(join("run.go")) + "\n+++ /dev/null\n@@ -1,3 +0,0 @@\n",
+		"--- /dev/null\n+++ b" + filepath.ToSlash(join("internal/util/cleanup.go")) + "\n@@ -0,0 +1,1 @@\n+package util\n",
+		"Binary files a" + filepath.ToSlash(join("assets/logo.bin")) + " and /dev/null differ\n",
+	} {
+		if !strings.Contains(diff, expected) {
+			t.Errorf("diff is missing %q:\n%s", expected, diff)
+		}
+	}
+
+	// Commit writes the merged view to the lower layer and empties the overlay.
+	if err := overlay.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if changes, _ := overlay.Changes(); len(changes) != 0 {
+		t.Errorf("changes left after commit: %+v", changes)
+	}
+	committed, err := buildDirectoryTree(OSBackend{}, dir, TreeOptions{Metadata: MetadataOptions{Hash: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := fsys.BuildDirTree(dir, TreeOptions{Metadata: MetadataOptions{Hash: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := DiffTrees(committed, tree); len(diff.Added)+len(diff.Removed)+len(diff.Modified)+len(diff.Renamed) != 0 {
+		t.Errorf("committed tree differs from the merged view: %+v", diff)
+	}
+	if diff := DiffTrees(committed, merged); len(diff.Added)+len(diff.Removed)+len(diff.Modified)+len(diff.Renamed) != 0 {
+		t.Errorf("overlay differs from the committed tree: %+v", diff)
+	}
+	if info, _ := os.Stat(join("scripts/build")); info.Mode().Perm() != 0755 {
+		t.Errorf("committed file lost its mode: %v", info.Mode())
+	}
+
+	// Discard drops changes without touching the lower layer.
+	fsys.WriteFile(join("main.go"), []byte("scratch"))
+	fsys.DeleteDir(join("docs"))
+	if err := overlay.Discard(); err != nil {
+		t.Fatalf("Discard failed: %v", err)
+	}
+	if data, _ := fsys.ReadFile(join("main.go")); string(data) == "scratch" {
+		t.Error("Discard kept a modified file")
+	}
+	if _, err := fsys.ReadFile(join("docs/guide.md")); err != nil {
+		t.Errorf("Discard kept a deletion: %v", err)
+	}
+}
+
+func TestOverlayBackend_ReadOnlyLower(t *testing.T) {
+	overlay := NewOverlayBackend(FromFS(os.DirFS(createOverlayLower(t))), NewMemoryBackend())
+	if err := overlay.WriteFile("/main.go", []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := overlay.Commit(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("committing to a read-only lower layer: got %v, want ErrReadOnly", err)
+	}
+}
+
+func TestOverlayBackend_Chmod(t *testing.T) {
+	dir := createOverlayLower(t)
+	overlay := NewOverlayBackend(OSBackend{}, NewMemoryBackend())
+	path := filepath.Join(dir, "run.go")
+	if err := overlay.Chmod(path, 0600); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0644 {
+		t.Errorf("Chmod changed the lower layer: %v", info.Mode().Perm())
+	}
+	if info, err := overlay.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("overlay mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+	changes, err := overlay.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Path != path || changes[0].Kind != ChangeModified {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	if err := overlay.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode after Commit = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Directories keep their entries when their mode changes.
+	docs := filepath.Join(dir, "docs")
+	if err := overlay.Chmod(docs, 0700); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	changes, err = overlay.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0] != (OverlayChange{Kind: ChangeModified, Path: docs, IsDir: true}) {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	if diff, err := overlay.Diff(); err != nil || !strings.Contains(diff, "Mode of "+docs+" changed") {
+		t.Errorf("Diff does not note the mode change: %q, %v", diff, err)
+	}
+	if err := overlay.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if info, _ := os.Stat(docs); info.Mode().Perm() != 0700 {
+		t.Errorf("directory mode after Commit = %v, want 0700", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(docs, "intro.md")); err != nil {
+		t.Errorf("committing a directory's mode lost its entries: %v", err)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"separate hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "1\nx\n3\n4\n5\n6\n7\n8\n9\ny\n",
+			"--- a\n+++ b\n@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+y\n"},
+		{"merged hunks", "1\n2\n3\n4\n5\n", "x\n2\n3\n4\ny\n",
+			"--- a\n+++ b\n@@ -1,5 +1,5 @@\n-1\n+x\n 2\n 3\n 4\n-5\n+y\n"},
+		{"missing newline", "a\nb", "a\nb\n",
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("a", "b", []byte(tt.old), []byte(tt.new)); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
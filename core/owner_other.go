@@ -0,0 +1,21 @@
+//go:build !unix
+
+package core
+
+import (
+	"io/fs"
+	"os"
+)
+
+// fileOwner returns "", as file ownership is not available on this platform.
+func fileOwner(info fs.FileInfo) string {
+	return ""
+}
+
+// copyOwner does nothing, as file ownership is not available on this platform.
+func copyOwner(f *os.File, info fs.FileInfo) {}
+
+// syncDir does nothing, as directories cannot be flushed on this platform.
+func syncDir(path string) error {
+	return nil
+}
@@ -0,0 +1,53 @@
+//go:build unix
+
+package core
+
+import (
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// owners caches user names by uid, since trees usually hold many files of few owners.
+var owners sync.Map
+
+// fileOwner returns the name of the user owning the file described by info, or its uid
+// when the name cannot be resolved.
+func fileOwner(info fs.FileInfo) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	uid := strconv.FormatUint(uint64(stat.Uid), 10)
+	if name, ok := owners.Load(uid); ok {
+		return name.(string)
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	owners.Store(uid, name)
+	return name
+}
+
+// copyOwner gives f the owner and group of the file described by info, when the process
+// is allowed to.
+func copyOwner(f *os.File, info fs.FileInfo) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		f.Chown(int(stat.Uid), int(stat.Gid))
+	}
+}
+
+// syncDir flushes the entries of a directory to disk, so that a rename in it survives a
+// crash.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,60 @@
+//go:build unix
+
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFile_KeepsOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing owners requires root")
+	}
+	path := filepath.Join(t.TempDir(), "owned.txt")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(path, 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("new")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	if stat.Uid != 1234 || stat.Gid != 5678 {
+		t.Errorf("owner after WriteFile = %d:%d, want 1234:5678", stat.Uid, stat.Gid)
+	}
+}
+
+func TestWriteFile_Umask(t *testing.T) {
+	defer syscall.Umask(syscall.Umask(027))
+	dir := t.TempDir()
+	root, err := NewRootBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	for name, backend := range map[string]WritableBackend{"os.txt": OSBackend{}, "root.txt": root} {
+		path := name
+		if backend == (OSBackend{}) {
+			path = filepath.Join(dir, name)
+		}
+		if err := backend.WriteFile(path, []byte("new"), 0666); err != nil {
+			t.Fatalf("WriteFile(%q) failed: %v", path, err)
+		}
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("%s was created with mode %v, want 0640", name, info.Mode().Perm())
+		}
+	}
+}
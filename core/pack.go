@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// truncationMarker is appended to content that was cut to fit a token budget.
+const truncationMarker = "... (truncated)"
+
+// ContextItem is a piece of context to pack: a whole file, a line range of a file, or
+// content supplied directly such as a search hit.
+type ContextItem struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line,omitempty"` // 1-based, inclusive; 0 means from the start
+	EndLine   int    `json:"end_line,omitempty"`   // 1-based, inclusive; 0 means to the end
+	Content   string `json:"content,omitempty"`    // read from Path when empty
+	Priority  int    `json:"priority"`             // higher priorities are packed first
+}
+
+// PackedItem is a ContextItem that made it into the packed context.
+type PackedItem struct {
+	ContextItem
+	Tokens    int  `json:"tokens"`
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// PackResult is the outcome of packing context items under a token budget.
+type PackResult struct {
+	Items       []PackedItem  `json:"items"`
+	TotalTokens int           `json:"total_tokens"`
+	Skipped     []ContextItem `json:"skipped,omitempty"`
+}
+
+// ContextPacker packs context items into a token budget in priority order.
+type ContextPacker struct {
+	Tokenizer Tokenizer // defaults to ApproxTokenizer
+	Backend   Backend   // where items are read from; defaults to the OS filesystem
+	Budget    int       // maximum total number of tokens
+	// MinTruncatedTokens is the smallest number of tokens worth keeping when an item has
+	// to be truncated; items that would be cut below it are skipped instead.
+	MinTruncatedTokens int
+}
+
+// Pack loads the content of each item and packs as many items as fit under the budget,
+// highest priority first. Items keep their relative order within a priority. An item
+// that does not fit entirely is truncated on a line boundary when enough budget is left,
+// and smaller lower-priority items may still fill the remaining space.
+func (p *ContextPacker) Pack(items []ContextItem) (PackResult, error) {
+	if p.Budget <= 0 {
+		return PackResult{}, fmt.Errorf("invalid token budget %d", p.Budget)
+	}
+	tokenizer := p.Tokenizer
+	if tokenizer == nil {
+		tokenizer = ApproxTokenizer{}
+	}
+	backend := p.Backend
+	if backend == nil {
+		backend = defaultBackend
+	}
+
+	ordered := make([]ContextItem, len(items))
+	copy(ordered, items)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority > ordered[j].Priority
+	})
+
+	var result PackResult
+	for _, item := range ordered {
+		if err := loadContextItem(backend, &item); err != nil {
+			return PackResult{}, err
+		}
+
+		remaining := p.Budget - result.TotalTokens
+		tokens := tokenizer.CountTokens(item.Content)
+		if tokens <= remaining {
+			result.Items = append(result.Items, PackedItem{ContextItem: item, Tokens: tokens})
+			result.TotalTokens += tokens
+			continue
+		}
+
+		// The truncated item never has more tokens than remain, so skip truncating when
+		// fewer remain than the minimum.
+		if remaining >= max(1, p.MinTruncatedTokens) {
+			if packed, ok := truncateContextItem(item, remaining, tokenizer); ok && packed.Tokens >= p.MinTruncatedTokens {
+				result.Items = append(result.Items, packed)
+				result.TotalTokens += packed.Tokens
+				continue
+			}
+		}
+		result.Skipped = append(result.Skipped, item)
+	}
+	return result, nil
+}
+
+// loadContextItem fills in the content of an item from its file when it has none.
+func loadContextItem(backend Backend, item *ContextItem) error {
+	if item.Content != "" {
+		return nil
+	}
+	if item.StartLine <= 0 && item.EndLine <= 0 {
+		content, err := readFile(backend, item.Path)
+		if err != nil {
+			return fmt.Errorf("could not read context item %s: %w", item.Path, err)
+		}
+		item.Content = string(content)
+		return nil
+	}
+
+	start := max(1, item.StartLine)
+	lines, err := readLines(backend, item.Path, start, item.EndLine)
+	if err != nil {
+		return fmt.Errorf("could not read context item %s: %w", item.Path, err)
+	}
+	item.StartLine = start
+	item.EndLine = start + len(lines) - 1
+	item.Content = strings.Join(lines, "\n")
+	return nil
+}
+
+// truncateContextItem keeps the longest run of leading lines that fits in budget
+// together with the truncation marker.
+func truncateContextItem(item ContextItem, budget int, tokenizer Tokenizer) (PackedItem, bool) {
+	lines := strings.Split(item.Content, "\n")
+	render := func(n int) string {
+		return strings.Join(append(append([]string{}, lines[:n]...), truncationMarker), "\n")
+	}
+
+	// Binary search for the largest number of lines that fits.
+	low, high := 0, len(lines)-1
+	for low < high {
+		mid := (low + high + 1) / 2
+		if tokenizer.CountTokens(render(mid)) <= budget {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	if low == 0 {
+		return PackedItem{}, false
+	}
+
+	item.Content = render(low)
+	if item.StartLine > 0 || item.EndLine > 0 {
+		item.EndLine = max(1, item.StartLine) + low - 1
+	} else {
+		item.StartLine, item.EndLine = 1, low
+	}
+	return PackedItem{ContextItem: item, Tokens: tokenizer.CountTokens(item.Content), Truncated: true}, true
+}
+
+// searchContextItems turns search results into context items covering each hit and
+// contextLines lines around it.
+func searchContextItems(results []SearchResult, contextLines, priority int) []ContextItem {
+	items := make([]ContextItem, 0, len(results))
+	for _, result := range results {
+		items = append(items, ContextItem{
+			Path:      result.FilePath,
+			StartLine: max(1, result.LineNumber-contextLines),
+			EndLine:   result.LineNumber + contextLines,
+			Priority:  priority,
+		})
+	}
+	return items
+}
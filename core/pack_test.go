@@ -0,0 +1,94 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContextPacker(t *testing.T) {
+	tmpDir := t.TempDir()
+	small := filepath.Join(tmpDir, "small.txt")
+	large := filepath.Join(tmpDir, "large.txt")
+	os.WriteFile(small, []byte("12345678"), 0644)                      // 2 tokens
+	os.WriteFile(large, []byte(strings.Repeat("abcdefg\n", 20)), 0644) // 40 tokens
+
+	packer := &ContextPacker{Budget: 20}
+	result, err := packer.Pack([]ContextItem{
+		{Path: large, Priority: 1},
+		{Path: small, Priority: 5},
+		{Content: "inline", Priority: 0},
+	})
+	if err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+
+	if len(result.Items) != 2 || len(result.Skipped) != 1 {
+		t.Fatalf("Expected 2 packed and 1 skipped item, got %d and %d", len(result.Items), len(result.Skipped))
+	}
+	if result.Items[0].Path != small || result.Items[0].Truncated {
+		t.Errorf("Expected the high priority item first and untouched, got %+v", result.Items[0])
+	}
+	truncated := result.Items[1]
+	if !truncated.Truncated || !strings.HasSuffix(truncated.Content, truncationMarker) {
+		t.Errorf("Expected the large item to be truncated, got %+v", truncated)
+	}
+	if truncated.StartLine != 1 || truncated.EndLine < 1 || truncated.EndLine >= 20 {
+		t.Errorf("Unexpected line range for truncated item: %d-%d", truncated.StartLine, truncated.EndLine)
+	}
+	if result.TotalTokens > packer.Budget {
+		t.Errorf("Packed %d tokens over a budget of %d", result.TotalTokens, packer.Budget)
+	}
+
+	if _, err = (&ContextPacker{}).Pack(nil); err == nil {
+		t.Error("Expected an error for a zero budget")
+	}
+	if _, err = packer.Pack([]ContextItem{{Path: "non-existent-file"}}); err == nil {
+		t.Error("Expected an error for an unreadable item")
+	}
+}
+
+func TestContextPacker_MinTruncatedTokens(t *testing.T) {
+	// Only the first line fits, which truncates the item to far fewer tokens than remain.
+	content := "a\n" + strings.Repeat("x", 200) + "\n"
+	packer := &ContextPacker{Budget: 20, MinTruncatedTokens: 10}
+	result, err := packer.Pack([]ContextItem{{Content: content}})
+	if err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+	if len(result.Items) != 0 || len(result.Skipped) != 1 {
+		t.Errorf("Expected the item cut below the minimum to be skipped, got %+v", result)
+	}
+
+	packer.MinTruncatedTokens = 1
+	if result, err = packer.Pack([]ContextItem{{Content: content}}); err != nil || len(result.Items) != 1 || !result.Items[0].Truncated {
+		t.Errorf("Expected the item to be truncated, got %+v, %v", result, err)
+	}
+}
+
+func TestContextPacker_SearchHits(t *testing.T) {
+	tempDir := setupSearchTest(t)
+	results, err := SearchFiles(tempDir, "test", SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := SearchContextItems(results, 1, 3)
+	if len(items) != len(results) {
+		t.Fatalf("Expected %d items, got %d", len(results), len(items))
+	}
+
+	result, err := (&ContextPacker{Budget: 1000}).Pack(items)
+	if err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+	for _, item := range result.Items {
+		if item.Priority != 3 || item.StartLine < 1 || item.EndLine < item.StartLine {
+			t.Errorf("Unexpected packed search hit: %+v", item)
+		}
+		if !strings.Contains(item.Content, "test") {
+			t.Errorf("Packed search hit lost its match: %q", item.Content)
+		}
+	}
+}
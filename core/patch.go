@@ -6,6 +6,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"time"
 )
 
 // EditInstruction represents a single edit operation
@@ -19,13 +20,18 @@ type EditInstruction struct {
 type FileEditRequest struct {
 	FilePath string            `json:"file_path"`
 	Edits    []EditInstruction `json:"edits"`
+	// Lock holds an exclusive lock on the file from reading it to writing the edits, see
+	// FileLock, waiting up to LockTimeout for other lock holders, or without limit when
+	// it is zero.
+	Lock        bool          `json:"lock,omitempty"`
+	LockTimeout time.Duration `json:"lock_timeout,omitempty"`
 }
 
 // readFileLines reads a file and returns its content as a slice of strings.
-func readFileLines(filePath string) ([]string, error) {
-	content, err := os.ReadFile(filePath)
+func readFileLines(backend Backend, filePath string) ([]string, error) {
+	content, err := backend.ReadFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file %s: %v", filePath, err)
+		return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
 	}
 	return strings.Split(string(content), "\n"), nil
 }
@@ -191,18 +197,29 @@ func applyEdits(lines []string, edits []EditInstruction) ([]string, error) {
 }
 
 // writeFileLines writes a slice of strings to a file, with each string as a new line.
-func writeFileLines(filePath string, lines []string) error {
+func writeFileLines(backend WritableBackend, filePath string, lines []string) error {
 	newContent := strings.Join(lines, "\n")
-	if err := os.WriteFile(filePath, []byte(newContent), 0644); err != nil {
-		return fmt.Errorf("failed to write file %s: %v", filePath, err)
+	if err := writeFile(backend, filePath, []byte(newContent)); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", filePath, err)
 	}
 	return nil
 }
 
 // editFileWorkflow orchestrates the file editing process.
-func editFileWorkflow(request FileEditRequest, verbose, prompt, highlight bool) error {
+func editFileWorkflow(backend WritableBackend, request FileEditRequest, verbose, prompt, highlight bool) error {
+	backend = forOperation(backend, AuditPatch)
+
+	// Lock file
+	if request.Lock {
+		lock, err := lockWithTimeout(backend, request.FilePath, request.LockTimeout)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	}
+
 	// Read file
-	lines, err := readFileLines(request.FilePath)
+	lines, err := readFileLines(backend, request.FilePath)
 	if err != nil {
 		return err
 	}
@@ -235,11 +252,11 @@ func editFileWorkflow(request FileEditRequest, verbose, prompt, highlight bool)
 	// Apply edits
 	updatedLines, err := applyEdits(lines, edits)
 	if err != nil {
-		return fmt.Errorf("failed to apply edits to %s: %v", request.FilePath, err)
+		return fmt.Errorf("failed to apply edits to %s: %w", request.FilePath, err)
 	}
 
 	// Write file
-	if err := writeFileLines(request.FilePath, updatedLines); err != nil {
+	if err := writeFileLines(backend, request.FilePath, updatedLines); err != nil {
 		return err
 	}
 
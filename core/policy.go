@@ -0,0 +1,498 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Operations controlled by a Policy.
+const (
+	PolicyRead   = "read"   // reading file contents
+	PolicyWrite  = "write"  // replacing the contents of an existing file
+	PolicyCreate = "create" // creating files and directories
+	PolicyDelete = "delete" // removing files and directories
+	PolicySearch = "search" // searching files with SearchFiles
+	PolicyTree   = "tree"   // listing entries in directory trees
+)
+
+// Effects of a PolicyRule.
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+// policyOperations lists every operation a rule may name.
+var policyOperations = []string{PolicyRead, PolicyWrite, PolicyCreate, PolicyDelete, PolicySearch, PolicyTree}
+
+// ErrPolicyDenied matches every *PolicyError with errors.Is.
+var ErrPolicyDenied = errors.New("denied by policy")
+
+// PolicyRule allows or denies operations on the paths matching any of its patterns.
+//
+// Patterns use path.Match syntax on slash-separated paths relative to the policy root, and
+// a "**" segment matches any number of directories. Patterns without a slash match any
+// single path component, so "*.lock" matches lock files at every level and "secrets"
+// matches everything below a secrets directory. Patterns with a slash are anchored at the
+// root and also match everything below the directories they match.
+type PolicyRule struct {
+	Effect     string   `json:"effect"`               // PolicyAllow or PolicyDeny
+	Operations []string `json:"operations,omitempty"` // operations the rule applies to; empty means all
+	Paths      []string `json:"paths"`                // glob patterns
+	Reason     string   `json:"reason,omitempty"`     // explanation included in denials
+}
+
+// Policy is a set of allow and deny rules for file operations. A matching deny rule always
+// wins; otherwise an operation is allowed if an allow rule matches, or if the default
+// effect is PolicyAllow.
+type Policy struct {
+	// Root is the directory rule patterns are relative to, and defaults to the working
+	// directory. Paths outside of it only match patterns without a slash.
+	Root string `json:"root,omitempty"`
+	// Default is the effect for operations no rule matches, PolicyAllow unless set.
+	Default string       `json:"default,omitempty"`
+	Rules   []PolicyRule `json:"rules"`
+}
+
+// PolicyError is returned for operations a Policy denies.
+type PolicyError struct {
+	Op   string      // the denied operation
+	Path string      // the path it was denied on
+	Rule *PolicyRule // the deny rule that matched, or nil when denied by default
+}
+
+func (e *PolicyError) Error() string {
+	msg := fmt.Sprintf("policy denies %s of %s", e.Op, e.Path)
+	switch {
+	case e.Rule == nil:
+		return msg + ": not allowed by any rule"
+	case e.Rule.Reason != "":
+		return msg + ": " + e.Rule.Reason
+	default:
+		return msg + ": matches " + strings.Join(e.Rule.Paths, ", ")
+	}
+}
+
+// Is reports whether target is ErrPolicyDenied or fs.ErrPermission.
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrPolicyDenied || target == fs.ErrPermission
+}
+
+// Validate reports the first invalid effect, operation or pattern of the policy.
+func (p Policy) Validate() error {
+	if p.Default != "" && p.Default != PolicyAllow && p.Default != PolicyDeny {
+		return fmt.Errorf("invalid default effect %q", p.Default)
+	}
+	for i, rule := range p.Rules {
+		if rule.Effect != PolicyAllow && rule.Effect != PolicyDeny {
+			return fmt.Errorf("rule %d: invalid effect %q", i, rule.Effect)
+		}
+		for _, op := range rule.Operations {
+			if !slices.Contains(policyOperations, op) {
+				return fmt.Errorf("rule %d: unknown operation %q", i, op)
+			}
+		}
+		if len(rule.Paths) == 0 {
+			return fmt.Errorf("rule %d: no paths", i)
+		}
+		for _, pattern := range rule.Paths {
+			if !validGlob(pattern) {
+				return fmt.Errorf("rule %d: invalid pattern %q", i, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Check returns a *PolicyError if the policy denies op on path, and nil otherwise.
+func (p Policy) Check(op, path string) error {
+	rel, inside := p.relPath(path)
+	allowed := p.Default != PolicyDeny
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if !rule.matches(op, rel, inside) {
+			continue
+		}
+		if rule.Effect == PolicyDeny {
+			return &PolicyError{Op: op, Path: path, Rule: rule}
+		}
+		allowed = true
+	}
+	if !allowed {
+		return &PolicyError{Op: op, Path: path}
+	}
+	return nil
+}
+
+// relPath returns path relative to the policy root in slash form, or the absolute slash
+// path and false when path is outside the root.
+func (p Policy) relPath(name string) (string, bool) {
+	root := p.Root
+	if root == "" {
+		root = "."
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return filepath.ToSlash(name), false
+	}
+	absPath, err := filepath.Abs(name)
+	if err != nil {
+		return filepath.ToSlash(name), false
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(absPath), false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// matches reports whether the rule applies to op on the path rel, which is relative to
+// the policy root when inside is set.
+func (r *PolicyRule) matches(op, rel string, inside bool) bool {
+	if len(r.Operations) > 0 && !slices.Contains(r.Operations, op) {
+		return false
+	}
+	components := strings.Split(strings.Trim(rel, "/"), "/")
+	for _, pattern := range r.Paths {
+		if !strings.Contains(pattern, "/") {
+			for _, component := range components {
+				if matched, _ := path.Match(pattern, component); matched {
+					return true
+				}
+			}
+			continue
+		}
+		if !inside {
+			continue
+		}
+		pattern = strings.Trim(pattern, "/")
+		for i := len(components); i > 0; i-- {
+			if matchGlob(pattern, strings.Join(components[:i], "/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parsePolicy parses a policy in JSON or YAML, selected by format, and validates it.
+// Unknown fields are rejected so that misspelled rules do not silently allow access.
+func parsePolicy(data []byte, format string) (Policy, error) {
+	var policy Policy
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&policy); err != nil {
+			return Policy{}, fmt.Errorf("could not parse policy: %w", err)
+		}
+	case FormatYAML, "yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&policy); err != nil {
+			return Policy{}, fmt.Errorf("could not parse policy: %w", err)
+		}
+	default:
+		return Policy{}, fmt.Errorf("unsupported policy format %q", format)
+	}
+	if err := policy.Validate(); err != nil {
+		return Policy{}, fmt.Errorf("invalid policy: %w", err)
+	}
+	return policy, nil
+}
+
+// loadPolicy reads a policy from a .json, .yaml or .yml file.
+func loadPolicy(backend Backend, path string) (Policy, error) {
+	data, err := readFile(backend, path)
+	if err != nil {
+		return Policy{}, err
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	policy, err := parsePolicy(data, format)
+	if err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// accessChecker is implemented by backends that restrict the search and tree operations,
+// which they cannot observe themselves.
+type accessChecker interface {
+	checkAccess(op, path string) error
+}
+
+// checkAccess returns the error the first backend restricting access to path reports for
+// op, among backend and the backends it wraps.
+func checkAccess(backend Backend, op, path string) error {
+	for _, backend := range wrappedBackends(backend) {
+		if checker, ok := backend.(accessChecker); ok {
+			if err := checker.checkAccess(op, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PolicyBackend enforces a Policy on top of another backend. Denied operations fail with a
+// *PolicyError. Reads, writes, creations and deletions are checked by the backend itself;
+// deleting or renaming a directory requires permission for everything below it. Trees
+// leave out entries denied for PolicyTree and searches skip those denied for
+// PolicySearch. Stat and ReadDir are not restricted. Paths are checked both as given and
+// with their links resolved, so that a link cannot get around a rule for its target.
+type PolicyBackend struct {
+	backend Backend
+	policy  Policy
+}
+
+// NewPolicyBackend returns backend restricted by policy, which must be valid.
+func NewPolicyBackend(backend Backend, policy Policy) (*PolicyBackend, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return &PolicyBackend{backend: backend, policy: policy}, nil
+}
+
+// Policy returns the policy the backend enforces.
+func (p *PolicyBackend) Policy() Policy {
+	return p.policy
+}
+
+func (p *PolicyBackend) checkAccess(op, path string) error {
+	return p.check(op, path)
+}
+
+func (p *PolicyBackend) unwrap() Backend {
+	return p.backend
+}
+
+func (p *PolicyBackend) withOperation(op string, inner Backend) Backend {
+	view := *p
+	view.backend = inner
+	return &view
+}
+
+// check checks op on path and, when links along it lead elsewhere, on the path they
+// resolve to, so that a link cannot get around a rule for its target.
+func (p *PolicyBackend) check(op, path string) error {
+	if err := p.policy.Check(op, path); err != nil {
+		return err
+	}
+	resolved, err := evalSymlinks(p.backend, path)
+	if err != nil || resolved == filepath.Clean(path) {
+		return nil // the operation itself fails on paths that cannot be resolved
+	}
+	return p.policy.Check(op, resolved)
+}
+
+// checkEntry is check for operations on path itself rather than what a final link points
+// to, such as deleting and renaming: only the links of the directories leading to it are
+// resolved.
+func (p *PolicyBackend) checkEntry(op, path string) error {
+	if err := p.policy.Check(op, path); err != nil {
+		return err
+	}
+	dir, err := evalSymlinks(p.backend, filepath.Dir(path))
+	if err != nil || dir == filepath.Dir(path) {
+		return nil
+	}
+	return p.policy.Check(op, filepath.Join(dir, filepath.Base(path)))
+}
+
+// checkTree checks op on path and, for directories, on everything below it. Links are
+// not followed.
+func (p *PolicyBackend) checkTree(op, path string) error {
+	if err := p.checkEntry(op, path); err != nil {
+		return err
+	}
+	info, err := p.backend.Lstat(path)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	entries, err := p.backend.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := p.checkTree(op, filepath.Join(path, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open opens a file for reading.
+func (p *PolicyBackend) Open(name string) (fs.File, error) {
+	if err := p.check(PolicyRead, name); err != nil {
+		return nil, err
+	}
+	return p.backend.Open(name)
+}
+
+// Stat returns the file info of a path, following links.
+func (p *PolicyBackend) Stat(name string) (fs.FileInfo, error) {
+	return p.backend.Stat(name)
+}
+
+// Lstat returns the file info of a path without following a final link.
+func (p *PolicyBackend) Lstat(name string) (fs.FileInfo, error) {
+	return p.backend.Lstat(name)
+}
+
+// ReadDir returns the entries of a directory sorted by name.
+func (p *PolicyBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return p.backend.ReadDir(name)
+}
+
+// ReadFile returns the content of a file.
+func (p *PolicyBackend) ReadFile(name string) ([]byte, error) {
+	if err := p.check(PolicyRead, name); err != nil {
+		return nil, err
+	}
+	return p.backend.ReadFile(name)
+}
+
+// ReadLink returns the target of a symbolic link.
+func (p *PolicyBackend) ReadLink(name string) (string, error) {
+	if err := p.checkEntry(PolicyRead, name); err != nil {
+		return "", err
+	}
+	return p.backend.ReadLink(name)
+}
+
+// WriteFile writes a file, which needs PolicyWrite if it exists and PolicyCreate if not.
+func (p *PolicyBackend) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	backend, err := writableBackend(p.backend, "write", name)
+	if err != nil {
+		return err
+	}
+	op := PolicyCreate
+	if _, err := p.backend.Lstat(name); err == nil {
+		op = PolicyWrite
+	}
+	if err := p.check(op, name); err != nil {
+		return err
+	}
+	return backend.WriteFile(name, data, perm)
+}
+
+// MkdirAll creates a directory along with any missing parents, each of which needs
+// PolicyCreate.
+func (p *PolicyBackend) MkdirAll(name string, perm fs.FileMode) error {
+	backend, err := writableBackend(p.backend, "mkdir", name)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for path := filepath.Clean(name); ; path = filepath.Dir(path) {
+		if _, err := p.backend.Stat(path); err == nil {
+			break
+		}
+		missing = append(missing, path)
+		if filepath.Dir(path) == path {
+			break
+		}
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := p.check(PolicyCreate, missing[i]); err != nil {
+			return err
+		}
+	}
+	return backend.MkdirAll(name, perm)
+}
+
+// Remove removes a file or an empty directory.
+func (p *PolicyBackend) Remove(name string) error {
+	backend, err := writableBackend(p.backend, "remove", name)
+	if err != nil {
+		return err
+	}
+	if err := p.checkEntry(PolicyDelete, name); err != nil {
+		return err
+	}
+	return backend.Remove(name)
+}
+
+// RemoveAll removes a path and everything below it, which all needs PolicyDelete.
+func (p *PolicyBackend) RemoveAll(name string) error {
+	backend, err := writableBackend(p.backend, "remove", name)
+	if err != nil {
+		return err
+	}
+	if err := p.checkTree(PolicyDelete, name); err != nil {
+		return err
+	}
+	return backend.RemoveAll(name)
+}
+
+// Rename moves a file or directory, which needs PolicyDelete for everything it moves and
+// PolicyCreate for where it moves to.
+func (p *PolicyBackend) Rename(oldname, newname string) error {
+	backend, err := writableBackend(p.backend, "rename", oldname)
+	if err != nil {
+		return err
+	}
+	if err := p.checkTree(PolicyDelete, oldname); err != nil {
+		return err
+	}
+	if err := p.checkRenamed(oldname, newname); err != nil {
+		return err
+	}
+	return backend.Rename(oldname, newname)
+}
+
+// Chmod changes the mode of a file or directory, which needs PolicyWrite.
+func (p *PolicyBackend) Chmod(name string, mode fs.FileMode) error {
+	backend, err := writableBackend(p.backend, "chmod", name)
+	if err != nil {
+		return err
+	}
+	if err := p.check(PolicyWrite, name); err != nil {
+		return err
+	}
+	return backend.Chmod(name, mode)
+}
+
+// Chtimes changes the modification time of a file or directory, which needs PolicyWrite.
+func (p *PolicyBackend) Chtimes(name string, modTime time.Time) error {
+	backend, err := writableBackend(p.backend, "chtimes", name)
+	if err != nil {
+		return err
+	}
+	if err := p.check(PolicyWrite, name); err != nil {
+		return err
+	}
+	return backend.Chtimes(name, modTime)
+}
+
+// checkRenamed checks PolicyCreate for the new location of everything below oldname.
+func (p *PolicyBackend) checkRenamed(oldname, newname string) error {
+	if err := p.checkEntry(PolicyCreate, newname); err != nil {
+		return err
+	}
+	info, err := p.backend.Lstat(oldname)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	entries, err := p.backend.ReadDir(oldname)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := p.checkRenamed(filepath.Join(oldname, entry.Name()), filepath.Join(newname, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ WritableBackend = (*PolicyBackend)(nil)
@@ -0,0 +1,312 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPolicyYAML = `
+root: /repo
+rules:
+  - effect: deny
+    operations: [write, create, delete]
+    paths: ["vendor/**"]
+    reason: vendored code is read-only
+  - effect: deny
+    operations: [write]
+    paths: ["*.lock"]
+  - effect: deny
+    operations: [read, search, tree]
+    paths: [".env", "**/secrets/**"]
+    reason: secrets must not leave the machine
+  - effect: deny
+    operations: [delete]
+    paths: ["**"]
+`
+
+// newPolicyTestFS returns an FS over a memory backend restricted by testPolicyYAML.
+func newPolicyTestFS(t *testing.T) (*FS, *MemoryBackend) {
+	t.Helper()
+	memory := NewMemoryBackend()
+	for path, content := range map[string]string{
+		"/repo/main.go":                 "package main // TODO\n",
+		"/repo/go.lock":                 "locked\n",
+		"/repo/.env":                    "TOKEN=TODO\n",
+		"/repo/config/secrets/key.pem":  "TODO\n",
+		"/repo/vendor/lib/lib.go":       "package lib // TODO\n",
+		"/repo/internal/secrets/key.go": "package secrets // TODO\n",
+	} {
+		if err := memory.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := memory.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	policy, err := ParsePolicy([]byte(testPolicyYAML), FormatYAML)
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	backend, err := NewPolicyBackend(memory, policy)
+	if err != nil {
+		t.Fatalf("NewPolicyBackend failed: %v", err)
+	}
+	return NewFS(backend), memory
+}
+
+func TestPolicyBackend_MkdirAllParents(t *testing.T) {
+	// Only out directories may be created, not the directories holding them.
+	backend, err := NewPolicyBackend(NewMemoryBackend(), Policy{Root: "/", Default: PolicyDeny, Rules: []PolicyRule{
+		{Effect: PolicyAllow, Operations: []string{PolicyCreate}, Paths: []string{"build/*/out"}},
+		{Effect: PolicyAllow, Operations: []string{PolicyRead, PolicyWrite}, Paths: []string{"**"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := NewFS(backend)
+	var policyErr *PolicyError
+	if err := fsys.CreateDir("/build/linux/out"); !errors.As(err, &policyErr) || policyErr.Path != "/build" {
+		t.Errorf("creating denied parent directories: got %v, want a *PolicyError for /build", err)
+	}
+	err = fsys.WriteFileWithOptions("/build/linux/out/app", []byte("x"), WriteOptions{CreateDirs: true})
+	if !errors.As(err, &policyErr) {
+		t.Errorf("writing below denied parent directories: got %v, want a *PolicyError", err)
+	}
+	if _, err := backend.Stat("/build"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a denied directory was created: %v", err)
+	}
+}
+
+func TestPolicyBackend(t *testing.T) {
+	fsys, memory := newPolicyTestFS(t)
+
+	denied := func(name string, err error) {
+		t.Helper()
+		var policyErr *PolicyError
+		if !errors.Is(err, ErrPolicyDenied) || !errors.Is(err, fs.ErrPermission) || !errors.As(err, &policyErr) {
+			t.Errorf("%s: got %v, want a *PolicyError", name, err)
+		}
+	}
+	denied("reading .env", func() error { _, err := fsys.ReadFile("/repo/.env"); return err }())
+	denied("reading a nested secret", func() error { _, err := fsys.ReadFile("/repo/config/secrets/key.pem"); return err }())
+	denied("writing a lock file", fsys.WriteFile("/repo/go.lock", []byte("changed\n")))
+	denied("writing to vendor", fsys.WriteFile("/repo/vendor/lib/lib.go", nil))
+	denied("creating in vendor", fsys.WriteFile("/repo/vendor/lib/new.go", nil))
+	denied("creating a vendor directory", fsys.CreateDir("/repo/vendor/other"))
+	denied("deleting a file", fsys.DeleteFile("/repo/main.go"))
+	denied("deleting a directory", fsys.DeleteDir("/repo/internal"))
+	denied("patching a lock file", fsys.ApplyPatch(FileEditRequest{
+		FilePath: "/repo/go.lock",
+		Edits:    []EditInstruction{{Action: "replace", LineNumber: 1, NewContent: "changed"}},
+	}, false, false, false))
+
+	// Denials explain themselves.
+	_, err := fsys.ReadFile("/repo/.env")
+	if want := "policy denies read of /repo/.env: secrets must not leave the machine"; err == nil || err.Error() != want {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	var policyErr *PolicyError
+	if errors.As(fsys.WriteFile("/repo/go.lock", nil), &policyErr) && policyErr.Rule.Paths[0] != "*.lock" {
+		t.Errorf("unexpected matching rule: %+v", policyErr.Rule)
+	}
+
+	// Everything else is allowed, and denied operations changed nothing.
+	if err := fsys.WriteFile("/repo/main.go", []byte("package main\n")); err != nil {
+		t.Errorf("writing main.go: %v", err)
+	}
+	if err := fsys.WriteFile("/repo/new.lock", []byte("new\n")); err != nil {
+		t.Errorf("creating a lock file: %v", err)
+	}
+	if data, err := fsys.ReadFile("/repo/vendor/lib/lib.go"); err != nil || len(data) == 0 {
+		t.Errorf("reading vendored code: %q, %v", data, err)
+	}
+	if data, _ := memory.ReadFile("/repo/go.lock"); string(data) != "locked\n" {
+		t.Errorf("denied write modified go.lock: %q", data)
+	}
+	if _, err := memory.Stat("/repo/internal/secrets/key.go"); err != nil {
+		t.Errorf("denied delete removed files: %v", err)
+	}
+
+	// Trees and searches leave out hidden entries.
+	tree, err := fsys.BuildDirTree("/repo", TreeOptions{})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	for _, hidden := range []string{".env", "config/secrets", "internal/secrets"} {
+		if _, ok := findNode(tree, hidden); ok {
+			t.Errorf("tree shows hidden entry %s", hidden)
+		}
+	}
+	if _, ok := findNode(tree, "vendor/lib/lib.go"); !ok {
+		t.Error("tree is missing vendor/lib/lib.go")
+	}
+	if _, err := fsys.BuildDirTree("/repo/config/secrets", TreeOptions{}); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("tree of a hidden directory: got %v, want ErrPolicyDenied", err)
+	}
+	results, err := fsys.SearchFiles("/repo", "TODO", SearchOptions{})
+	if err != nil {
+		t.Fatalf("SearchFiles failed: %v", err)
+	}
+	var found []string
+	for _, result := range results {
+		found = append(found, result.FilePath)
+	}
+	// main.go was rewritten above, so only vendored code still matches.
+	if want := []string{"/repo/vendor/lib/lib.go"}; !reflect.DeepEqual(found, want) {
+		t.Errorf("SearchFiles found %v, want %v", found, want)
+	}
+	if _, err := fsys.SearchFiles("/repo/.env", "TOKEN", SearchOptions{}); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("searching a hidden file: got %v, want ErrPolicyDenied", err)
+	}
+}
+
+func TestPolicyBackend_Symlinks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "vendor"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".env"), []byte("SECRET=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"cfg": ".env", "v": "vendor", "chain": "cfg"} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	backend, err := NewPolicyBackend(OSBackend{}, Policy{Root: root, Rules: []PolicyRule{
+		{Effect: PolicyDeny, Operations: []string{PolicyRead, PolicySearch}, Paths: []string{".env"}},
+		{Effect: PolicyDeny, Operations: []string{PolicyWrite, PolicyCreate}, Paths: []string{"vendor/**"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := NewFS(backend)
+
+	for _, name := range []string{".env", "cfg", "chain"} {
+		if data, err := fsys.ReadFile(filepath.Join(root, name)); !errors.Is(err, ErrPolicyDenied) {
+			t.Errorf("reading %s: got %q, %v; want ErrPolicyDenied", name, data, err)
+		}
+	}
+	if results, err := fsys.SearchFiles(root, "SECRET", SearchOptions{}); err != nil || len(results) != 0 {
+		t.Errorf("search read the secret through a link: %+v, %v", results, err)
+	}
+	if err := fsys.WriteFile(filepath.Join(root, "v", "x.go"), []byte("package x\n")); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("writing through a link: got %v, want ErrPolicyDenied", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vendor", "x.go")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the write went through: %v", err)
+	}
+	if err := fsys.CreateDir(filepath.Join(root, "v", "pkg")); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("creating a directory through a link: got %v, want ErrPolicyDenied", err)
+	}
+
+	// The links themselves are not what the rules are about.
+	if target, err := backend.ReadLink(filepath.Join(root, "cfg")); err != nil || target != ".env" {
+		t.Errorf("ReadLink = %q, %v", target, err)
+	}
+	if err := fsys.WriteFile(filepath.Join(root, "notes.txt"), []byte("notes\n")); err != nil {
+		t.Errorf("writing an unrestricted file: %v", err)
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	policy := Policy{
+		Root:    "/repo",
+		Default: PolicyDeny,
+		Rules: []PolicyRule{
+			{Effect: PolicyAllow, Paths: []string{"src/**"}},
+			{Effect: PolicyAllow, Operations: []string{PolicyRead}, Paths: []string{"*.md"}},
+			{Effect: PolicyDeny, Paths: []string{"src/gen"}},
+		},
+	}
+	tests := []struct {
+		op, path string
+		allowed  bool
+	}{
+		{PolicyWrite, "/repo/src/main.go", true},
+		{PolicyWrite, "/repo/src", true},
+		{PolicyWrite, "/repo/src/gen/api.go", false},
+		{PolicyRead, "/repo/docs/guide.md", true},
+		{PolicyWrite, "/repo/docs/guide.md", false},
+		{PolicyRead, "/elsewhere/notes.md", true},
+		{PolicyRead, "/elsewhere/src/main.go", false},
+		{PolicyRead, "/repo/Makefile", false},
+	}
+	for _, tt := range tests {
+		err := policy.Check(tt.op, tt.path)
+		if (err == nil) != tt.allowed {
+			t.Errorf("Check(%s, %s) = %v, want allowed %v", tt.op, tt.path, err, tt.allowed)
+		}
+	}
+	var policyErr *PolicyError
+	if errors.As(policy.Check(PolicyRead, "/repo/Makefile"), &policyErr) && policyErr.Rule != nil {
+		t.Errorf("default denial reported rule %+v", policyErr.Rule)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	json := `{"root": "/repo", "rules": [{"effect": "deny", "operations": ["read"], "paths": [".env"]}]}`
+	if err := os.WriteFile(filepath.Join(dir, "policy.json"), []byte(json), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "policy.yml"), []byte(testPolicyYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicy(filepath.Join(dir, "policy.json"))
+	if err != nil {
+		t.Fatalf("LoadPolicy(json) failed: %v", err)
+	}
+	if want := (Policy{Root: "/repo", Rules: []PolicyRule{{Effect: PolicyDeny, Operations: []string{PolicyRead}, Paths: []string{".env"}}}}); !reflect.DeepEqual(policy, want) {
+		t.Errorf("LoadPolicy(json) = %+v, want %+v", policy, want)
+	}
+	policy, err = LoadPolicy(filepath.Join(dir, "policy.yml"))
+	if err != nil {
+		t.Fatalf("LoadPolicy(yaml) failed: %v", err)
+	}
+	if len(policy.Rules) != 4 || policy.Rules[0].Reason != "vendored code is read-only" {
+		t.Errorf("unexpected YAML policy: %+v", policy)
+	}
+
+	for name, data := range map[string]string{
+		"unknown field":     `{"rules": [{"effect": "deny", "path": [".env"]}]}`,
+		"unknown effect":    `{"rules": [{"effect": "block", "paths": [".env"]}]}`,
+		"unknown operation": `{"rules": [{"effect": "deny", "operations": ["execute"], "paths": [".env"]}]}`,
+		"invalid pattern":   `{"rules": [{"effect": "deny", "paths": ["[.env"]}]}`,
+		"no paths":          `{"rules": [{"effect": "deny"}]}`,
+	} {
+		if _, err := ParsePolicy([]byte(data), FormatJSON); err == nil {
+			t.Errorf("%s: ParsePolicy accepted %s", name, data)
+		}
+	}
+	if _, err := ParsePolicy([]byte("rules:\n  - effect: deny\n    pathz: [.env]\n"), FormatYAML); err == nil || !strings.Contains(err.Error(), "pathz") {
+		t.Errorf("unknown YAML field: got %v", err)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"vendor/**", "vendor", true},
+		{"vendor/**", "vendor/a/b.go", true},
+		{"**/secrets/**", "secrets/key", true},
+		{"**/secrets/**", "a/b/secrets/key", true},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/app/main.go", true},
+		{"src/*.go", "src/app/main.go", false},
+		{"src/**/test", "src/test", true},
+		{"src/**/test", "src/a/testdata", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Limits of a Quota.
+const (
+	QuotaBytesRead    = "bytes read"
+	QuotaBytesWritten = "bytes written"
+	QuotaFilesTouched = "files touched"
+	QuotaSearches     = "searches"
+)
+
+// ErrQuotaExceeded matches every *QuotaError with errors.Is.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota limits what a session may do through a QuotaBackend. Zero limits are unlimited.
+type Quota struct {
+	MaxBytesRead    int64 `json:"max_bytes_read,omitempty"`
+	MaxBytesWritten int64 `json:"max_bytes_written,omitempty"`
+	MaxFilesTouched int   `json:"max_files_touched,omitempty"` // distinct paths read, written, created or deleted
+	MaxSearches     int   `json:"max_searches,omitempty"`
+}
+
+// QuotaUsage is what a session has used of its Quota.
+type QuotaUsage struct {
+	BytesRead    int64 `json:"bytes_read"`
+	BytesWritten int64 `json:"bytes_written"`
+	FilesTouched int   `json:"files_touched"`
+	Searches     int   `json:"searches"`
+}
+
+// QuotaError is returned for operations that would exceed a Quota.
+type QuotaError struct {
+	Limit string // the exceeded limit, such as QuotaBytesRead
+	Max   int64  // the value of the limit
+	Op    string // the operation that was refused
+	Path  string // the path it was refused on
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s %s: quota of %d %s exceeded", e.Op, e.Path, e.Max, e.Limit)
+}
+
+// Is reports whether target is ErrQuotaExceeded.
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// quotaState is the usage shared by a QuotaBackend and its views.
+type quotaState struct {
+	mu      sync.Mutex
+	usage   QuotaUsage
+	touched map[string]bool
+}
+
+// QuotaBackend enforces a Quota on top of another backend, so that runaway sessions cannot
+// read the whole disk. Operations that would exceed a limit fail with a *QuotaError;
+// reads through opened files return what is left of the limit before failing. Searches
+// count the files they read, while trees are not counted. Stat, Lstat, ReadDir and
+// ReadLink are not counted either.
+type QuotaBackend struct {
+	backend Backend
+	quota   Quota
+	state   *quotaState
+	op      string // the operation of a view, see withOperation
+}
+
+// NewQuotaBackend returns backend limited by quota.
+func NewQuotaBackend(backend Backend, quota Quota) *QuotaBackend {
+	return &QuotaBackend{backend: backend, quota: quota, state: &quotaState{touched: map[string]bool{}}}
+}
+
+// Quota returns the limits the backend enforces.
+func (q *QuotaBackend) Quota() Quota {
+	return q.quota
+}
+
+// Usage returns what has been used so far.
+func (q *QuotaBackend) Usage() QuotaUsage {
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+	return q.state.usage
+}
+
+// Reset clears the usage to start a new session.
+func (q *QuotaBackend) Reset() {
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+	q.state.usage = QuotaUsage{}
+	q.state.touched = map[string]bool{}
+}
+
+func (q *QuotaBackend) unwrap() Backend {
+	return q.backend
+}
+
+func (q *QuotaBackend) withOperation(op string, inner Backend) Backend {
+	view := *q
+	view.backend = inner
+	view.op = op
+	return &view
+}
+
+// counted reports whether reads are counted, which they are except in trees.
+func (q *QuotaBackend) counted() bool {
+	return q.op != AuditTree
+}
+
+// touch counts path as touched by op, unless it already was.
+func (q *QuotaBackend) touch(op, path string) error {
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+	return q.touchLocked(op, path)
+}
+
+func (q *QuotaBackend) touchLocked(op, path string) error {
+	if err := q.checkTouchLocked(op, path); err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	if !q.state.touched[path] {
+		q.state.touched[path] = true
+		q.state.usage.FilesTouched++
+	}
+	return nil
+}
+
+// checkTouchLocked fails if touching path would exceed the quota, without counting it.
+func (q *QuotaBackend) checkTouchLocked(op, path string) error {
+	path = filepath.Clean(path)
+	if q.state.touched[path] {
+		return nil
+	}
+	if q.quota.MaxFilesTouched > 0 && q.state.usage.FilesTouched >= q.quota.MaxFilesTouched {
+		return &QuotaError{Limit: QuotaFilesTouched, Max: int64(q.quota.MaxFilesTouched), Op: op, Path: path}
+	}
+	return nil
+}
+
+// checkReadLocked fails if reading n bytes of path would exceed the quota, without
+// counting anything.
+func (q *QuotaBackend) checkReadLocked(path string, n int64) error {
+	if q.quota.MaxBytesRead > 0 && q.state.usage.BytesRead+n > q.quota.MaxBytesRead {
+		return &QuotaError{Limit: QuotaBytesRead, Max: q.quota.MaxBytesRead, Op: "read", Path: path}
+	}
+	return q.checkTouchLocked("read", path)
+}
+
+// startSearch counts a search below root.
+func (q *QuotaBackend) startSearch(root string) error {
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+	if q.quota.MaxSearches > 0 && q.state.usage.Searches >= q.quota.MaxSearches {
+		return &QuotaError{Limit: QuotaSearches, Max: int64(q.quota.MaxSearches), Op: "search", Path: root}
+	}
+	q.state.usage.Searches++
+	return nil
+}
+
+// allowRead returns how many of n bytes may still be read, zero once the quota of bytes
+// read is used up.
+func (q *QuotaBackend) allowRead(n int) int {
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+	if q.quota.MaxBytesRead <= 0 {
+		return n
+	}
+	left := q.quota.MaxBytesRead - q.state.usage.BytesRead
+	if left <= 0 {
+		return 0
+	}
+	if int64(n) > left {
+		return int(left)
+	}
+	return n
+}
+
+// addRead counts n bytes read.
+func (q *QuotaBackend) addRead(n int) {
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+	q.state.usage.BytesRead += int64(n)
+}
+
+// Open opens a file for reading.
+func (q *QuotaBackend) Open(name string) (fs.File, error) {
+	f, err := q.backend.Open(name)
+	if err != nil || !q.counted() {
+		return f, err
+	}
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return f, nil
+	}
+	if err := q.touch("open", name); err != nil {
+		f.Close()
+		return nil, err
+	}
+	file := &quotaFile{File: f, backend: q, path: name}
+	if _, ok := f.(io.ReaderAt); ok {
+		return quotaFileAt{file}, nil
+	}
+	return file, nil
+}
+
+// Stat returns the file info of a path, following links.
+func (q *QuotaBackend) Stat(name string) (fs.FileInfo, error) {
+	return q.backend.Stat(name)
+}
+
+// Lstat returns the file info of a path without following a final link.
+func (q *QuotaBackend) Lstat(name string) (fs.FileInfo, error) {
+	return q.backend.Lstat(name)
+}
+
+// ReadDir returns the entries of a directory sorted by name.
+func (q *QuotaBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return q.backend.ReadDir(name)
+}
+
+// ReadFile returns the content of a file, failing without reading or counting it if it is
+// larger than what is left of the quota. Files that cannot be read are not counted.
+func (q *QuotaBackend) ReadFile(name string) ([]byte, error) {
+	if !q.counted() {
+		return q.backend.ReadFile(name)
+	}
+	info, err := q.backend.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	q.state.mu.Lock()
+	err = q.checkReadLocked(name, info.Size())
+	q.state.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	data, err := q.backend.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check again, as the file may have grown and other reads may have been counted.
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+	if err := q.checkReadLocked(name, int64(len(data))); err != nil {
+		return nil, err
+	}
+	q.state.usage.BytesRead += int64(len(data))
+	return data, q.touchLocked("read", name)
+}
+
+// ReadLink returns the target of a symbolic link.
+func (q *QuotaBackend) ReadLink(name string) (string, error) {
+	return q.backend.ReadLink(name)
+}
+
+// WriteFile writes a file, failing if its content would exceed the quota.
+func (q *QuotaBackend) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	backend, err := writableBackend(q.backend, "write", name)
+	if err != nil {
+		return err
+	}
+	q.state.mu.Lock()
+	if q.quota.MaxBytesWritten > 0 && q.state.usage.BytesWritten+int64(len(data)) > q.quota.MaxBytesWritten {
+		q.state.mu.Unlock()
+		return &QuotaError{Limit: QuotaBytesWritten, Max: q.quota.MaxBytesWritten, Op: "write", Path: name}
+	}
+	if err := q.touchLocked("write", name); err != nil {
+		q.state.mu.Unlock()
+		return err
+	}
+	q.state.usage.BytesWritten += int64(len(data))
+	q.state.mu.Unlock()
+	return backend.WriteFile(name, data, perm)
+}
+
+// MkdirAll creates a directory along with any missing parents.
+func (q *QuotaBackend) MkdirAll(name string, perm fs.FileMode) error {
+	backend, err := writableBackend(q.backend, "mkdir", name)
+	if err != nil {
+		return err
+	}
+	if err := q.touch("mkdir", name); err != nil {
+		return err
+	}
+	return backend.MkdirAll(name, perm)
+}
+
+// Remove removes a file or an empty directory.
+func (q *QuotaBackend) Remove(name string) error {
+	backend, err := writableBackend(q.backend, "remove", name)
+	if err != nil {
+		return err
+	}
+	if err := q.touch("remove", name); err != nil {
+		return err
+	}
+	return backend.Remove(name)
+}
+
+// RemoveAll removes a path and everything below it, which counts as touching the path
+// only.
+func (q *QuotaBackend) RemoveAll(name string) error {
+	backend, err := writableBackend(q.backend, "remove", name)
+	if err != nil {
+		return err
+	}
+	if err := q.touch("remove", name); err != nil {
+		return err
+	}
+	return backend.RemoveAll(name)
+}
+
+// Rename moves a file or directory, touching both paths.
+func (q *QuotaBackend) Rename(oldname, newname string) error {
+	backend, err := writableBackend(q.backend, "rename", oldname)
+	if err != nil {
+		return err
+	}
+	if err := q.touch("rename", oldname); err != nil {
+		return err
+	}
+	if err := q.touch("rename", newname); err != nil {
+		return err
+	}
+	return backend.Rename(oldname, newname)
+}
+
+// Chmod changes the mode of a file or directory.
+func (q *QuotaBackend) Chmod(name string, mode fs.FileMode) error {
+	backend, err := writableBackend(q.backend, "chmod", name)
+	if err != nil {
+		return err
+	}
+	if err := q.touch("chmod", name); err != nil {
+		return err
+	}
+	return backend.Chmod(name, mode)
+}
+
+// Chtimes changes the modification time of a file or directory.
+func (q *QuotaBackend) Chtimes(name string, modTime time.Time) error {
+	backend, err := writableBackend(q.backend, "chtimes", name)
+	if err != nil {
+		return err
+	}
+	if err := q.touch("chtimes", name); err != nil {
+		return err
+	}
+	return backend.Chtimes(name, modTime)
+}
+
+// quotaFile counts the bytes read from an opened file.
+type quotaFile struct {
+	fs.File
+	backend *QuotaBackend
+	path    string
+}
+
+// Read reads up to what is left of the quota. Once it is used up, reading fails only if
+// the file has more to read, so that files ending exactly at the limit read to io.EOF.
+func (f *quotaFile) Read(p []byte) (int, error) {
+	n := f.backend.allowRead(len(p))
+	if n == 0 && len(p) > 0 {
+		var probe [1]byte
+		if read, err := f.File.Read(probe[:]); read == 0 {
+			return 0, err
+		}
+		return 0, f.exceeded()
+	}
+	n, err := f.File.Read(p[:n])
+	f.backend.addRead(n)
+	return n, err
+}
+
+// exceeded returns the error of reading past the quota of bytes read.
+func (f *quotaFile) exceeded() error {
+	return &QuotaError{Limit: QuotaBytesRead, Max: f.backend.quota.MaxBytesRead, Op: "read", Path: f.path}
+}
+
+// quotaFileAt is a quotaFile for files supporting io.ReaderAt.
+type quotaFileAt struct {
+	*quotaFile
+}
+
+// ReadAt reads up to what is left of the quota, failing like Read only if the file has
+// more to read past it.
+func (f quotaFileAt) ReadAt(p []byte, offset int64) (int, error) {
+	n := f.backend.allowRead(len(p))
+	reader := f.File.(io.ReaderAt)
+	read, err := reader.ReadAt(p[:n], offset)
+	f.backend.addRead(read)
+	if err == nil && n < len(p) {
+		var probe [1]byte
+		if more, _ := reader.ReadAt(probe[:], offset+int64(read)); more == 0 {
+			return read, io.EOF
+		}
+		err = f.exceeded()
+	}
+	return read, err
+}
+
+// searchLimiter is implemented by backends limiting the number of searches.
+type searchLimiter interface {
+	startSearch(root string) error
+}
+
+// startSearch counts a search below root on every backend limiting searches among
+// backend and the backends it wraps.
+func startSearch(backend Backend, root string) error {
+	for _, backend := range wrappedBackends(backend) {
+		if limiter, ok := backend.(searchLimiter); ok {
+			if err := limiter.startSearch(root); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var _ WritableBackend = (*QuotaBackend)(nil)
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuotaBackend(t *testing.T) {
+	memory := NewMemoryBackend()
+	if err := memory.MkdirAll("/repo", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := memory.WriteFile("/repo/"+name, []byte(strings.Repeat("x", 9)+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backend := NewQuotaBackend(memory, Quota{MaxBytesRead: 35, MaxBytesWritten: 10, MaxFilesTouched: 3, MaxSearches: 1})
+	fsys := NewFS(backend)
+
+	exceeded := func(name, limit string, err error) {
+		t.Helper()
+		var quotaErr *QuotaError
+		if !errors.Is(err, ErrQuotaExceeded) || !errors.As(err, &quotaErr) || quotaErr.Limit != limit {
+			t.Errorf("%s: got %v, want a *QuotaError for %s", name, err, limit)
+		}
+	}
+
+	// Trees are not counted, searches are.
+	if _, err := fsys.BuildDirTree("/repo", TreeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if usage := backend.Usage(); usage != (QuotaUsage{}) {
+		t.Errorf("tree was counted: %+v", usage)
+	}
+	if results, err := fsys.SearchFiles("/repo", "x", SearchOptions{}); err != nil || len(results) != 3 {
+		t.Fatalf("SearchFiles = %v, %v", results, err)
+	}
+	_, err := fsys.SearchFiles("/repo", "x", SearchOptions{})
+	exceeded("second search", QuotaSearches, err)
+
+	// The search read each of the three files once.
+	if usage := backend.Usage(); usage.FilesTouched != 3 || usage.BytesRead != 30 {
+		t.Errorf("unexpected usage after search: %+v", usage)
+	}
+	_, err = fsys.ReadFile("/repo/a.txt")
+	exceeded("reading past the quota", QuotaBytesRead, err)
+	err = fsys.WriteFile("/repo/d.txt", nil)
+	exceeded("touching a fourth file", QuotaFilesTouched, err)
+
+	backend.Reset()
+	if usage := backend.Usage(); usage != (QuotaUsage{}) {
+		t.Errorf("Reset kept usage: %+v", usage)
+	}
+	if err := fsys.WriteFile("/repo/a.txt", []byte("0123456789")); err != nil {
+		t.Fatalf("writing within the quota: %v", err)
+	}
+	err = fsys.WriteFile("/repo/a.txt", []byte("!"))
+	exceeded("writing past the quota", QuotaBytesWritten, err)
+	if data, err := fsys.ReadBytes("/repo/b.txt", 0, 20); err != nil || len(data) != 10 {
+		t.Errorf("ReadBytes = %q, %v", data, err)
+	}
+	lines, err := fsys.ReadLines("/repo/c.txt", 1, 1)
+	if err != nil || !reflect.DeepEqual(lines, []string{"xxxxxxxxx"}) {
+		t.Errorf("ReadLines = %q, %v", lines, err)
+	}
+	if usage := backend.Usage(); usage.BytesRead != 20 || usage.BytesWritten != 10 || usage.FilesTouched != 3 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+
+	// Searches and streamed reads stop when they run out of quota.
+	backend = NewQuotaBackend(memory, Quota{MaxBytesRead: 25})
+	fsys = NewFS(backend)
+	_, err = fsys.SearchFiles("/repo", "x", SearchOptions{})
+	exceeded("searching past the quota", QuotaBytesRead, err)
+	backend.Reset()
+	_, err = fsys.ReadLines("/repo/c.txt", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fsys.ReadLines("/repo/c.txt", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fsys.ReadLines("/repo/c.txt", 1, 1)
+	exceeded("streaming past the quota", QuotaBytesRead, err)
+	if usage := backend.Usage(); usage.BytesRead != 25 {
+		t.Errorf("streamed reads used %d bytes, want 25", usage.BytesRead)
+	}
+}
+
+// readCountingBackend counts the files read through it.
+type readCountingBackend struct {
+	Backend
+	reads int
+}
+
+func (b *readCountingBackend) ReadFile(name string) ([]byte, error) {
+	b.reads++
+	return b.Backend.ReadFile(name)
+}
+
+func TestQuotaBackend_ReadFile(t *testing.T) {
+	memory := NewMemoryBackend()
+	if err := memory.WriteFile("/large.txt", []byte(strings.Repeat("x", 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inner := &readCountingBackend{Backend: memory}
+	backend := NewQuotaBackend(inner, Quota{MaxBytesRead: 10})
+
+	var quotaErr *QuotaError
+	if _, err := backend.ReadFile("/large.txt"); !errors.As(err, &quotaErr) || quotaErr.Limit != QuotaBytesRead {
+		t.Errorf("reading past the quota: got %v, want a *QuotaError for %s", err, QuotaBytesRead)
+	}
+	if inner.reads != 0 {
+		t.Errorf("the file was read %d times before checking its size", inner.reads)
+	}
+	if _, err := backend.ReadFile("/missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("reading a missing file: got %v, want fs.ErrNotExist", err)
+	}
+	if usage := backend.Usage(); usage != (QuotaUsage{}) {
+		t.Errorf("failed reads were counted: %+v", usage)
+	}
+}
+
+func TestQuotaBackend_ExactLimit(t *testing.T) {
+	memory := NewMemoryBackend()
+	if err := memory.WriteFile("/exact.txt", []byte("hello world\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := NewQuotaBackend(memory, Quota{MaxBytesRead: 12})
+	f, err := backend.Open("/exact.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(data) != "hello world\n" {
+		t.Errorf("reading a file ending at the quota = %q, %v", data, err)
+	}
+
+	backend = NewQuotaBackend(memory, Quota{MaxBytesRead: 12})
+	f, err = backend.Open("/exact.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 20)
+	if n, err := f.(io.ReaderAt).ReadAt(buf, 0); n != 12 || err != io.EOF {
+		t.Errorf("ReadAt of a file ending at the quota = %d, %v, want 12, io.EOF", n, err)
+	}
+	f.Close()
+
+	// Searches read every file once, including the check for binary content.
+	backend = NewQuotaBackend(memory, Quota{MaxBytesRead: 12})
+	results, err := NewFS(backend).SearchFiles("/", "world", SearchOptions{})
+	if err != nil || len(results) != 1 {
+		t.Errorf("searching files ending at the quota = %+v, %v", results, err)
+	}
+	if usage := backend.Usage(); usage.BytesRead != 12 {
+		t.Errorf("search read %d bytes, want 12", usage.BytesRead)
+	}
+
+	backend = NewQuotaBackend(memory, Quota{MaxBytesRead: 11})
+	f, err = backend.Open("/exact.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(f); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("reading past the quota: got %v, want ErrQuotaExceeded", err)
+	}
+	f.Close()
+}
+
+func TestReadOnlyBackend(t *testing.T) {
+	memory := NewMemoryBackend()
+	if err := memory.WriteFile("/notes.txt", []byte("notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := NewFS(NewReadOnlyBackend(memory))
+	if _, ok := fsys.Backend().(WritableBackend); ok {
+		t.Fatal("read-only backend is writable")
+	}
+	if data, err := fsys.ReadFile("/notes.txt"); err != nil || string(data) != "notes\n" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	for name, err := range map[string]error{
+		"WriteFile":  fsys.WriteFile("/notes.txt", nil),
+		"DeleteFile": fsys.DeleteFile("/notes.txt"),
+		"CreateDir":  fsys.CreateDir("/docs"),
+		"DeleteDir":  fsys.DeleteDir("/"),
+	} {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: got %v, want ErrReadOnly", name, err)
+		}
+	}
+}
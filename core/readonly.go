@@ -0,0 +1,20 @@
+package core
+
+// readOnlyBackend hides the write methods of a backend.
+type readOnlyBackend struct {
+	Backend
+}
+
+// NewReadOnlyBackend returns a view of backend that is not a WritableBackend, so that
+// every modification through an FS fails with ErrReadOnly.
+func NewReadOnlyBackend(backend Backend) Backend {
+	return readOnlyBackend{backend}
+}
+
+func (r readOnlyBackend) unwrap() Backend {
+	return r.Backend
+}
+
+func (r readOnlyBackend) withOperation(op string, inner Backend) Backend {
+	return readOnlyBackend{inner}
+}
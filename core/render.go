@@ -0,0 +1,254 @@
+package core
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tree formats supported by RenderTree.
+const (
+	TreeFormatOutline  = "outline"  // indented plain-text outline of relative names
+	TreeFormatPaths    = "paths"    // one relative path per line
+	TreeFormatCompact  = "compact"  // nested JSON with short keys
+	TreeFormatMarkdown = "markdown" // nested Markdown list
+	TreeFormatXML      = "xml"      // nested XML elements
+	TreeFormatJSON     = "json"     // the full DirectoryTree as minified JSON
+)
+
+// RenderOptions controls how RenderTree renders a directory tree.
+type RenderOptions struct {
+	// CollapseChains merges directories that contain nothing but a single directory
+	// into one entry, e.g. "a/b/c/".
+	CollapseChains bool `json:"collapse_chains,omitempty"`
+	// Indent is the indentation unit for nested formats and defaults to two spaces.
+	Indent string `json:"indent,omitempty"`
+	// ShowSize adds file and directory sizes in bytes.
+	ShowSize bool `json:"show_size,omitempty"`
+	// ShowTokens adds estimated token counts (see AnnotateTreeTokens).
+	ShowTokens bool `json:"show_tokens,omitempty"`
+}
+
+// renderNode is a DirectoryTree node reduced to what the compact formats need.
+// Placeholders for omitted entries are rendered like files, using their summary as name.
+type renderNode struct {
+	name     string // relative name; may contain slashes after collapsing
+	isDir    bool
+	omitted  bool // placeholder for entries left out by tree limits
+	size     int64
+	tokens   int
+	link     string // target of a symbolic link
+	children []renderNode
+}
+
+// newRenderNode converts a tree into render nodes, collapsing chains when requested.
+func newRenderNode(tree DirectoryTree, collapse bool) renderNode {
+	node := renderNode{
+		name:    tree.Name,
+		isDir:   !tree.IsFile && tree.Omitted == nil,
+		omitted: tree.Omitted != nil,
+		size:    tree.Size,
+		tokens:  tree.Tokens,
+		link:    tree.LinkTarget,
+	}
+	for collapse && node.isDir && node.link == "" && len(tree.Children) == 1 && !tree.Children[0].IsFile && tree.Children[0].Omitted == nil && !tree.Children[0].IsSymlink {
+		tree = tree.Children[0]
+		node.name += "/" + tree.Name
+	}
+	for _, child := range tree.Children {
+		node.children = append(node.children, newRenderNode(child, collapse))
+	}
+	return node
+}
+
+// label returns the display name of a node, with a trailing slash for directories and
+// the target of symbolic links.
+func (n renderNode) label() string {
+	label := n.name
+	if n.isDir {
+		label += "/"
+	}
+	if n.link != "" {
+		label += " -> " + n.link
+	}
+	return label
+}
+
+// annotations returns the size and token annotations requested by options.
+func (n renderNode) annotations(options RenderOptions) []string {
+	var notes []string
+	if options.ShowSize {
+		notes = append(notes, formatSize(n.size))
+	}
+	if options.ShowTokens {
+		notes = append(notes, strconv.Itoa(n.tokens)+" tok")
+	}
+	return notes
+}
+
+// formatSize renders a byte count in a short human-readable form.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// renderTree renders a directory tree in the given format.
+func renderTree(tree DirectoryTree, format string, options RenderOptions) (string, error) {
+	if options.Indent == "" {
+		options.Indent = "  "
+	}
+	root := newRenderNode(tree, options.CollapseChains)
+
+	var b strings.Builder
+	switch format {
+	case TreeFormatOutline:
+		renderOutline(&b, root, "", options)
+	case TreeFormatPaths:
+		renderPaths(&b, root, "", options)
+	case TreeFormatCompact:
+		data, err := json.Marshal(compactNode(root, options))
+		if err != nil {
+			return "", fmt.Errorf("could not marshal directory tree to JSON: %w", err)
+		}
+		b.Write(data)
+	case TreeFormatMarkdown:
+		renderMarkdown(&b, root, "", options)
+	case TreeFormatXML:
+		renderXML(&b, root, "", options)
+	case TreeFormatJSON:
+		return getTreeMinifiedJSON(tree)
+	default:
+		return "", fmt.Errorf("unsupported tree format %q", format)
+	}
+	return b.String(), nil
+}
+
+// renderOutline writes "name/ (annotations)" lines indented by depth.
+func renderOutline(b *strings.Builder, node renderNode, indent string, options RenderOptions) {
+	b.WriteString(indent)
+	b.WriteString(node.label())
+	if notes := node.annotations(options); len(notes) > 0 {
+		b.WriteString(" (" + strings.Join(notes, ", ") + ")")
+	}
+	b.WriteByte('\n')
+	for _, child := range node.children {
+		renderOutline(b, child, indent+options.Indent, options)
+	}
+}
+
+// renderPaths writes the relative path of every file and empty directory below the root.
+func renderPaths(b *strings.Builder, node renderNode, prefix string, options RenderOptions) {
+	for _, child := range node.children {
+		path := prefix + child.name
+		if child.isDir && len(child.children) > 0 {
+			renderPaths(b, child, path+"/", options)
+			continue
+		}
+		b.WriteString(prefix + child.label())
+		if notes := child.annotations(options); len(notes) > 0 {
+			b.WriteString("\t" + strings.Join(notes, "\t"))
+		}
+		b.WriteByte('\n')
+	}
+}
+
+// compactNode converts a node into the short-key JSON form: "n" for the name, "c" for
+// children (present only on directories), "l" for link targets, "s" for size and "t" for
+// tokens.
+func compactNode(node renderNode, options RenderOptions) map[string]any {
+	compact := map[string]any{"n": node.name}
+	if node.link != "" {
+		compact["l"] = node.link
+	}
+	if node.isDir {
+		children := make([]map[string]any, 0, len(node.children))
+		for _, child := range node.children {
+			children = append(children, compactNode(child, options))
+		}
+		compact["c"] = children
+	}
+	if options.ShowSize {
+		compact["s"] = node.size
+	}
+	if options.ShowTokens {
+		compact["t"] = node.tokens
+	}
+	return compact
+}
+
+// renderMarkdown writes the tree as a nested Markdown list.
+func renderMarkdown(b *strings.Builder, node renderNode, indent string, options RenderOptions) {
+	b.WriteString(indent + "- " + markdownText(node.label()))
+	if notes := node.annotations(options); len(notes) > 0 {
+		b.WriteString(" _(" + strings.Join(notes, ", ") + ")_")
+	}
+	b.WriteByte('\n')
+	for _, child := range node.children {
+		renderMarkdown(b, child, indent+options.Indent, options)
+	}
+}
+
+// markdownEscaper backslash-escapes the characters Markdown treats as markup anywhere in
+// a line.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`<`, `\<`, `>`, `\>`, `#`, `\#`, `|`, `\|`, `~`, `\~`, `!`, `\!`,
+)
+
+// markdownText escapes a name so that it renders literally as the text of a list item.
+func markdownText(text string) string {
+	text = markdownEscaper.Replace(text)
+	// A leading list marker, such as "-", "+" or "1.", would start a nested list.
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		return `\` + text
+	}
+	digits := len(text) - len(strings.TrimLeft(text, "0123456789"))
+	if digits > 0 && digits < len(text) && (text[digits] == '.' || text[digits] == ')') {
+		return text[:digits] + `\` + text[digits:]
+	}
+	return text
+}
+
+// renderXML writes the tree as nested <dir> and <file> elements, with <omitted> elements
+// for placeholders.
+func renderXML(b *strings.Builder, node renderNode, indent string, options RenderOptions) {
+	element := "file"
+	if node.isDir {
+		element = "dir"
+	} else if node.omitted {
+		element = "omitted"
+	}
+	b.WriteString(indent + "<" + element + ` name="`)
+	xml.EscapeText(b, []byte(node.name))
+	b.WriteByte('"')
+	if node.link != "" {
+		b.WriteString(` link="`)
+		xml.EscapeText(b, []byte(node.link))
+		b.WriteByte('"')
+	}
+	if options.ShowSize {
+		fmt.Fprintf(b, ` size="%d"`, node.size)
+	}
+	if options.ShowTokens {
+		fmt.Fprintf(b, ` tokens="%d"`, node.tokens)
+	}
+	if len(node.children) == 0 {
+		b.WriteString("/>\n")
+		return
+	}
+	b.WriteString(">\n")
+	for _, child := range node.children {
+		renderXML(b, child, indent+options.Indent, options)
+	}
+	b.WriteString(indent + "</" + element + ">\n")
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"testing"
+)
+
+func renderTestTree() DirectoryTree {
+	return DirectoryTree{
+		Path: "/abs/project", Name: "project", Size: 3000,
+		Children: []DirectoryTree{
+			{Path: "/abs/project/src", Name: "src", Size: 2000, Children: []DirectoryTree{
+				{Path: "/abs/project/src/pkg", Name: "pkg", Size: 2000, Children: []DirectoryTree{
+					{Path: "/abs/project/src/pkg/a.go", Name: "a.go", IsFile: true, Size: 1500},
+					{Path: "/abs/project/src/pkg/b.go", Name: "b.go", IsFile: true, Size: 500},
+				}},
+			}},
+			{Path: "/abs/project/empty", Name: "empty"},
+			{Path: "/abs/project/README.md", Name: "README.md", IsFile: true, Size: 1000},
+		},
+	}
+}
+
+func TestRenderTree(t *testing.T) {
+	tree := renderTestTree()
+
+	tests := []struct {
+		format   string
+		options  RenderOptions
+		expected string
+	}{
+		{TreeFormatOutline, RenderOptions{}, "project/\n  src/\n    pkg/\n      a.go\n      b.go\n  empty/\n  README.md\n"},
+		{TreeFormatOutline, RenderOptions{CollapseChains: true, ShowSize: true}, "project/ (2.9 KB)\n  src/pkg/ (2.0 KB)\n    a.go (1.5 KB)\n    b.go (500 B)\n  empty/ (0 B)\n  README.md (1000 B)\n"},
+		{TreeFormatPaths, RenderOptions{}, "src/pkg/a.go\nsrc/pkg/b.go\nempty/\nREADME.md\n"},
+		{TreeFormatCompact, RenderOptions{CollapseChains: true}, `{"c":[{"c":[{"n":"a.go"},{"n":"b.go"}],"n":"src/pkg"},{"c":[],"n":"empty"},{"n":"README.md"}],"n":"project"}`},
+		{TreeFormatMarkdown, RenderOptions{CollapseChains: true}, "- project/\n  - src/pkg/\n    - a.go\n    - b.go\n  - empty/\n  - README.md\n"},
+		{TreeFormatXML, RenderOptions{CollapseChains: true, Indent: " "}, "<dir name=\"project\">\n <dir name=\"src/pkg\">\n  <file name=\"a.go\"/>\n  <file name=\"b.go\"/>\n </dir>\n <dir name=\"empty\"/>\n <file name=\"README.md\"/>\n</dir>\n"},
+	}
+	for _, test := range tests {
+		output, err := RenderTree(tree, test.format, test.options)
+		if err != nil {
+			t.Errorf("RenderTree(%s) failed: %v", test.format, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("RenderTree(%s) mismatch:\ngot\n%s\nwant\n%s", test.format, output, test.expected)
+		}
+	}
+
+	minified, _ := GetTreeMinifiedJSON(tree)
+	if output, _ := RenderTree(tree, TreeFormatJSON, RenderOptions{}); output != minified {
+		t.Errorf("RenderTree(json) should match GetTreeMinifiedJSON")
+	}
+	if compact, _ := RenderTree(tree, TreeFormatCompact, RenderOptions{CollapseChains: true}); len(compact)*2 > len(minified) {
+		t.Errorf("Compact format should be well under half the size of the minified JSON: %d vs %d", len(compact), len(minified))
+	}
+
+	if _, err := RenderTree(tree, "yaml", RenderOptions{}); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
+
+func TestRenderTree_XMLEscaping(t *testing.T) {
+	tree := DirectoryTree{Name: "root", Children: []DirectoryTree{{Name: `a&b<"c">.txt`, IsFile: true, Tokens: 7}}}
+	output, err := RenderTree(tree, TreeFormatXML, RenderOptions{ShowTokens: true})
+	if err != nil {
+		t.Fatalf("RenderTree failed: %v", err)
+	}
+	expected := "<dir name=\"root\" tokens=\"0\">\n  <file name=\"a&amp;b&lt;&#34;c&#34;&gt;.txt\" tokens=\"7\"/>\n</dir>\n"
+	if output != expected {
+		t.Errorf("RenderTree XML escaping mismatch:\ngot\n%s\nwant\n%s", output, expected)
+	}
+}
+
+func TestRenderTree_MarkdownEscaping(t *testing.T) {
+	tree := DirectoryTree{Name: "root", Children: []DirectoryTree{
+		{Name: "__init__.py", IsFile: true},
+		{Name: "*.go", IsFile: true},
+		{Name: "[draft] notes.md", IsFile: true},
+		{Name: "#1 todo.txt", IsFile: true},
+		{Name: "- list.txt", IsFile: true},
+		{Name: "2. second.txt", IsFile: true},
+		{Name: "link", IsFile: true, IsSymlink: true, LinkTarget: "a_b"},
+	}}
+	output, err := RenderTree(tree, TreeFormatMarkdown, RenderOptions{})
+	if err != nil {
+		t.Fatalf("RenderTree failed: %v", err)
+	}
+	expected := "- root/\n" +
+		"  - \\_\\_init\\_\\_.py\n" +
+		"  - \\*.go\n" +
+		"  - \\[draft\\] notes.md\n" +
+		"  - \\#1 todo.txt\n" +
+		"  - \\- list.txt\n" +
+		"  - 2\\. second.txt\n" +
+		"  - link -\\> a\\_b\n"
+	if output != expected {
+		t.Errorf("RenderTree Markdown escaping mismatch:\ngot\n%s\nwant\n%s", output, expected)
+	}
+}
+
+func TestRenderTree_Symlinks(t *testing.T) {
+	tree := DirectoryTree{Name: "root", Children: []DirectoryTree{
+		{Name: "loop", IsSymlink: true, LinkTarget: ".."},
+		{Name: "link.txt", IsFile: true, IsSymlink: true, LinkTarget: "file.txt"},
+	}}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{TreeFormatOutline, "root/\n  loop/ -> ..\n  link.txt -> file.txt\n"},
+		{TreeFormatCompact, `{"c":[{"c":[],"l":"..","n":"loop"},{"l":"file.txt","n":"link.txt"}],"n":"root"}`},
+		{TreeFormatXML, "<dir name=\"root\">\n  <dir name=\"loop\" link=\"..\"/>\n  <file name=\"link.txt\" link=\"file.txt\"/>\n</dir>\n"},
+	}
+	for _, test := range tests {
+		output, err := RenderTree(tree, test.format, RenderOptions{CollapseChains: true})
+		if err != nil {
+			t.Errorf("RenderTree(%s) failed: %v", test.format, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("RenderTree(%s) mismatch:\ngot\n%s\nwant\n%s", test.format, output, test.expected)
+		}
+	}
+}
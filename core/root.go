@@ -0,0 +1,411 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrOutsideRoot is returned by a RootBackend for paths that lead outside its root,
+// whether through ".." components or through symbolic links.
+var ErrOutsideRoot = errors.New("path is outside the root")
+
+// RootBackend is a WritableBackend confined to a directory, for paths that cannot be
+// trusted, such as those suggested by an LLM. Every path is resolved relative to the root,
+// with absolute paths treated as if the root were "/". Paths whose ".." components climb
+// above the root and symbolic links pointing outside of it fail with ErrOutsideRoot.
+//
+// Lookups go through os.Root, so links are resolved safely. Writes are atomic like those
+// of OSBackend, with their temporary files created through the root. Rename, ReadLink,
+// Chmod, Chtimes and the renames that complete writes validate their paths through the
+// root before acting on them by name.
+type RootBackend struct {
+	root *os.Root
+}
+
+// NewRootBackend opens dir as the root of a RootBackend. Close the backend to release it.
+func NewRootBackend(dir string) (*RootBackend, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &RootBackend{root: root}, nil
+}
+
+// Close releases the root directory.
+func (r *RootBackend) Close() error {
+	return r.root.Close()
+}
+
+// Dir returns the directory the backend is confined to.
+func (r *RootBackend) Dir() string {
+	return r.root.Name()
+}
+
+// rel returns the path relative to the root for name, rejecting names whose ".."
+// components climb above the root.
+func (r *RootBackend) rel(op, name string) (string, error) {
+	var parts []string
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if len(parts) == 0 {
+				return "", &fs.PathError{Op: op, Path: name, Err: ErrOutsideRoot}
+			}
+			parts = parts[:len(parts)-1]
+		default:
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return ".", nil
+	}
+	return filepath.Join(parts...), nil
+}
+
+// fail reports an error of os.Root under the name the caller used, turning errors on
+// names that lead outside the root into ErrOutsideRoot.
+func (r *RootBackend) fail(op, name string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		inner := pathErr.Err
+		if rel, relErr := r.rel(op, name); relErr == nil && r.escapes(rel) {
+			inner = ErrOutsideRoot
+		}
+		return &fs.PathError{Op: op, Path: name, Err: inner}
+	}
+	return err
+}
+
+// escapes reports whether rel, a path relative to the root that does not climb above it,
+// leads outside the root through links. Links are resolved by name as os.Root resolves
+// them, with absolute targets always leading outside.
+func (r *RootBackend) escapes(rel string) bool {
+	pending := strings.Split(filepath.ToSlash(rel), "/")
+	var resolved []string
+	for links := 0; len(pending) > 0; {
+		part := pending[0]
+		pending = pending[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return true
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+		path := filepath.Join(append([]string{r.root.Name()}, append(resolved, part)...)...)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return false
+		}
+		if !isSymlink(info) {
+			resolved = append(resolved, part)
+			continue
+		}
+		if links++; links > maxLinks {
+			return false
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return false
+		}
+		target = filepath.ToSlash(target)
+		if strings.HasPrefix(target, "/") || filepath.VolumeName(target) != "" {
+			return true
+		}
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+	return false
+}
+
+// Open opens a file for reading.
+func (r *RootBackend) Open(name string) (fs.File, error) {
+	rel, err := r.rel("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.root.Open(rel)
+	if err != nil {
+		return nil, r.fail("open", name, err)
+	}
+	return f, nil
+}
+
+// Stat returns the file info of a path, following links that stay inside the root.
+func (r *RootBackend) Stat(name string) (fs.FileInfo, error) {
+	rel, err := r.rel("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := r.root.Stat(rel)
+	if err != nil {
+		return nil, r.fail("stat", name, err)
+	}
+	return info, nil
+}
+
+// Lstat returns the file info of a path without following a final link.
+func (r *RootBackend) Lstat(name string) (fs.FileInfo, error) {
+	rel, err := r.rel("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := r.root.Lstat(rel)
+	if err != nil {
+		return nil, r.fail("lstat", name, err)
+	}
+	return info, nil
+}
+
+// ReadDir returns the entries of a directory sorted by name.
+func (r *RootBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := r.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := f.(*os.File).ReadDir(-1)
+	if err != nil {
+		return nil, r.fail("readdir", name, err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// ReadFile returns the content of a file.
+func (r *RootBackend) ReadFile(name string) ([]byte, error) {
+	f, err := r.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, r.fail("read", name, err)
+	}
+	return data, nil
+}
+
+// ReadLink returns the target of a symbolic link inside the root.
+func (r *RootBackend) ReadLink(name string) (string, error) {
+	if _, err := r.Lstat(name); err != nil {
+		return "", err
+	}
+	rel, _ := r.rel("readlink", name)
+	target, err := os.Readlink(filepath.Join(r.root.Name(), rel))
+	if err != nil {
+		return "", r.fail("readlink", name, err)
+	}
+	return target, nil
+}
+
+// WriteFile replaces a file atomically like OSBackend.WriteFile: data is written to a
+// temporary file created through the root, which is flushed to disk and then renamed over
+// the file by name. An existing file keeps its mode and owner, while a new one is created
+// with perm less the umask. Writing to a link replaces the file it points to, as long as
+// it is inside the root.
+func (r *RootBackend) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if info, err := r.Lstat(name); err == nil && isSymlink(info) {
+		if _, err := r.Stat(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		target, err := evalSymlinks(r, name)
+		if err != nil {
+			return err
+		}
+		name = target
+	}
+	rel, err := r.rel("write", name)
+	if err != nil {
+		return err
+	}
+	info, err := r.root.Stat(rel)
+	if err == nil {
+		perm = info.Mode().Perm()
+	}
+	dir := filepath.Dir(rel)
+	var tempRel string
+	tempFile, err := createTemp(dir, filepath.Base(rel), func(name string) (*os.File, error) {
+		tempRel = name
+		return r.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	})
+	if err != nil {
+		return r.fail("write", name, err)
+	}
+	defer r.root.Remove(tempRel)
+
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return r.fail("write", name, err)
+	}
+	if info != nil {
+		if err := tempFile.Chmod(perm); err != nil {
+			tempFile.Close()
+			return r.fail("write", name, err)
+		}
+		copyOwner(tempFile, info)
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return r.fail("write", name, err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return r.fail("write", name, err)
+	}
+
+	// The temporary file was created through the root, so its directory is inside it.
+	base := r.root.Name()
+	if err := os.Rename(filepath.Join(base, tempRel), filepath.Join(base, rel)); err != nil {
+		return r.fail("write", name, err)
+	}
+	return syncDir(filepath.Join(base, dir))
+}
+
+// openLockFile opens the sidecar file that locks on name are taken on inside the root.
+func (r *RootBackend) openLockFile(name string) (*os.File, error) {
+	rel, err := r.rel("lock", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.root.OpenFile(lockPath(rel), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, r.fail("lock", name, err)
+	}
+	return f, nil
+}
+
+// MkdirAll creates a directory along with any missing parents.
+func (r *RootBackend) MkdirAll(name string, perm fs.FileMode) error {
+	rel, err := r.rel("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+	path := ""
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, part)
+		err := r.root.Mkdir(path, perm)
+		if err == nil {
+			continue
+		}
+		if info, statErr := r.root.Stat(path); statErr == nil && info.IsDir() {
+			continue
+		}
+		return r.fail("mkdir", name, err)
+	}
+	return nil
+}
+
+// Remove removes a file or an empty directory.
+func (r *RootBackend) Remove(name string) error {
+	rel, err := r.rel("remove", name)
+	if err != nil {
+		return err
+	}
+	if err := r.root.Remove(rel); err != nil {
+		return r.fail("remove", name, err)
+	}
+	return nil
+}
+
+// RemoveAll removes a path and everything below it, succeeding if it does not exist.
+// Links are removed, never followed.
+func (r *RootBackend) RemoveAll(name string) error {
+	info, err := r.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := r.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := r.RemoveAll(filepath.Join(name, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Remove(name)
+}
+
+// Rename moves a file or directory within the root.
+func (r *RootBackend) Rename(oldname, newname string) error {
+	if _, err := r.Lstat(oldname); err != nil {
+		return err
+	}
+	if _, err := r.Stat(filepath.Join(newname, "..")); err != nil {
+		return err
+	}
+	oldRel, _ := r.rel("rename", oldname)
+	newRel, err := r.rel("rename", newname)
+	if err != nil {
+		return err
+	}
+	base := r.root.Name()
+	if err := os.Rename(filepath.Join(base, oldRel), filepath.Join(base, newRel)); err != nil {
+		return r.fail("rename", newname, err)
+	}
+	return nil
+}
+
+// symlink creates newname as a link to oldname inside the root, validating the directory
+// of newname through the root before creating the link by name. The link may point
+// anywhere, but lookups through the root never follow it outside.
+func (r *RootBackend) symlink(oldname, newname string) error {
+	if _, err := r.Stat(filepath.Join(newname, "..")); err != nil {
+		return err
+	}
+	rel, err := r.rel("symlink", newname)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(oldname, filepath.Join(r.root.Name(), rel)); err != nil {
+		return r.fail("symlink", newname, err)
+	}
+	return nil
+}
+
+// Chmod changes the mode of a file or directory inside the root, following links that stay
+// inside of it.
+func (r *RootBackend) Chmod(name string, mode fs.FileMode) error {
+	if _, err := r.Stat(name); err != nil {
+		return err
+	}
+	rel, _ := r.rel("chmod", name)
+	if err := os.Chmod(filepath.Join(r.root.Name(), rel), mode); err != nil {
+		return r.fail("chmod", name, err)
+	}
+	return nil
+}
+
+// Chtimes changes the modification time of a file or directory inside the root, following
+// links that stay inside of it.
+func (r *RootBackend) Chtimes(name string, modTime time.Time) error {
+	if _, err := r.Stat(name); err != nil {
+		return err
+	}
+	rel, _ := r.rel("chtimes", name)
+	if err := os.Chtimes(filepath.Join(r.root.Name(), rel), time.Time{}, modTime); err != nil {
+		return r.fail("chtimes", name, err)
+	}
+	return nil
+}
+
+var _ WritableBackend = (*RootBackend)(nil)
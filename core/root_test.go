@@ -0,0 +1,162 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRootBackend(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src/main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"escape":      outside,
+		"escape.txt":  filepath.Join(outside, "secret.txt"),
+		"relative":    "../" + filepath.Base(outside),
+		"src/main.ln": "main.go",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backend, err := NewRootBackend(dir)
+	if err != nil {
+		t.Fatalf("NewRootBackend failed: %v", err)
+	}
+	defer backend.Close()
+	fsys := NewFS(backend)
+
+	// Absolute and relative paths are resolved against the root.
+	for _, path := range []string{"src/main.go", "/src/main.go", "./src/../src/main.go", "src/main.ln"} {
+		if data, err := fsys.ReadFile(path); err != nil || string(data) != "package main\n" {
+			t.Errorf("ReadFile(%q) = %q, %v", path, data, err)
+		}
+	}
+
+	// Escapes fail with ErrOutsideRoot, whether lexical or through links.
+	for _, path := range []string{
+		"../" + filepath.Base(outside) + "/secret.txt",
+		"/../secret.txt",
+		"src/../../secret.txt",
+		"escape/secret.txt",
+		"escape.txt",
+		"relative/secret.txt",
+	} {
+		if _, err := fsys.ReadFile(path); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("ReadFile(%q): got %v, want ErrOutsideRoot", path, err)
+		}
+	}
+	if err := fsys.WriteFile("escape/new.txt", []byte("x")); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("writing through an escaping link: got %v, want ErrOutsideRoot", err)
+	}
+	if err := fsys.WriteFile("escape.txt", []byte("x")); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("writing to an escaping link: got %v, want ErrOutsideRoot", err)
+	}
+	if err := fsys.CreateDir("../made"); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("creating a directory outside the root: got %v, want ErrOutsideRoot", err)
+	}
+	if err := backend.Rename("src/main.go", "escape/main.go"); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("renaming outside the root: got %v, want ErrOutsideRoot", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(outside, "secret.txt")); string(data) != "secret\n" {
+		t.Errorf("file outside the root was modified: %q", data)
+	}
+
+	// Escapes are recognized from the links themselves, whatever os.Root reports.
+	if err := os.Symlink(filepath.Join(dir, "src", "main.go"), filepath.Join(dir, "absolute.go")); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"escape.txt", "escape/secret.txt", "relative/secret.txt", "absolute.go"} {
+		if _, err := backend.Stat(path); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("Stat(%q): got %v, want ErrOutsideRoot", path, err)
+		}
+		if _, err := backend.Open(path); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("Open(%q): got %v, want ErrOutsideRoot", path, err)
+		}
+	}
+	if _, err := backend.Stat("src/missing.go"); !errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("Stat of a missing file: got %v, want ErrNotExist", err)
+	}
+
+	// Trees list escaping links without following them, and searches skip them.
+	tree, err := fsys.BuildDirTree("/", TreeOptions{Symlinks: SymlinkFollow})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	if node, ok := findNode(tree, "escape"); !ok || !node.IsSymlink || len(node.Children) != 0 {
+		t.Errorf("escaping link was followed: %+v", node)
+	}
+	if node, ok := findNode(tree, "src/main.go"); !ok || node.Path != "/src/main.go" {
+		t.Errorf("unexpected node for src/main.go: %+v", node)
+	}
+	results, err := fsys.SearchFiles("/", "secret", SearchOptions{Symlinks: SymlinkFollow})
+	if err != nil || len(results) != 0 {
+		t.Errorf("search read outside the root: %+v, %v", results, err)
+	}
+
+	// Writes, patches and deletes stay inside the root, and deleting a link keeps its target.
+	if err := fsys.CreateDir("/pkg/util"); err != nil {
+		t.Fatalf("CreateDir failed: %v", err)
+	}
+	if err := fsys.WriteFile("/pkg/util/util.go", []byte("package util\n")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := fsys.ApplyPatch(FileEditRequest{
+		FilePath: "/pkg/util/util.go",
+		Edits:    []EditInstruction{{Action: "insert", LineNumber: 2, NewContent: "// Package util helps."}},
+	}, false, false, false); err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "pkg/util/util.go")); string(data) != "package util\n// Package util helps.\n" {
+		t.Errorf("unexpected patched content: %q", data)
+	}
+
+	// Writes replace files rather than their content, keep modes and write through links
+	// inside the root, and leave no temporary files behind.
+	if err := os.Link(filepath.Join(dir, "src/main.go"), filepath.Join(dir, "main.old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "src/main.go"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("src/main.ln", []byte("package app\n")); err != nil {
+		t.Fatalf("WriteFile through a link failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "main.old")); string(data) != "package main\n" {
+		t.Errorf("write was not atomic, the old file now has %q", data)
+	}
+	if info, err := os.Lstat(filepath.Join(dir, "src/main.ln")); err != nil || !isSymlink(info) {
+		t.Errorf("writing through a link replaced it: %v, %v", info, err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "src/main.go"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("written file has mode %v, %v, want 0600", info, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "src")); len(entries) != 2 {
+		t.Errorf("unexpected entries after writing: %v", entries)
+	}
+	if err := fsys.DeleteDir("escape"); err != nil {
+		t.Fatalf("DeleteDir failed: %v", err)
+	}
+	if err := fsys.DeleteDir("/pkg"); err != nil {
+		t.Fatalf("DeleteDir failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "secret.txt")); err != nil {
+		t.Errorf("deleting a link removed its target: %v", err)
+	}
+	if _, err := backend.Stat("pkg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("deleted directory still exists: %v", err)
+	}
+}
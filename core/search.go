@@ -2,9 +2,9 @@ package core
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"io/fs"
-	"os"
+	"io"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -25,23 +25,39 @@ type SearchOptions struct {
 	MatchCase      bool `json:"match_case"`
 	MatchWholeWord bool `json:"match_whole_word"`
 	UseRegex       bool `json:"use_regex"`
+	// Symlinks selects how symbolic links are handled and defaults to SymlinkList, under
+	// which linked files are searched but linked directories are not.
+	Symlinks SymlinkPolicy `json:"symlinks,omitempty"`
 }
 
 // worker is a goroutine that processes files from the files channel and sends results to the results channel.
-func worker(wg *sync.WaitGroup, files <-chan string, results chan<- SearchResult, matcher func(string) bool) {
+// Files that cannot be read are skipped, except when reading them exceeds a quota, which is
+// reported to fail.
+func worker(wg *sync.WaitGroup, backend Backend, files <-chan string, results chan<- SearchResult, matcher func(string) bool, fail func(error)) {
 	defer wg.Done()
 	for file := range files {
-		if IsBinary(file) {
+		f, err := backend.Open(file)
+		if err != nil {
+			if errors.Is(err, ErrQuotaExceeded) {
+				fail(err)
+			}
+			// skip files we can't open
 			continue
 		}
 
-		f, err := os.Open(file)
-		if err != nil {
-			// skip files we can't open
+		// The start of the file is checked for binary content through the same reader
+		// the lines are scanned from, so that it is read only once.
+		reader := bufio.NewReader(f)
+		head, err := reader.Peek(binaryCheckSize)
+		if errors.Is(err, ErrQuotaExceeded) {
+			fail(err)
+		}
+		if err != nil && !errors.Is(err, io.EOF) || isBinaryContent(head) {
+			f.Close()
 			continue
 		}
 
-		scanner := bufio.NewScanner(f)
+		scanner := bufio.NewScanner(reader)
 		lineNumber := 0
 		for scanner.Scan() {
 			lineNumber++
@@ -55,11 +71,31 @@ func worker(wg *sync.WaitGroup, files <-chan string, results chan<- SearchResult
 				}
 			}
 		}
+		if err := scanner.Err(); errors.Is(err, ErrQuotaExceeded) {
+			fail(err)
+		}
 		f.Close()
 	}
 }
 
-func search(rootPath, query string, options SearchOptions) ([]SearchResult, error) {
+func search(backend Backend, rootPath, query string, options SearchOptions) ([]SearchResult, error) {
+	backend = forOperation(backend, AuditSearch)
+	results, err := searchFiles(backend, rootPath, query, options)
+	event := AuditEvent{Op: AuditSearch, Path: rootPath, Query: query, Matches: len(results)}
+	if err := recordAudit(backend, event, err); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func searchFiles(backend Backend, rootPath, query string, options SearchOptions) ([]SearchResult, error) {
+	if err := checkAccess(backend, PolicySearch, rootPath); err != nil {
+		return nil, err
+	}
+	if err := startSearch(backend, rootPath); err != nil {
+		return nil, err
+	}
+
 	var wg sync.WaitGroup
 	results := make(chan SearchResult)
 	files := make(chan string)
@@ -100,23 +136,22 @@ func search(rootPath, query string, options SearchOptions) ([]SearchResult, erro
 	}
 
 	// Start a pool of workers.
+	var failure error
+	var failOnce sync.Once
+	fail := func(err error) {
+		failOnce.Do(func() { failure = err })
+	}
 	numWorkers := runtime.NumCPU()
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go worker(&wg, files, results, matcher)
+		go worker(&wg, backend, files, results, matcher, fail)
 	}
 
 	// Walk the directory tree and send file paths to the files channel.
 	go func() {
 		defer close(files)
-		filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return nil
-			}
-			if !d.IsDir() {
-				files <- path
-			}
-			return nil
+		walkFiles(backend, rootPath, options.Symlinks, func(path string) {
+			files <- path
 		})
 	}()
 
@@ -131,6 +166,9 @@ func search(rootPath, query string, options SearchOptions) ([]SearchResult, erro
 	for result := range results {
 		searchResults = append(searchResults, result)
 	}
+	if failure != nil {
+		return nil, failure
+	}
 
 	return searchResults, nil
 }
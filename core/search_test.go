@@ -143,6 +143,49 @@ func TestSearchRegex(t *testing.T) {
 	assertResults(t, results, expected)
 }
 
+func TestSearchSymlinks(t *testing.T) {
+	tempDir := setupSearchTest(t)
+	if err := os.Symlink("subdir", filepath.Join(tempDir, "linked")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	if err := os.Symlink("..", filepath.Join(tempDir, "subdir", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file1.txt", filepath.Join(tempDir, "file1-link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Listed links to files are read, as filepath.WalkDir did, but linked directories are not.
+	listed, err := SearchFiles(tempDir, "another hello", SearchOptions{})
+	if err != nil {
+		t.Fatalf("SearchFiles returned an error: %v", err)
+	}
+	assertResults(t, listed, []SearchResult{
+		{FilePath: filepath.Join(tempDir, "file1-link.txt"), FileName: "file1-link.txt", LineNumber: 2, LineContent: "line two has another hello"},
+		{FilePath: filepath.Join(tempDir, "file1.txt"), FileName: "file1.txt", LineNumber: 2, LineContent: "line two has another hello"},
+		{FilePath: filepath.Join(tempDir, "subdir", "file3.txt"), FileName: "file3.txt", LineNumber: 1, LineContent: "another hello for the test"},
+	})
+
+	skipped, err := SearchFiles(tempDir, "two has another", SearchOptions{Symlinks: SymlinkSkip})
+	if err != nil {
+		t.Fatalf("SearchFiles returned an error: %v", err)
+	}
+	assertResults(t, skipped, []SearchResult{
+		{FilePath: filepath.Join(tempDir, "file1.txt"), FileName: "file1.txt", LineNumber: 2, LineContent: "line two has another hello"},
+	})
+
+	// Following links finds subdir again through the link, but the loop back to the
+	// root is not followed.
+	followed, err := SearchFiles(tempDir, "another hello for", SearchOptions{Symlinks: SymlinkFollow})
+	if err != nil {
+		t.Fatalf("SearchFiles returned an error: %v", err)
+	}
+	assertResults(t, followed, []SearchResult{
+		{FilePath: filepath.Join(tempDir, "linked", "file3.txt"), FileName: "file3.txt", LineNumber: 1, LineContent: "another hello for the test"},
+		{FilePath: filepath.Join(tempDir, "subdir", "file3.txt"), FileName: "file3.txt", LineNumber: 1, LineContent: "another hello for the test"},
+	})
+}
+
 func TestSearchNoResults(t *testing.T) {
 	tempDir := setupSearchTest(t)
 	options := SearchOptions{}
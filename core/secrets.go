@@ -0,0 +1,414 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SecretPattern detects one kind of secret. If Regexp has a capture group, the first
+// group is the secret and the rest of the match its context; otherwise the whole match is
+// the secret.
+type SecretPattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// DefaultSecretPatterns are the patterns of NewSecretScanner.
+var DefaultSecretPatterns = []SecretPattern{
+	{"private-key", regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----(?s:.*?)-----END (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+	{"aws-access-key-id", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`)},
+	{"aws-secret-access-key", regexp.MustCompile(`(?i)aws[\w.-]{0,20}?(?:secret|private)[\w.-]{0,20}?["']?\s*[:=]+\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+}
+
+// highEntropyToken matches the candidates of the high-entropy check.
+var highEntropyToken = regexp.MustCompile(`[A-Za-z0-9+/=_-]+`)
+
+// integrityHash matches content hashes such as the "h1:" hashes of go.sum, the "sha512-"
+// integrity values of package-lock.json and yarn.lock, and "sha256:" digests. They are
+// random-looking by design but not secret, so the high-entropy check skips them.
+var integrityHash = regexp.MustCompile(`\b(?:h1:[A-Za-z0-9+/]+=*|sha(?:1|224|256|384|512)(?:-[A-Za-z0-9+/]+=*|:[A-Za-z0-9+/]+=*))`)
+
+// entropyMargin is how far below the highest possible entropy of a token the entropy
+// threshold goes. Random alphanumeric tokens of 20 characters fall short of the highest
+// possible entropy by less than this in 99% of cases.
+const entropyMargin = 0.7
+
+// redactionPlaceholder matches the placeholders Redact replaces secrets with.
+var redactionPlaceholder = regexp.MustCompile(`\[REDACTED:[a-z0-9-]+\]`)
+
+// Secret is a secret found in content.
+type Secret struct {
+	Name  string // name of the pattern that found it, or "high-entropy"
+	Value string
+	Start int // byte offset of the secret
+	End   int // byte offset just past the secret
+}
+
+// SecretScanner finds secrets in content by pattern and by entropy.
+type SecretScanner struct {
+	Patterns []SecretPattern
+	// MinEntropy is the Shannon entropy in bits per character from which tokens of at least
+	// MinEntropyLength characters mixing letters and digits are reported as "high-entropy"
+	// secrets. As a token of n characters has at most log2(n) bits per character, the
+	// threshold is lowered to log2(n)-0.7 for shorter tokens, which nearly all random
+	// alphanumeric tokens exceed. Content hashes like those of go.sum and lockfiles are
+	// not reported. Zero disables the check.
+	MinEntropy       float64
+	MinEntropyLength int
+}
+
+// NewSecretScanner returns a scanner for the DefaultSecretPatterns and the given patterns
+// that also reports random-looking tokens of 20 or more characters.
+func NewSecretScanner(patterns ...SecretPattern) *SecretScanner {
+	return &SecretScanner{
+		Patterns:         append(append([]SecretPattern{}, DefaultSecretPatterns...), patterns...),
+		MinEntropy:       4.5,
+		MinEntropyLength: 20,
+	}
+}
+
+// AddPattern compiles expr and adds it to the patterns under name.
+func (s *SecretScanner) AddPattern(name, expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid secret pattern %s: %w", name, err)
+	}
+	s.Patterns = append(s.Patterns, SecretPattern{Name: name, Regexp: re})
+	return nil
+}
+
+// Find returns the secrets in data ordered by offset. Where secrets overlap, those found
+// by a pattern are kept over high-entropy tokens, and otherwise the one that starts first,
+// or the longer one.
+func (s *SecretScanner) Find(data []byte) []Secret {
+	var found []Secret
+	for _, pattern := range s.Patterns {
+		for _, match := range pattern.Regexp.FindAllSubmatchIndex(data, -1) {
+			start, end := match[0], match[1]
+			if len(match) >= 4 && match[2] >= 0 {
+				start, end = match[2], match[3]
+			}
+			found = append(found, Secret{Name: pattern.Name, Value: string(data[start:end]), Start: start, End: end})
+		}
+	}
+	if s.MinEntropy > 0 {
+		patterns := found
+		var hashes []Secret
+		for _, match := range integrityHash.FindAllIndex(data, -1) {
+			hashes = append(hashes, Secret{Start: match[0], End: match[1]})
+		}
+		for _, match := range highEntropyToken.FindAllIndex(data, -1) {
+			token := string(data[match[0]:match[1]])
+			if overlapsSecret(patterns, match[0], match[1]) {
+				continue // the pattern names the secret better
+			}
+			if overlapsSecret(hashes, match[0], match[1]) {
+				continue
+			}
+			if len(token) >= s.MinEntropyLength && mixesLettersAndDigits(token) && shannonEntropy(token) >= s.entropyThreshold(len(token)) {
+				found = append(found, Secret{Name: "high-entropy", Value: token, Start: match[0], End: match[1]})
+			}
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Start != found[j].Start {
+			return found[i].Start < found[j].Start
+		}
+		return found[i].End > found[j].End
+	})
+	var secrets []Secret
+	for _, secret := range found {
+		if len(secrets) > 0 && secret.Start < secrets[len(secrets)-1].End {
+			continue
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets
+}
+
+// entropyThreshold returns the entropy from which a token of n characters is reported.
+func (s *SecretScanner) entropyThreshold(n int) float64 {
+	return math.Min(s.MinEntropy, math.Log2(float64(n))-entropyMargin)
+}
+
+// Redact replaces every secret in data with a placeholder naming its kind, such as
+// "[REDACTED:jwt]". Line breaks inside a secret are kept after the placeholder so that
+// line numbers stay the same.
+func (s *SecretScanner) Redact(data []byte) []byte {
+	secrets := s.Find(data)
+	if len(secrets) == 0 {
+		return data
+	}
+	var out bytes.Buffer
+	last := 0
+	for _, secret := range secrets {
+		out.Write(data[last:secret.Start])
+		out.WriteString("[REDACTED:" + secret.Name + "]")
+		out.WriteString(strings.Repeat("\n", strings.Count(secret.Value, "\n")))
+		last = secret.End
+	}
+	out.Write(data[last:])
+	return out.Bytes()
+}
+
+// overlapsSecret reports whether the bytes from start to end overlap any of secrets.
+func overlapsSecret(secrets []Secret, start, end int) bool {
+	for _, secret := range secrets {
+		if start < secret.End && secret.Start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// mixesLettersAndDigits reports whether s contains both a letter and a digit.
+func mixesLettersAndDigits(s string) bool {
+	letter, digit := false, false
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digit = true
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			letter = true
+		}
+	}
+	return letter && digit
+}
+
+// shannonEntropy returns the entropy of s in bits per character.
+func shannonEntropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// ErrSecretDetected matches every *SecretError with errors.Is.
+var ErrSecretDetected = errors.New("secret detected")
+
+// SecretError is returned by a RedactBackend for writes it refuses.
+type SecretError struct {
+	Path    string
+	Secrets []string // kinds of the secrets the write would introduce
+	// Placeholders is set when the content contains redaction placeholders the file did not,
+	// as when content read through the backend is written back.
+	Placeholders bool
+}
+
+func (e *SecretError) Error() string {
+	if e.Placeholders {
+		return fmt.Sprintf("refusing to write %s: content contains redaction placeholders", e.Path)
+	}
+	return fmt.Sprintf("refusing to write %s: content introduces secrets (%s)", e.Path, strings.Join(e.Secrets, ", "))
+}
+
+// Is reports whether target is ErrSecretDetected.
+func (e *SecretError) Is(target error) bool {
+	return target == ErrSecretDetected
+}
+
+// RedactBackend masks the secrets in the content read from another backend, so that they
+// do not end up in what agents send to an LLM. ReadFile, ReadFileLines, ReadLines,
+// searches and context packs see redacted content, and searches cannot match secrets.
+// Patches edit the real content, so their line numbers match what was read.
+//
+// Writes are guarded: content introducing secrets the file did not contain, or
+// redaction placeholders, is refused with a *SecretError.
+type RedactBackend struct {
+	backend Backend
+	scanner *SecretScanner
+	op      string // the operation of a view, see withOperation
+}
+
+// NewRedactBackend returns backend redacted by scanner, or by NewSecretScanner() if
+// scanner is nil.
+func NewRedactBackend(backend Backend, scanner *SecretScanner) *RedactBackend {
+	if scanner == nil {
+		scanner = NewSecretScanner()
+	}
+	return &RedactBackend{backend: backend, scanner: scanner}
+}
+
+// Scanner returns the scanner finding secrets.
+func (r *RedactBackend) Scanner() *SecretScanner {
+	return r.scanner
+}
+
+func (r *RedactBackend) unwrap() Backend {
+	return r.backend
+}
+
+func (r *RedactBackend) withOperation(op string, inner Backend) Backend {
+	view := *r
+	view.backend = inner
+	view.op = op
+	return &view
+}
+
+// redacts reports whether reads are redacted, which they are except in patches, copies
+// and trees.
+func (r *RedactBackend) redacts() bool {
+	return r.op != AuditPatch && r.op != AuditCopy && r.op != AuditTree
+}
+
+// Open opens a file for reading, redacting its content.
+func (r *RedactBackend) Open(name string) (fs.File, error) {
+	f, err := r.backend.Open(name)
+	if err != nil || !r.redacts() {
+		return f, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return f, err
+	}
+	f.Close()
+	data, err := r.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryFile{
+		info:   memoryFileInfo{name: info.Name(), size: int64(len(data)), mode: info.Mode(), modTime: info.ModTime()},
+		reader: bytes.NewReader(data),
+	}, nil
+}
+
+// Stat returns the file info of a path, following links.
+func (r *RedactBackend) Stat(name string) (fs.FileInfo, error) {
+	return r.backend.Stat(name)
+}
+
+// Lstat returns the file info of a path without following a final link.
+func (r *RedactBackend) Lstat(name string) (fs.FileInfo, error) {
+	return r.backend.Lstat(name)
+}
+
+// ReadDir returns the entries of a directory sorted by name.
+func (r *RedactBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return r.backend.ReadDir(name)
+}
+
+// ReadFile returns the redacted content of a file.
+func (r *RedactBackend) ReadFile(name string) ([]byte, error) {
+	data, err := r.backend.ReadFile(name)
+	if err != nil || !r.redacts() {
+		return data, err
+	}
+	return r.scanner.Redact(data), nil
+}
+
+// ReadLink returns the target of a symbolic link.
+func (r *RedactBackend) ReadLink(name string) (string, error) {
+	return r.backend.ReadLink(name)
+}
+
+// WriteFile writes a file unless the content introduces secrets or redaction placeholders.
+// Copies, which write the real content of another file, are not checked.
+func (r *RedactBackend) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	backend, err := writableBackend(r.backend, "write", name)
+	if err != nil {
+		return err
+	}
+	// Copies write the real content of another file rather than new content.
+	if r.op != AuditCopy {
+		old, _ := r.backend.ReadFile(name)
+		if err := r.checkWrite(name, old, data); err != nil {
+			return err
+		}
+	}
+	return backend.WriteFile(name, data, perm)
+}
+
+// checkWrite returns a *SecretError if replacing old with data introduces secrets or
+// redaction placeholders.
+func (r *RedactBackend) checkWrite(name string, old, data []byte) error {
+	if len(redactionPlaceholder.FindAll(data, -1)) > len(redactionPlaceholder.FindAll(old, -1)) {
+		return &SecretError{Path: name, Placeholders: true}
+	}
+	existing := map[string]bool{}
+	for _, secret := range r.scanner.Find(old) {
+		existing[secret.Value] = true
+	}
+	var introduced []string
+	for _, secret := range r.scanner.Find(data) {
+		if !existing[secret.Value] && !slices.Contains(introduced, secret.Name) {
+			introduced = append(introduced, secret.Name)
+		}
+	}
+	if len(introduced) > 0 {
+		return &SecretError{Path: name, Secrets: introduced}
+	}
+	return nil
+}
+
+// MkdirAll creates a directory along with any missing parents.
+func (r *RedactBackend) MkdirAll(name string, perm fs.FileMode) error {
+	backend, err := writableBackend(r.backend, "mkdir", name)
+	if err != nil {
+		return err
+	}
+	return backend.MkdirAll(name, perm)
+}
+
+// Remove removes a file or an empty directory.
+func (r *RedactBackend) Remove(name string) error {
+	backend, err := writableBackend(r.backend, "remove", name)
+	if err != nil {
+		return err
+	}
+	return backend.Remove(name)
+}
+
+// RemoveAll removes a path and everything below it.
+func (r *RedactBackend) RemoveAll(name string) error {
+	backend, err := writableBackend(r.backend, "remove", name)
+	if err != nil {
+		return err
+	}
+	return backend.RemoveAll(name)
+}
+
+// Rename moves a file or directory.
+func (r *RedactBackend) Rename(oldname, newname string) error {
+	backend, err := writableBackend(r.backend, "rename", oldname)
+	if err != nil {
+		return err
+	}
+	return backend.Rename(oldname, newname)
+}
+
+// Chmod changes the mode of a file or directory.
+func (r *RedactBackend) Chmod(name string, mode fs.FileMode) error {
+	backend, err := writableBackend(r.backend, "chmod", name)
+	if err != nil {
+		return err
+	}
+	return backend.Chmod(name, mode)
+}
+
+// Chtimes changes the modification time of a file or directory.
+func (r *RedactBackend) Chtimes(name string, modTime time.Time) error {
+	backend, err := writableBackend(r.backend, "chtimes", name)
+	if err != nil {
+		return err
+	}
+	return backend.Chtimes(name, modTime)
+}
+
+var _ WritableBackend = (*RedactBackend)(nil)
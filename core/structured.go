@@ -0,0 +1,380 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Structured edit operations. The RFC 6902 names are accepted so that JSON Patch
+// documents decode directly into StructuredEdit values.
+const (
+	OpSet     = "set"     // set the value at Path, creating missing parent objects
+	OpDelete  = "delete"  // delete the value at Path
+	OpAppend  = "append"  // append Value to the array at Path
+	OpMerge   = "merge"   // merge the object Value into the object at Path (RFC 7396 semantics)
+	OpAdd     = "add"     // RFC 6902 add
+	OpRemove  = "remove"  // RFC 6902 remove
+	OpReplace = "replace" // RFC 6902 replace
+	OpMove    = "move"    // RFC 6902 move
+	OpCopy    = "copy"    // RFC 6902 copy
+	OpTest    = "test"    // RFC 6902 test
+)
+
+// Supported structured file formats.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// ErrPathNotFound is returned when a structured edit path does not resolve to a value.
+var ErrPathNotFound = errors.New("path not found")
+
+// StructuredEdit represents a single path-based edit of a structured document.
+// Paths are either JSON Pointers ("/servers/0/port") or JSONPath-style
+// expressions ("$.servers[0].port" or "servers[0].port").
+type StructuredEdit struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"` // source path for move and copy
+	Value any    `json:"value,omitempty"`
+}
+
+// StructuredEditRequest represents the structured edits to apply to a file.
+// Format is optional and detected from the file extension when empty.
+type StructuredEditRequest struct {
+	FilePath string           `json:"file_path"`
+	Format   string           `json:"format,omitempty"`
+	Edits    []StructuredEdit `json:"edits"`
+}
+
+// structuredDoc is a parsed document that can be edited by path while keeping
+// as much of its original formatting as the format allows.
+type structuredDoc interface {
+	// get returns the value at path as plain Go values (maps, slices and scalars).
+	get(path []string) (any, error)
+	// set replaces or creates the value at path. An array index equal to the
+	// array length, or "-", appends.
+	set(path []string, value any) error
+	// add behaves like set for object members but inserts for array indexes.
+	add(path []string, value any) error
+	// remove deletes the value at path.
+	remove(path []string) error
+	// encode renders the document back to bytes.
+	encode() ([]byte, error)
+}
+
+// detectStructuredFormat returns the structured format for a file, honoring an explicit format.
+func detectStructuredFormat(path, format string) (string, error) {
+	if format != "" {
+		format = strings.ToLower(format)
+		if format == "yml" {
+			format = FormatYAML
+		}
+	} else {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			format = FormatJSON
+		case ".yaml", ".yml":
+			format = FormatYAML
+		case ".toml":
+			format = FormatTOML
+		}
+	}
+	switch format {
+	case FormatJSON, FormatYAML, FormatTOML:
+		return format, nil
+	case "":
+		return "", fmt.Errorf("cannot detect structured format for %s", path)
+	default:
+		return "", fmt.Errorf("unsupported structured format %q", format)
+	}
+}
+
+// parseStructuredDoc parses content in the given format.
+func parseStructuredDoc(format string, content []byte) (structuredDoc, error) {
+	switch format {
+	case FormatJSON:
+		return parseJSONDoc(content)
+	case FormatYAML:
+		return parseYAMLDoc(content)
+	case FormatTOML:
+		return parseTOMLDoc(content)
+	}
+	return nil, fmt.Errorf("unsupported structured format %q", format)
+}
+
+// parseStructuredPath splits a JSON Pointer or JSONPath-style expression into segments.
+func parseStructuredPath(path string) ([]string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" || path == "/" || path == "$" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(path, "/") {
+		parts := strings.Split(path[1:], "/")
+		for i, part := range parts {
+			parts[i] = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		}
+		return parts, nil
+	}
+
+	path = strings.TrimPrefix(path, "$")
+	var segments []string
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			i++
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unterminated bracket", path)
+			}
+			segment := path[i+1 : i+end]
+			if len(segment) >= 2 && (segment[0] == '\'' || segment[0] == '"') && segment[len(segment)-1] == segment[0] {
+				segment = segment[1 : len(segment)-1]
+			}
+			segments = append(segments, segment)
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			segments = append(segments, path[i:i+end])
+			i += end
+		}
+	}
+	return segments, nil
+}
+
+// normalizeStructuredValue converts an arbitrary Go value into plain JSON-compatible
+// values (map[string]any, []any, json.Number, string, bool and nil).
+func normalizeStructuredValue(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var normalized any
+	if err := decoder.Decode(&normalized); err != nil {
+		return nil, fmt.Errorf("invalid value: %w", err)
+	}
+	return normalized, nil
+}
+
+// arrayIndex resolves an array path segment against an array of the given length.
+// When allowEnd is set, "-" and an index equal to the length are accepted.
+func arrayIndex(segment string, length int, allowEnd bool) (int, error) {
+	if segment == "-" && allowEnd {
+		return length, nil
+	}
+	index, err := strconv.Atoi(segment)
+	if err != nil || index < 0 || index > length || (index == length && !allowEnd) {
+		return 0, fmt.Errorf("invalid array index %q: %w", segment, ErrPathNotFound)
+	}
+	return index, nil
+}
+
+// applyStructuredEdit applies a single edit to a document.
+func applyStructuredEdit(doc structuredDoc, edit StructuredEdit) error {
+	path, err := parseStructuredPath(edit.Path)
+	if err != nil {
+		return err
+	}
+	value, err := normalizeStructuredValue(edit.Value)
+	if err != nil {
+		return err
+	}
+
+	switch edit.Op {
+	case OpSet:
+		return doc.set(path, value)
+	case OpDelete, OpRemove:
+		return doc.remove(path)
+	case OpAppend:
+		current, err := doc.get(path)
+		if errors.Is(err, ErrPathNotFound) {
+			return doc.set(path, []any{value})
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := current.([]any); !ok {
+			return fmt.Errorf("cannot append to %s: not an array", edit.Path)
+		}
+		return doc.set(append(path, "-"), value)
+	case OpMerge:
+		return mergeStructured(doc, path, value)
+	case OpAdd:
+		return doc.add(path, value)
+	case OpReplace:
+		if _, err := doc.get(path); err != nil {
+			return err
+		}
+		return doc.set(path, value)
+	case OpMove, OpCopy:
+		from, err := parseStructuredPath(edit.From)
+		if err != nil {
+			return err
+		}
+		moved, err := doc.get(from)
+		if err != nil {
+			return err
+		}
+		if edit.Op == OpMove {
+			if err := doc.remove(from); err != nil {
+				return err
+			}
+		}
+		return doc.add(path, moved)
+	case OpTest:
+		current, err := doc.get(path)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(normalizeNumbers(current), normalizeNumbers(value)) {
+			return fmt.Errorf("test failed for %s", edit.Path)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid structured edit operation %q", edit.Op)
+}
+
+// mergeStructured merges patch into the value at path following RFC 7396:
+// null members are removed, objects are merged recursively and anything else replaces.
+func mergeStructured(doc structuredDoc, path []string, patch any) error {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return doc.set(path, patch)
+	}
+
+	current, err := doc.get(path)
+	if err != nil && !errors.Is(err, ErrPathNotFound) {
+		return err
+	}
+	if _, isObject := current.(map[string]any); !isObject {
+		if err := doc.set(path, map[string]any{}); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range sortedKeys(patchObject) {
+		childPath := append(append([]string{}, path...), key)
+		if patchObject[key] == nil {
+			if err := doc.remove(childPath); err != nil && !errors.Is(err, ErrPathNotFound) {
+				return err
+			}
+			continue
+		}
+		if err := mergeStructured(doc, childPath, patchObject[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeNumbers converts json.Number and other numeric values to float64 so that
+// values decoded from different formats compare equal.
+func normalizeNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case map[string]any:
+		normalized := make(map[string]any, len(v))
+		for key, child := range v {
+			normalized[key] = normalizeNumbers(child)
+		}
+		return normalized
+	case []any:
+		normalized := make([]any, len(v))
+		for i, child := range v {
+			normalized[i] = normalizeNumbers(child)
+		}
+		return normalized
+	}
+	return value
+}
+
+// parseJSONPatch decodes an RFC 6902 JSON Patch document.
+func parseJSONPatch(data []byte) ([]StructuredEdit, error) {
+	var edits []StructuredEdit
+	if err := json.Unmarshal(data, &edits); err != nil {
+		return nil, fmt.Errorf("invalid JSON Patch document: %w", err)
+	}
+	for i, edit := range edits {
+		switch edit.Op {
+		case OpAdd, OpRemove, OpReplace, OpMove, OpCopy, OpTest:
+		default:
+			return nil, fmt.Errorf("invalid JSON Patch operation %q at index %d", edit.Op, i)
+		}
+	}
+	return edits, nil
+}
+
+// parseMergePatch decodes an RFC 7396 JSON Merge Patch document into a single merge edit.
+func parseMergePatch(data []byte) ([]StructuredEdit, error) {
+	var patch any
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, fmt.Errorf("invalid JSON Merge Patch document: %w", err)
+	}
+	return []StructuredEdit{{Op: OpMerge, Path: "", Value: patch}}, nil
+}
+
+// structuredEditWorkflow reads, edits and writes back a structured file.
+func structuredEditWorkflow(backend WritableBackend, request StructuredEditRequest, verbose, prompt, highlight bool) error {
+	backend = forOperation(backend, AuditPatch)
+
+	format, err := detectStructuredFormat(request.FilePath, request.Format)
+	if err != nil {
+		return err
+	}
+
+	content, err := readFile(backend, request.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", request.FilePath, err)
+	}
+
+	doc, err := parseStructuredDoc(format, content)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", request.FilePath, err)
+	}
+
+	for i, edit := range request.Edits {
+		if err := applyStructuredEdit(doc, edit); err != nil {
+			return fmt.Errorf("edit %d (%s %s) failed for %s: %w", i, edit.Op, edit.Path, request.FilePath, err)
+		}
+	}
+
+	updated, err := doc.encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", request.FilePath, err)
+	}
+
+	return writeContentWorkflow(backend, request.FilePath, content, updated, verbose, prompt, highlight)
+}
+
+// sortedKeys returns the keys of a map in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
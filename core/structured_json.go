@@ -0,0 +1,358 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// jsonNode is an order-preserving JSON value. Objects keep their keys in document order
+// so that editing a file does not reshuffle it.
+type jsonNode struct {
+	kind   byte // '{' for objects, '[' for arrays, 0 for scalars
+	keys   []string
+	values []*jsonNode     // object member values, parallel to keys
+	items  []*jsonNode     // array items
+	raw    json.RawMessage // scalar value
+}
+
+// jsonDoc is a structuredDoc for JSON files.
+type jsonDoc struct {
+	root            *jsonNode
+	indent          string
+	trailingNewline bool
+}
+
+// parseJSONDoc parses JSON content, remembering its indentation style.
+func parseJSONDoc(content []byte) (*jsonDoc, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	root, err := decodeJSONNode(decoder, content)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return &jsonDoc{
+		root:            root,
+		indent:          detectIndent(content),
+		trailingNewline: bytes.HasSuffix(content, []byte("\n")),
+	}, nil
+}
+
+// detectIndent returns the indentation unit used by the first indented line, or an empty
+// string if the content is not indented.
+func detectIndent(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return ""
+}
+
+// decodeJSONNode decodes the next value from the decoder into a jsonNode. Scalars keep
+// their original spelling from content, which must be the decoder's input.
+func decodeJSONNode(decoder *json.Decoder, content []byte) (*jsonNode, error) {
+	start := decoder.InputOffset()
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			node := &jsonNode{kind: '{'}
+			for decoder.More() {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeJSONNode(decoder, content)
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, keyToken.(string))
+				node.values = append(node.values, value)
+			}
+			_, err = decoder.Token()
+			return node, err
+		case '[':
+			node := &jsonNode{kind: '['}
+			for decoder.More() {
+				item, err := decodeJSONNode(decoder, content)
+				if err != nil {
+					return nil, err
+				}
+				node.items = append(node.items, item)
+			}
+			_, err = decoder.Token()
+			return node, err
+		}
+		return nil, fmt.Errorf("unexpected delimiter %v", t)
+	default:
+		raw := bytes.TrimLeft(content[start:decoder.InputOffset()], " \t\r\n,:")
+		return &jsonNode{raw: raw}, nil
+	}
+}
+
+// newJSONNode builds a jsonNode from a plain Go value.
+func newJSONNode(value any) (*jsonNode, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	decoder.UseNumber()
+	return decodeJSONNode(decoder, buf.Bytes())
+}
+
+// value converts the node back into plain Go values.
+func (n *jsonNode) value() any {
+	switch n.kind {
+	case '{':
+		object := make(map[string]any, len(n.keys))
+		for i, key := range n.keys {
+			object[key] = n.values[i].value()
+		}
+		return object
+	case '[':
+		array := make([]any, len(n.items))
+		for i, item := range n.items {
+			array[i] = item.value()
+		}
+		return array
+	}
+	decoder := json.NewDecoder(bytes.NewReader(n.raw))
+	decoder.UseNumber()
+	var value any
+	decoder.Decode(&value)
+	return value
+}
+
+// member returns the index of key in an object node, or -1.
+func (n *jsonNode) member(key string) int {
+	for i, k := range n.keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// lookup walks path and returns the node found there.
+func (d *jsonDoc) lookup(path []string) (*jsonNode, error) {
+	node := d.root
+	for _, segment := range path {
+		switch node.kind {
+		case '{':
+			i := node.member(segment)
+			if i < 0 {
+				return nil, fmt.Errorf("key %q: %w", segment, ErrPathNotFound)
+			}
+			node = node.values[i]
+		case '[':
+			i, err := arrayIndex(segment, len(node.items), false)
+			if err != nil {
+				return nil, err
+			}
+			node = node.items[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into scalar at %q: %w", segment, ErrPathNotFound)
+		}
+	}
+	return node, nil
+}
+
+// parent returns the container holding the last segment of path, creating missing objects
+// along the way when create is set.
+func (d *jsonDoc) parent(path []string, create bool) (*jsonNode, error) {
+	node := d.root
+	for _, segment := range path[:len(path)-1] {
+		switch node.kind {
+		case '{':
+			i := node.member(segment)
+			if i < 0 {
+				if !create {
+					return nil, fmt.Errorf("key %q: %w", segment, ErrPathNotFound)
+				}
+				node.keys = append(node.keys, segment)
+				node.values = append(node.values, &jsonNode{kind: '{'})
+				i = len(node.keys) - 1
+			}
+			node = node.values[i]
+		case '[':
+			i, err := arrayIndex(segment, len(node.items), false)
+			if err != nil {
+				return nil, err
+			}
+			node = node.items[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into scalar at %q: %w", segment, ErrPathNotFound)
+		}
+	}
+	return node, nil
+}
+
+func (d *jsonDoc) get(path []string) (any, error) {
+	node, err := d.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return node.value(), nil
+}
+
+func (d *jsonDoc) set(path []string, value any) error {
+	return d.put(path, value, false)
+}
+
+func (d *jsonDoc) add(path []string, value any) error {
+	return d.put(path, value, true)
+}
+
+// put stores value at path, inserting into arrays when insert is set.
+func (d *jsonDoc) put(path []string, value any, insert bool) error {
+	node, err := newJSONNode(value)
+	if err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		d.root = node
+		return nil
+	}
+
+	parent, err := d.parent(path, !insert)
+	if err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+	switch parent.kind {
+	case '{':
+		if i := parent.member(last); i >= 0 {
+			parent.values[i] = node
+		} else {
+			parent.keys = append(parent.keys, last)
+			parent.values = append(parent.values, node)
+		}
+	case '[':
+		i, err := arrayIndex(last, len(parent.items), true)
+		if err != nil {
+			return err
+		}
+		if i < len(parent.items) && !insert {
+			parent.items[i] = node
+		} else {
+			parent.items = append(parent.items[:i], append([]*jsonNode{node}, parent.items[i:]...)...)
+		}
+	default:
+		return fmt.Errorf("cannot set %q on a scalar: %w", last, ErrPathNotFound)
+	}
+	return nil
+}
+
+func (d *jsonDoc) remove(path []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("cannot remove the document root")
+	}
+	parent, err := d.parent(path, false)
+	if err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+	switch parent.kind {
+	case '{':
+		i := parent.member(last)
+		if i < 0 {
+			return fmt.Errorf("key %q: %w", last, ErrPathNotFound)
+		}
+		parent.keys = append(parent.keys[:i], parent.keys[i+1:]...)
+		parent.values = append(parent.values[:i], parent.values[i+1:]...)
+	case '[':
+		i, err := arrayIndex(last, len(parent.items), false)
+		if err != nil {
+			return err
+		}
+		parent.items = append(parent.items[:i], parent.items[i+1:]...)
+	default:
+		return fmt.Errorf("cannot remove %q from a scalar: %w", last, ErrPathNotFound)
+	}
+	return nil
+}
+
+func (d *jsonDoc) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.root.write(&buf, d.indent, 0); err != nil {
+		return nil, err
+	}
+	if d.trailingNewline {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// write renders the node with the given indentation unit; an empty unit renders compactly.
+func (n *jsonNode) write(buf *bytes.Buffer, indent string, depth int) error {
+	newline := func(depth int) {
+		if indent != "" {
+			buf.WriteByte('\n')
+			buf.WriteString(strings.Repeat(indent, depth))
+		}
+	}
+
+	switch n.kind {
+	case '{':
+		if len(n.keys) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteByte('{')
+		for i, key := range n.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			newline(depth + 1)
+			keyBytes, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			buf.Write(keyBytes)
+			buf.WriteByte(':')
+			if indent != "" {
+				buf.WriteByte(' ')
+			}
+			if err := n.values[i].write(buf, indent, depth+1); err != nil {
+				return err
+			}
+		}
+		newline(depth)
+		buf.WriteByte('}')
+	case '[':
+		if len(n.items) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i, item := range n.items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			newline(depth + 1)
+			if err := item.write(buf, indent, depth+1); err != nil {
+				return err
+			}
+		}
+		newline(depth)
+		buf.WriteByte(']')
+	default:
+		buf.Write(n.raw)
+	}
+	return nil
+}
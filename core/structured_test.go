@@ -0,0 +1,275 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeStructuredFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readStructuredFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestParseStructuredPath(t *testing.T) {
+	tests := map[string][]string{
+		"":                  nil,
+		"$":                 nil,
+		"/servers/0/port":   {"servers", "0", "port"},
+		"/a~1b/c~0d":        {"a/b", "c~d"},
+		"$.servers[0].port": {"servers", "0", "port"},
+		"servers[0].port":   {"servers", "0", "port"},
+		"$['a.b'].c":        {"a.b", "c"},
+	}
+	for input, expected := range tests {
+		segments, err := parseStructuredPath(input)
+		if err != nil {
+			t.Errorf("parseStructuredPath(%q) failed: %v", input, err)
+			continue
+		}
+		if !reflect.DeepEqual(segments, expected) {
+			t.Errorf("parseStructuredPath(%q) = %q, want %q", input, segments, expected)
+		}
+	}
+
+	if _, err := parseStructuredPath("a[0"); err == nil {
+		t.Error("Expected an error for an unterminated bracket")
+	}
+}
+
+func TestApplyStructuredEdit_JSON(t *testing.T) {
+	path := writeStructuredFile(t, "config.json", "{\n    \"name\": \"app\",\n    \"tags\": [\"a\"],\n    \"db\": {\"host\": \"localhost\", \"port\": 5432},\n    \"debug\": true\n}\n")
+
+	request := StructuredEditRequest{
+		FilePath: path,
+		Edits: []StructuredEdit{
+			{Op: OpSet, Path: "$.db.port", Value: 6543},
+			{Op: OpAppend, Path: "/tags", Value: "b"},
+			{Op: OpDelete, Path: "debug"},
+			{Op: OpSet, Path: "cache.ttl", Value: 30},
+		},
+	}
+	if err := ApplyStructuredEdit(request, false, false, false); err != nil {
+		t.Fatalf("ApplyStructuredEdit failed: %v", err)
+	}
+
+	expected := "{\n    \"name\": \"app\",\n    \"tags\": [\n        \"a\",\n        \"b\"\n    ],\n    \"db\": {\n        \"host\": \"localhost\",\n        \"port\": 6543\n    },\n    \"cache\": {\n        \"ttl\": 30\n    }\n}\n"
+	if got := readStructuredFile(t, path); got != expected {
+		t.Errorf("ApplyStructuredEdit mismatch:\ngot\n%s\nwant\n%s", got, expected)
+	}
+}
+
+func TestApplyStructuredEdit_JSONErrors(t *testing.T) {
+	path := writeStructuredFile(t, "config.json", `{"a": 1}`)
+
+	err := ApplyStructuredEdit(StructuredEditRequest{FilePath: path, Edits: []StructuredEdit{{Op: OpDelete, Path: "/missing"}}}, false, false, false)
+	if !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+
+	err = ApplyStructuredEdit(StructuredEditRequest{FilePath: path, Edits: []StructuredEdit{{Op: OpAppend, Path: "/a", Value: 2}}}, false, false, false)
+	if err == nil {
+		t.Error("Expected an error when appending to a scalar")
+	}
+
+	err = ApplyStructuredEdit(StructuredEditRequest{FilePath: path, Edits: []StructuredEdit{{Op: "bogus", Path: "/a"}}}, false, false, false)
+	if err == nil {
+		t.Error("Expected an error for an invalid operation")
+	}
+
+	if got := readStructuredFile(t, path); got != `{"a": 1}` {
+		t.Errorf("File should be unchanged after failed edits, got %s", got)
+	}
+
+	err = ApplyStructuredEdit(StructuredEditRequest{FilePath: writeStructuredFile(t, "config.ini", "a=1")}, false, false, false)
+	if err == nil {
+		t.Error("Expected an error for an undetectable format")
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	path := writeStructuredFile(t, "doc.json", `{"a":{"b":1},"list":[1,2,3],"keep":"x"}`)
+
+	edits, err := ParseJSONPatch([]byte(`[
+		{"op": "test", "path": "/keep", "value": "x"},
+		{"op": "add", "path": "/list/1", "value": 9},
+		{"op": "remove", "path": "/list/3"},
+		{"op": "replace", "path": "/a/b", "value": 2},
+		{"op": "copy", "from": "/a", "path": "/c"},
+		{"op": "move", "from": "/keep", "path": "/moved"}
+	]`))
+	if err != nil {
+		t.Fatalf("ParseJSONPatch failed: %v", err)
+	}
+
+	if err = ApplyStructuredEdit(StructuredEditRequest{FilePath: path, Edits: edits}, false, false, false); err != nil {
+		t.Fatalf("ApplyStructuredEdit failed: %v", err)
+	}
+
+	expected := `{"a":{"b":2},"list":[1,9,2],"c":{"b":2},"moved":"x"}`
+	if got := readStructuredFile(t, path); got != expected {
+		t.Errorf("JSON Patch mismatch:\ngot  %s\nwant %s", got, expected)
+	}
+
+	if _, err = ParseJSONPatch([]byte(`[{"op": "set", "path": "/a"}]`)); err == nil {
+		t.Error("Expected an error for a non-RFC 6902 operation")
+	}
+
+	edits, _ = ParseJSONPatch([]byte(`[{"op": "test", "path": "/moved", "value": "y"}]`))
+	if err = ApplyStructuredEdit(StructuredEditRequest{FilePath: path, Edits: edits}, false, false, false); err == nil {
+		t.Error("Expected a failed test operation to return an error")
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	path := writeStructuredFile(t, "doc.json", `{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"This will be unchanged"}`)
+
+	edits, err := ParseMergePatch([]byte(`{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`))
+	if err != nil {
+		t.Fatalf("ParseMergePatch failed: %v", err)
+	}
+	if err = ApplyStructuredEdit(StructuredEditRequest{FilePath: path, Edits: edits}, false, false, false); err != nil {
+		t.Fatalf("ApplyStructuredEdit failed: %v", err)
+	}
+
+	expected := `{"title":"Hello!","author":{"givenName":"John"},"tags":["example"],"content":"This will be unchanged","phoneNumber":"+01-123-456-7890"}`
+	if got := readStructuredFile(t, path); got != expected {
+		t.Errorf("Merge Patch mismatch:\ngot  %s\nwant %s", got, expected)
+	}
+}
+
+func TestApplyStructuredEdit_YAML(t *testing.T) {
+	content := `# service configuration
+name: app # the service name
+server:
+  host: localhost
+  port: 8080 # default port
+plugins:
+  - auth
+`
+	path := writeStructuredFile(t, "config.yaml", content)
+
+	request := StructuredEditRequest{
+		FilePath: path,
+		Edits: []StructuredEdit{
+			{Op: OpSet, Path: "server.port", Value: 9090},
+			{Op: OpAppend, Path: "plugins", Value: "metrics"},
+			{Op: OpMerge, Path: "server", Value: map[string]any{"host": nil, "tls": true}},
+		},
+	}
+	if err := ApplyStructuredEdit(request, false, false, false); err != nil {
+		t.Fatalf("ApplyStructuredEdit failed: %v", err)
+	}
+
+	expected := `# service configuration
+name: app # the service name
+server:
+  port: 9090 # default port
+  tls: true
+plugins:
+  - auth
+  - metrics
+`
+	if got := readStructuredFile(t, path); got != expected {
+		t.Errorf("ApplyStructuredEdit mismatch:\ngot\n%s\nwant\n%s", got, expected)
+	}
+}
+
+func TestApplyStructuredEdit_TOML(t *testing.T) {
+	content := `# top comment
+title = "example"
+
+[server]
+host = "localhost" # where to listen
+port = 8080
+tags = ["a", "b"]
+
+[database]
+url = "postgres://"
+`
+	path := writeStructuredFile(t, "config.toml", content)
+
+	request := StructuredEditRequest{
+		FilePath: path,
+		Edits: []StructuredEdit{
+			{Op: OpSet, Path: "server.host", Value: "0.0.0.0"},
+			{Op: OpAppend, Path: "server.tags", Value: "c"},
+			{Op: OpSet, Path: "server.timeout", Value: 30},
+			{Op: OpDelete, Path: "database"},
+			{Op: OpSet, Path: "cache", Value: map[string]any{"size": 10}},
+		},
+	}
+	if err := ApplyStructuredEdit(request, false, false, false); err != nil {
+		t.Fatalf("ApplyStructuredEdit failed: %v", err)
+	}
+
+	expected := `# top comment
+title = "example"
+
+[server]
+host = "0.0.0.0" # where to listen
+port = 8080
+tags = ["a", "b", "c"]
+timeout = 30
+
+[cache]
+size = 10
+`
+	if got := readStructuredFile(t, path); got != expected {
+		t.Errorf("ApplyStructuredEdit mismatch:\ngot\n%s\nwant\n%s", got, expected)
+	}
+
+	doc, err := parseTOMLDoc([]byte(expected))
+	if err != nil {
+		t.Fatalf("parseTOMLDoc failed: %v", err)
+	}
+	value, err := doc.get([]string{"server"})
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	server := value.(map[string]any)
+	if server["port"] != int64(8080) || !reflect.DeepEqual(server["tags"], []any{"a", "b", "c"}) {
+		t.Errorf("Unexpected server table: %v", server)
+	}
+
+	err = ApplyStructuredEdit(StructuredEditRequest{FilePath: path, Edits: []StructuredEdit{{Op: OpSet, Path: "title", Value: nil}}}, false, false, false)
+	if err == nil || !strings.Contains(err.Error(), "null") {
+		t.Errorf("Expected a null value error for TOML, got %v", err)
+	}
+}
+
+func TestDiffHunks(t *testing.T) {
+	oldLines := []string{"a", "b", "c", "d", "e", "f", "g"}
+	newLines := []string{"a", "b", "C", "d", "e", "f", "g", "h"}
+
+	hunks := diffHunks(diffLines(oldLines, newLines), 2)
+	if len(hunks) != 2 {
+		t.Fatalf("Expected 2 hunks, got %d", len(hunks))
+	}
+	first := hunks[0]
+	if first.oldStart != 1 || !reflect.DeepEqual(first.topLines, []string{"a", "b"}) ||
+		!reflect.DeepEqual(first.original, []string{"c"}) || !reflect.DeepEqual(first.updated, []string{"C"}) ||
+		!reflect.DeepEqual(first.bottomLines, []string{"d", "e"}) {
+		t.Errorf("Unexpected first hunk: %+v", first)
+	}
+	second := hunks[1]
+	if second.newStart != 6 || second.original != nil || !reflect.DeepEqual(second.updated, []string{"h"}) {
+		t.Errorf("Unexpected second hunk: %+v", second)
+	}
+}
@@ -0,0 +1,802 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tomlDoc is a structuredDoc for TOML files. Rather than re-encoding the whole document,
+// it edits the affected lines in place so comments, ordering and layout elsewhere in the
+// file are left untouched. Arrays of tables ([[name]]) are not addressable.
+type tomlDoc struct {
+	lines []string
+}
+
+// tomlEntry is a key/value pair located in a TOML document.
+type tomlEntry struct {
+	path       []string // table path followed by the (possibly dotted) key
+	start, end int      // first and last line of the entry
+	value      string   // raw value text without the trailing comment
+	comment    string   // trailing comment, including the leading '#'
+	prefix     string   // everything up to and including the '=' sign
+}
+
+// tomlTable is a [table] header located in a TOML document.
+type tomlTable struct {
+	path       []string
+	start, end int // header line and last line of the section
+	array      bool
+}
+
+// parseTOMLDoc splits TOML content into lines and checks that it can be indexed.
+func parseTOMLDoc(content []byte) (*tomlDoc, error) {
+	doc := &tomlDoc{lines: strings.Split(string(content), "\n")}
+	if _, _, err := doc.index(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// index locates every key/value entry and table header in the document.
+func (d *tomlDoc) index() ([]tomlEntry, []tomlTable, error) {
+	var entries []tomlEntry
+	var tables []tomlTable
+	var current []string
+	inArrayTable := false
+
+	for i := 0; i < len(d.lines); i++ {
+		line := strings.TrimSpace(d.lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			header, _ := splitTOMLComment(line)
+			array := strings.HasPrefix(header, "[[")
+			name := strings.TrimSuffix(strings.TrimPrefix(header, "["), "]")
+			if array {
+				name = strings.TrimSuffix(strings.TrimPrefix(name, "["), "]")
+			}
+			path, err := parseTOMLKey(name)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if len(tables) > 0 {
+				tables[len(tables)-1].end = i - 1
+			}
+			tables = append(tables, tomlTable{path: path, start: i, end: len(d.lines) - 1, array: array})
+			current = path
+			inArrayTable = array
+			continue
+		}
+
+		eq := tomlKeyEnd(d.lines[i])
+		if eq < 0 {
+			return nil, nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		key, err := parseTOMLKey(d.lines[i][:eq])
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		end := tomlValueEnd(d.lines, i, eq+1)
+		text := strings.Join(d.lines[i:end+1], "\n")[eq+1:]
+		value, comment := splitTOMLComment(text)
+		if !inArrayTable {
+			entries = append(entries, tomlEntry{
+				path:    append(append([]string{}, current...), key...),
+				start:   i,
+				end:     end,
+				value:   value,
+				comment: comment,
+				prefix:  d.lines[i][:eq+1],
+			})
+		}
+		i = end
+	}
+	return entries, tables, nil
+}
+
+// tomlKeyEnd returns the index of the '=' separating key and value, or -1.
+func tomlKeyEnd(line string) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return i
+		}
+	}
+	return -1
+}
+
+// tomlValueEnd returns the last line of a value starting at column col of line start,
+// following multi-line strings and arrays or inline tables spanning several lines.
+func tomlValueEnd(lines []string, start, col int) int {
+	depth := 0
+	inString := ""
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		if i == start {
+			line = line[col:]
+		}
+		for j := 0; j < len(line); j++ {
+			rest := line[j:]
+			switch {
+			case inString != "":
+				if inString == `"` && line[j] == '\\' {
+					j++
+				} else if strings.HasPrefix(rest, inString) {
+					j += len(inString) - 1
+					inString = ""
+				}
+			case strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, `'''`):
+				inString = rest[:3]
+				j += 2
+			case line[j] == '"' || line[j] == '\'':
+				inString = line[j : j+1]
+			case line[j] == '#':
+				j = len(line)
+			case line[j] == '[' || line[j] == '{':
+				depth++
+			case line[j] == ']' || line[j] == '}':
+				depth--
+			}
+		}
+		if len(inString) == 1 {
+			inString = "" // single-line strings cannot span lines
+		}
+		if depth <= 0 && inString == "" {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
+
+// splitTOMLComment separates a value from a trailing comment.
+func splitTOMLComment(text string) (value, comment string) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if quote == '"' && c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i:])
+		}
+	}
+	return strings.TrimSpace(text), ""
+}
+
+// parseTOMLKey splits a bare, quoted or dotted key into its segments.
+func parseTOMLKey(key string) ([]string, error) {
+	var segments []string
+	for _, part := range splitTOMLTopLevel(key, '.') {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+			return nil, fmt.Errorf("invalid key %q", key)
+		case part[0] == '"':
+			unquoted, err := strconv.Unquote(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %q: %w", key, err)
+			}
+			part = unquoted
+		case part[0] == '\'':
+			part = strings.Trim(part, "'")
+		}
+		segments = append(segments, part)
+	}
+	return segments, nil
+}
+
+// splitTOMLTopLevel splits s on sep, ignoring separators inside strings, arrays and inline tables.
+func splitTOMLTopLevel(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	depth, last := 0, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if quote == '"' && c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// formatTOMLKey renders a key segment, quoting it when it is not a valid bare key.
+func formatTOMLKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for _, c := range key {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return quoteTOMLString(key)
+		}
+	}
+	return key
+}
+
+// quoteTOMLString renders s as a TOML basic string.
+func quoteTOMLString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, c)
+			} else {
+				b.WriteRune(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// parseTOMLValue decodes a TOML value. Dates and times are returned as strings.
+func parseTOMLValue(text string) (any, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return nil, fmt.Errorf("missing value")
+	case strings.HasPrefix(text, `"""`) || strings.HasPrefix(text, `'''`):
+		body := strings.TrimPrefix(text[3:len(text)-3], "\n")
+		if text[0] == '\'' {
+			return body, nil
+		}
+		return strconv.Unquote(`"` + strings.ReplaceAll(strings.ReplaceAll(body, `"`, `\"`), "\n", `\n`) + `"`)
+	case text[0] == '"':
+		return strconv.Unquote(text)
+	case text[0] == '\'':
+		return strings.Trim(text, "'"), nil
+	case text == "true" || text == "false":
+		return text == "true", nil
+	case text[0] == '[':
+		var array []any
+		for _, item := range splitTOMLTopLevel(text[1:len(text)-1], ',') {
+			item, _ = splitTOMLComment(stripTOMLLineComments(item))
+			if item == "" {
+				continue
+			}
+			value, err := parseTOMLValue(item)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		if array == nil {
+			array = []any{}
+		}
+		return array, nil
+	case text[0] == '{':
+		table := map[string]any{}
+		for _, member := range splitTOMLTopLevel(text[1:len(text)-1], ',') {
+			if strings.TrimSpace(member) == "" {
+				continue
+			}
+			eq := tomlKeyEnd(member)
+			if eq < 0 {
+				return nil, fmt.Errorf("invalid inline table %q", text)
+			}
+			key, err := parseTOMLKey(member[:eq])
+			if err != nil {
+				return nil, err
+			}
+			value, err := parseTOMLValue(member[eq+1:])
+			if err != nil {
+				return nil, err
+			}
+			setNestedValue(table, key, value)
+		}
+		return table, nil
+	}
+
+	number := strings.ReplaceAll(text, "_", "")
+	if i, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return i, nil
+	}
+	switch number {
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return f, nil
+	}
+	return text, nil
+}
+
+// stripTOMLLineComments removes comments from every line of a multi-line array item.
+func stripTOMLLineComments(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i], _ = splitTOMLComment(line)
+	}
+	return strings.Join(lines, " ")
+}
+
+// encodeTOMLValue renders a plain Go value as an inline TOML value.
+func encodeTOMLValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", fmt.Errorf("TOML cannot represent null values")
+	case string:
+		return quoteTOMLString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			encoded, err := encodeTOMLValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = encoded
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case map[string]any:
+		members := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			encoded, err := encodeTOMLValue(v[key])
+			if err != nil {
+				return "", err
+			}
+			members = append(members, formatTOMLKey(key)+" = "+encoded)
+		}
+		if len(members) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(members, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("unsupported TOML value of type %T", value)
+}
+
+// setNestedValue stores value in m under the nested key path.
+func setNestedValue(m map[string]any, path []string, value any) {
+	for _, segment := range path[:len(path)-1] {
+		child, ok := m[segment].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			m[segment] = child
+		}
+		m = child
+	}
+	m[path[len(path)-1]] = value
+}
+
+// hasPathPrefix reports whether path starts with prefix.
+func hasPathPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalPaths reports whether two paths are identical.
+func equalPaths(a, b []string) bool {
+	return len(a) == len(b) && hasPathPrefix(a, b)
+}
+
+func (d *tomlDoc) get(path []string) (any, error) {
+	entries, tables, err := d.index()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(path) > 0 {
+		for _, entry := range entries {
+			if hasPathPrefix(path, entry.path) {
+				value, err := parseTOMLValue(entry.value)
+				if err != nil || equalPaths(path, entry.path) {
+					return value, err
+				}
+				return lookupValue(value, path[len(entry.path):])
+			}
+		}
+	}
+
+	// The path names a table: collect every entry underneath it.
+	table := map[string]any{}
+	found := len(path) == 0
+	for _, t := range tables {
+		if !t.array && hasPathPrefix(t.path, path) {
+			found = true
+			if len(t.path) > len(path) {
+				setNestedValue(table, t.path[len(path):], map[string]any{})
+			}
+		}
+	}
+	for _, entry := range entries {
+		if hasPathPrefix(entry.path, path) && len(entry.path) > len(path) {
+			value, err := parseTOMLValue(entry.value)
+			if err != nil {
+				return nil, err
+			}
+			setNestedValue(table, entry.path[len(path):], value)
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("key %q: %w", strings.Join(path, "."), ErrPathNotFound)
+	}
+	return table, nil
+}
+
+// lookupValue descends into a decoded value along path.
+func lookupValue(value any, path []string) (any, error) {
+	for _, segment := range path {
+		switch v := value.(type) {
+		case map[string]any:
+			child, ok := v[segment]
+			if !ok {
+				return nil, fmt.Errorf("key %q: %w", segment, ErrPathNotFound)
+			}
+			value = child
+		case []any:
+			i, err := arrayIndex(segment, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into scalar at %q: %w", segment, ErrPathNotFound)
+		}
+	}
+	return value, nil
+}
+
+func (d *tomlDoc) set(path []string, value any) error {
+	return d.put(path, value, false)
+}
+
+func (d *tomlDoc) add(path []string, value any) error {
+	return d.put(path, value, true)
+}
+
+// put stores value at path. Values inside inline arrays and tables are edited by
+// rewriting the enclosing entry.
+func (d *tomlDoc) put(path []string, value any, insert bool) error {
+	if len(path) == 0 {
+		table, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("the root of a TOML document must be a table")
+		}
+		d.lines = nil
+		return d.writeTable(nil, table)
+	}
+
+	entries, _, err := d.index()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if equalPaths(path, entry.path) {
+			if table, ok := value.(map[string]any); ok {
+				d.deleteLines(entry.start, entry.end)
+				return d.writeTable(path, table)
+			}
+			return d.replaceEntry(entry, value)
+		}
+		if hasPathPrefix(path, entry.path) {
+			current, err := parseTOMLValue(entry.value)
+			if err != nil {
+				return err
+			}
+			updated, err := putValue(current, path[len(entry.path):], value, insert)
+			if err != nil {
+				return err
+			}
+			return d.replaceEntry(entry, updated)
+		}
+	}
+
+	if table, ok := value.(map[string]any); ok {
+		if err := d.remove(path); err != nil && !errors.Is(err, ErrPathNotFound) {
+			return err
+		}
+		return d.writeTable(path, table)
+	}
+	return d.insertEntry(path[:len(path)-1], path[len(path)-1], value)
+}
+
+// putValue returns a copy of container with value stored at path.
+func putValue(container any, path []string, value any, insert bool) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch v := container.(type) {
+	case map[string]any:
+		child, err := putValue(v[path[0]], path[1:], value, insert)
+		if err != nil {
+			return nil, err
+		}
+		v[path[0]] = child
+		return v, nil
+	case []any:
+		last := len(path) == 1
+		i, err := arrayIndex(path[0], len(v), last)
+		if err != nil {
+			return nil, err
+		}
+		if last && (insert || i == len(v)) {
+			return append(v[:i], append([]any{value}, v[i:]...)...), nil
+		}
+		child, err := putValue(v[i], path[1:], value, insert)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = child
+		return v, nil
+	case nil:
+		return putValue(map[string]any{}, path, value, insert)
+	}
+	return nil, fmt.Errorf("cannot set %q on a scalar: %w", path[0], ErrPathNotFound)
+}
+
+// removeValue returns a copy of container with the value at path removed.
+func removeValue(container any, path []string) (any, error) {
+	switch v := container.(type) {
+	case map[string]any:
+		if _, ok := v[path[0]]; !ok {
+			return nil, fmt.Errorf("key %q: %w", path[0], ErrPathNotFound)
+		}
+		if len(path) == 1 {
+			delete(v, path[0])
+			return v, nil
+		}
+		child, err := removeValue(v[path[0]], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		v[path[0]] = child
+		return v, nil
+	case []any:
+		i, err := arrayIndex(path[0], len(v), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			return append(v[:i], v[i+1:]...), nil
+		}
+		child, err := removeValue(v[i], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		v[i] = child
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot remove %q from a scalar: %w", path[0], ErrPathNotFound)
+}
+
+// replaceEntry rewrites the value of an existing entry, keeping its key spelling and comment.
+func (d *tomlDoc) replaceEntry(entry tomlEntry, value any) error {
+	encoded, err := encodeTOMLValue(value)
+	if err != nil {
+		return err
+	}
+	line := strings.TrimRight(entry.prefix, " ") + " " + encoded
+	if entry.comment != "" {
+		line += " " + entry.comment
+	}
+	d.lines = append(d.lines[:entry.start], append([]string{line}, d.lines[entry.end+1:]...)...)
+	return nil
+}
+
+// insertEntry adds key = value to the given table, creating the table if needed.
+func (d *tomlDoc) insertEntry(table []string, key string, value any) error {
+	encoded, err := encodeTOMLValue(value)
+	if err != nil {
+		return err
+	}
+	line := formatTOMLKey(key) + " = " + encoded
+
+	entries, tables, err := d.index()
+	if err != nil {
+		return err
+	}
+
+	// Insert after the last entry of the table, or right after its header.
+	at := -1
+	for _, entry := range entries {
+		if equalPaths(entry.path[:len(entry.path)-1], table) {
+			at = entry.end + 1
+		}
+	}
+	if at < 0 {
+		for _, t := range tables {
+			if !t.array && equalPaths(t.path, table) {
+				at = t.start + 1
+			}
+		}
+	}
+	if at < 0 && len(table) == 0 {
+		at = 0
+		if len(tables) > 0 {
+			at = tables[0].start
+			line += "\n"
+		}
+	}
+	if at < 0 {
+		return d.writeTable(table, map[string]any{key: value})
+	}
+
+	d.lines = append(d.lines[:at], append(strings.Split(line, "\n"), d.lines[at:]...)...)
+	return nil
+}
+
+// writeTable appends table as a [path] section at the end of the document, with nested
+// tables written as their own sections.
+func (d *tomlDoc) writeTable(path []string, table map[string]any) error {
+	var section []string
+	var nested []string
+	for _, key := range sortedKeys(table) {
+		if _, ok := table[key].(map[string]any); ok {
+			nested = append(nested, key)
+			continue
+		}
+		encoded, err := encodeTOMLValue(table[key])
+		if err != nil {
+			return err
+		}
+		section = append(section, formatTOMLKey(key)+" = "+encoded)
+	}
+
+	if len(path) > 0 && (len(section) > 0 || len(nested) == 0) {
+		keys := make([]string, len(path))
+		for i, segment := range path {
+			keys[i] = formatTOMLKey(segment)
+		}
+		section = append([]string{"[" + strings.Join(keys, ".") + "]"}, section...)
+	}
+
+	// Keep the document's trailing newline at the very end.
+	trailing := len(d.lines) > 0 && d.lines[len(d.lines)-1] == ""
+	if trailing {
+		d.lines = d.lines[:len(d.lines)-1]
+	}
+	if len(section) > 0 {
+		if len(d.lines) > 0 && strings.TrimSpace(d.lines[len(d.lines)-1]) != "" && len(path) > 0 {
+			d.lines = append(d.lines, "")
+		}
+		d.lines = append(d.lines, section...)
+	}
+	if trailing {
+		d.lines = append(d.lines, "")
+	}
+
+	sort.Strings(nested)
+	for _, key := range nested {
+		if err := d.writeTable(append(append([]string{}, path...), key), table[key].(map[string]any)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteLines removes lines start through end.
+func (d *tomlDoc) deleteLines(start, end int) {
+	d.lines = append(d.lines[:start], d.lines[end+1:]...)
+}
+
+func (d *tomlDoc) remove(path []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("cannot remove the document root")
+	}
+
+	entries, tables, err := d.index()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if equalPaths(path, entry.path) {
+			d.deleteLines(entry.start, entry.end)
+			return nil
+		}
+		if hasPathPrefix(path, entry.path) {
+			current, err := parseTOMLValue(entry.value)
+			if err != nil {
+				return err
+			}
+			updated, err := removeValue(current, path[len(entry.path):])
+			if err != nil {
+				return err
+			}
+			return d.replaceEntry(entry, updated)
+		}
+	}
+
+	// Remove the table: its sections, sub-tables and dotted keys, from the bottom up so
+	// that line numbers stay valid.
+	var spans [][2]int
+	for _, t := range tables {
+		if hasPathPrefix(t.path, path) {
+			spans = append(spans, [2]int{t.start, t.end})
+		}
+	}
+	for _, entry := range entries {
+		if hasPathPrefix(entry.path, path) && !insideSpans(entry.start, spans) {
+			spans = append(spans, [2]int{entry.start, entry.end})
+		}
+	}
+	if len(spans) == 0 {
+		return fmt.Errorf("key %q: %w", strings.Join(path, "."), ErrPathNotFound)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] > spans[j][0] })
+	for _, span := range spans {
+		d.deleteLines(span[0], span[1])
+	}
+	return nil
+}
+
+// insideSpans reports whether line falls within any of the spans.
+func insideSpans(line int, spans [][2]int) bool {
+	for _, span := range spans {
+		if line >= span[0] && line <= span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *tomlDoc) encode() ([]byte, error) {
+	return []byte(strings.Join(d.lines, "\n")), nil
+}
@@ -0,0 +1,228 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlDoc is a structuredDoc for YAML files. It edits the yaml.v3 node tree directly,
+// which keeps comments and key order intact.
+type yamlDoc struct {
+	root   yaml.Node
+	indent int
+}
+
+// parseYAMLDoc parses YAML content, remembering its indentation width.
+func parseYAMLDoc(content []byte) (*yamlDoc, error) {
+	doc := &yamlDoc{indent: len(detectIndent(content))}
+	if doc.indent < 2 {
+		doc.indent = 2
+	}
+	if err := yaml.Unmarshal(content, &doc.root); err != nil {
+		return nil, err
+	}
+	if doc.root.Kind == 0 {
+		// Empty document: start from an empty mapping.
+		doc.root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	return doc, nil
+}
+
+// newYAMLNode builds a yaml.Node from a plain Go value.
+func newYAMLNode(value any) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(normalizeYAMLValue(value)); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// normalizeYAMLValue converts json.Number values, which yaml.v3 would quote, into
+// integers or floats.
+func normalizeYAMLValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		return normalizeNumbers(v)
+	case map[string]any:
+		normalized := make(map[string]any, len(v))
+		for key, child := range v {
+			normalized[key] = normalizeYAMLValue(child)
+		}
+		return normalized
+	case []any:
+		normalized := make([]any, len(v))
+		for i, child := range v {
+			normalized[i] = normalizeYAMLValue(child)
+		}
+		return normalized
+	}
+	return value
+}
+
+// resolveYAMLAlias follows alias nodes to the node they refer to.
+func resolveYAMLAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// yamlMember returns the index of the value node for key in a mapping node, or -1.
+func yamlMember(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// walk descends along path, creating missing mappings when create is set.
+func (d *yamlDoc) walk(path []string, create bool) (*yaml.Node, error) {
+	node := d.root.Content[0]
+	for _, segment := range path {
+		node = resolveYAMLAlias(node)
+		switch node.Kind {
+		case yaml.MappingNode:
+			i := yamlMember(node, segment)
+			if i < 0 {
+				if !create {
+					return nil, fmt.Errorf("key %q: %w", segment, ErrPathNotFound)
+				}
+				node.Content = append(node.Content,
+					&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: segment},
+					&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+				i = len(node.Content) - 1
+			}
+			node = node.Content[i]
+		case yaml.SequenceNode:
+			i, err := arrayIndex(segment, len(node.Content), false)
+			if err != nil {
+				return nil, err
+			}
+			node = node.Content[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into scalar at %q: %w", segment, ErrPathNotFound)
+		}
+	}
+	return resolveYAMLAlias(node), nil
+}
+
+func (d *yamlDoc) get(path []string) (any, error) {
+	node, err := d.walk(path, false)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+	return normalizeStructuredValue(value)
+}
+
+func (d *yamlDoc) set(path []string, value any) error {
+	return d.put(path, value, false)
+}
+
+func (d *yamlDoc) add(path []string, value any) error {
+	return d.put(path, value, true)
+}
+
+// put stores value at path, inserting into sequences when insert is set. Comments
+// attached to a replaced value are carried over to the new value.
+func (d *yamlDoc) put(path []string, value any, insert bool) error {
+	node, err := newYAMLNode(value)
+	if err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		d.root.Content[0] = node
+		return nil
+	}
+
+	parent, err := d.walk(path[:len(path)-1], !insert)
+	if err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+	switch parent.Kind {
+	case yaml.MappingNode:
+		if i := yamlMember(parent, last); i >= 0 {
+			keepYAMLComments(parent.Content[i], node)
+			parent.Content[i] = node
+		} else {
+			parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last}, node)
+		}
+	case yaml.SequenceNode:
+		i, err := arrayIndex(last, len(parent.Content), true)
+		if err != nil {
+			return err
+		}
+		if i < len(parent.Content) && !insert {
+			keepYAMLComments(parent.Content[i], node)
+			parent.Content[i] = node
+		} else {
+			parent.Content = append(parent.Content[:i], append([]*yaml.Node{node}, parent.Content[i:]...)...)
+		}
+	default:
+		return fmt.Errorf("cannot set %q on a scalar: %w", last, ErrPathNotFound)
+	}
+	return nil
+}
+
+// keepYAMLComments copies the comments of old onto replacement.
+func keepYAMLComments(old, replacement *yaml.Node) {
+	replacement.HeadComment = old.HeadComment
+	replacement.LineComment = old.LineComment
+	replacement.FootComment = old.FootComment
+	if old.Kind == replacement.Kind {
+		replacement.Style = old.Style
+	}
+}
+
+func (d *yamlDoc) remove(path []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("cannot remove the document root")
+	}
+	parent, err := d.walk(path[:len(path)-1], false)
+	if err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+	switch parent.Kind {
+	case yaml.MappingNode:
+		i := yamlMember(parent, last)
+		if i < 0 {
+			return fmt.Errorf("key %q: %w", last, ErrPathNotFound)
+		}
+		parent.Content = append(parent.Content[:i-1], parent.Content[i+1:]...)
+	case yaml.SequenceNode:
+		i, err := arrayIndex(last, len(parent.Content), false)
+		if err != nil {
+			return err
+		}
+		parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+	default:
+		return fmt.Errorf("cannot remove %q from a scalar: %w", last, ErrPathNotFound)
+	}
+	return nil
+}
+
+func (d *yamlDoc) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(d.indent)
+	if err := encoder.Encode(&d.root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxLinks bounds the number of links evalSymlinks follows, so that cycles fail.
+const maxLinks = 255
+
+// SymlinkPolicy controls how symbolic links are treated when walking directories.
+// Deletions never follow links: removing a link only ever removes the link itself.
+type SymlinkPolicy string
+
+// Symlink policies supported by TreeOptions and SearchOptions.
+const (
+	// SymlinkList reports links as entries of their own without following them. It is
+	// the default. Trees show them as leaves with IsSymlink and LinkTarget set; searches
+	// read linked files but do not descend into linked directories.
+	SymlinkList SymlinkPolicy = "list"
+	// SymlinkSkip leaves links out entirely.
+	SymlinkSkip SymlinkPolicy = "skip"
+	// SymlinkFollow treats links like the files and directories they point to. A link
+	// to a directory that is already being walked is listed instead of followed, so
+	// cycles cannot recurse forever.
+	SymlinkFollow SymlinkPolicy = "follow"
+)
+
+// isSymlink reports whether info describes a symbolic link.
+func isSymlink(info fs.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink != 0
+}
+
+// symlinker is implemented by backends that can create symbolic links.
+type symlinker interface {
+	// symlink creates newname as a link to oldname.
+	symlink(oldname, newname string) error
+}
+
+// createSymlink creates newname as a link to oldname on the backend at the end of the
+// chain of backend. Every wrapper along the chain must be writable; policies are checked
+// for creating newname and audit logs record the link.
+func createSymlink(backend Backend, oldname, newname string) error {
+	if err := checkAccess(backend, PolicyCreate, newname); err != nil {
+		return err
+	}
+	var linker symlinker
+	for _, backend := range wrappedBackends(backend) {
+		if _, err := writableBackend(backend, "symlink", newname); err != nil {
+			return err
+		}
+		if l, ok := backend.(symlinker); ok {
+			linker = l
+			break
+		}
+	}
+	if linker == nil {
+		return &fs.PathError{Op: "symlink", Path: newname, Err: errors.ErrUnsupported}
+	}
+	err := linker.symlink(oldname, newname)
+	return recordAudit(backend, AuditEvent{Op: AuditSymlink, Path: newname, Target: oldname}, err)
+}
+
+// copySymlink recreates the link at src as a link with the same target at dst, replacing
+// any link already there.
+func copySymlink(backend WritableBackend, src, dst string) error {
+	target, err := backend.ReadLink(src)
+	if err != nil {
+		return err
+	}
+	if info, err := backend.Lstat(dst); err == nil && isSymlink(info) {
+		if err := backend.Remove(dst); err != nil {
+			return err
+		}
+	}
+	return createSymlink(backend, target, dst)
+}
+
+// evalSymlinks returns name with every link along it resolved through backend, like
+// filepath.EvalSymlinks. The first component that does not exist and everything after it
+// are kept as they are, so that where a new file would be created can be resolved too.
+func evalSymlinks(backend Backend, name string) (string, error) {
+	resolved, rest := splitRoot(filepath.Clean(name))
+	for links := 0; len(rest) > 0; {
+		next := filepath.Join(resolved, rest[0])
+		rest = rest[1:]
+		info, err := backend.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) {
+			return filepath.Join(append([]string{next}, rest...)...), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if !isSymlink(info) {
+			resolved = next
+			continue
+		}
+		if links++; links > maxLinks {
+			return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: errors.New("too many links")}
+		}
+		target, err := backend.ReadLink(next)
+		if err != nil {
+			return "", err
+		}
+		targetRoot, targetRest := splitRoot(filepath.Clean(target))
+		if filepath.IsAbs(target) {
+			resolved = targetRoot
+		}
+		rest = append(targetRest, rest...)
+	}
+	if resolved == "" {
+		return ".", nil
+	}
+	return resolved, nil
+}
+
+// splitRoot splits a clean path into its volume and root, empty for relative paths, and
+// its remaining components.
+func splitRoot(path string) (string, []string) {
+	root := filepath.VolumeName(path)
+	path = path[len(root):]
+	if strings.HasPrefix(path, string(filepath.Separator)) {
+		root += string(filepath.Separator)
+	}
+	var components []string
+	for _, component := range strings.Split(path, string(filepath.Separator)) {
+		if component != "" && component != "." {
+			components = append(components, component)
+		}
+	}
+	return root, components
+}
+
+// isVisited reports whether the directory described by info is one of the ancestors
+// currently being walked.
+func isVisited(info fs.FileInfo, ancestors []fs.FileInfo) bool {
+	for _, ancestor := range ancestors {
+		if os.SameFile(info, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+// withAncestor returns a copy of ancestors extended by info, safe to hand to another
+// goroutine while the original keeps growing.
+func withAncestor(ancestors []fs.FileInfo, info fs.FileInfo) []fs.FileInfo {
+	extended := make([]fs.FileInfo, len(ancestors), len(ancestors)+1)
+	copy(extended, ancestors)
+	return append(extended, info)
+}
+
+// walkFiles calls fn with the path of every regular file of backend below root, treating
+// links according to policy. Links to files are read through under SymlinkList, as only
+// links to directories can lead a walk elsewhere. Unreadable entries are skipped.
+func walkFiles(backend Backend, root string, policy SymlinkPolicy, fn func(path string)) {
+	info, err := backend.Stat(root)
+	if err != nil {
+		return
+	}
+	if !info.IsDir() {
+		fn(root)
+		return
+	}
+	walkFilesIn(backend, root, policy, []fs.FileInfo{info}, fn)
+}
+
+// walkFilesIn walks the directory at path, whose chain of directories from the root is
+// given by ancestors.
+func walkFilesIn(backend Backend, path string, policy SymlinkPolicy, ancestors []fs.FileInfo, fn func(path string)) {
+	entries, err := backend.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+		if checkAccess(backend, PolicySearch, child) != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if isSymlink(info) {
+			if policy == SymlinkSkip {
+				continue
+			}
+			if info, err = backend.Stat(child); err != nil {
+				continue // dangling link
+			}
+			if info.IsDir() && policy != SymlinkFollow {
+				continue
+			}
+		}
+		switch {
+		case info.IsDir():
+			if !isVisited(info, ancestors) {
+				walkFilesIn(backend, child, policy, withAncestor(ancestors, info), fn)
+			}
+		case info.Mode().IsRegular():
+			fn(child)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Tokenizer counts the tokens in a piece of text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// ApproxTokenizer estimates token counts from text length, assuming roughly four bytes
+// per token. It needs no vocabulary and is the default wherever a Tokenizer is optional.
+type ApproxTokenizer struct{}
+
+// CountTokens returns the approximate number of tokens in text.
+func (ApproxTokenizer) CountTokens(text string) int {
+	return approximateTokens(text)
+}
+
+// bpePattern splits text into the pieces that are tokenized independently. It follows
+// the GPT-style pre-tokenization rules, minus the lookaheads Go's regexp lacks.
+var bpePattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+`)
+
+// BPETokenizer is a byte-level byte pair encoding tokenizer driven by a ranked vocabulary.
+type BPETokenizer struct {
+	ranks map[string]int
+}
+
+// loadBPETokenizer reads a vocabulary in the tiktoken format: one token per line, given
+// as base64-encoded bytes followed by a space and its merge rank.
+func loadBPETokenizer(path string) (*BPETokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid vocabulary line %d in %s", lineNumber, path)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token on line %d in %s: %w", lineNumber, path, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank on line %d in %s: %w", lineNumber, path, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("vocabulary %s is empty", path)
+	}
+	return &BPETokenizer{ranks: ranks}, nil
+}
+
+// Encode splits text into tokens and returns their ranks. Bytes missing from the
+// vocabulary are reported as -1.
+func (t *BPETokenizer) Encode(text string) []int {
+	var ids []int
+	for _, piece := range bpePattern.FindAllString(text, -1) {
+		if rank, ok := t.ranks[piece]; ok {
+			ids = append(ids, rank)
+			continue
+		}
+		for _, part := range t.merge(piece) {
+			rank, ok := t.ranks[part]
+			if !ok {
+				rank = -1
+			}
+			ids = append(ids, rank)
+		}
+	}
+	return ids
+}
+
+// CountTokens returns the number of tokens in text.
+func (t *BPETokenizer) CountTokens(text string) int {
+	count := 0
+	for _, piece := range bpePattern.FindAllString(text, -1) {
+		if _, ok := t.ranks[piece]; ok {
+			count++
+		} else {
+			count += len(t.merge(piece))
+		}
+	}
+	return count
+}
+
+// merge applies byte pair merges to a piece, always merging the adjacent pair with the
+// lowest rank first, and returns the resulting parts.
+func (t *BPETokenizer) merge(piece string) []string {
+	parts := make([]string, len(piece))
+	for i := range piece {
+		parts[i] = piece[i : i+1]
+	}
+
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i+1 < len(parts); i++ {
+			if rank, ok := t.ranks[parts[i]+parts[i+1]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return parts
+}
+
+// annotateTreeTokens sets the estimated token count of every text file in the tree and
+// sums them up for directories. Binary files count as zero tokens. With the
+// ApproxTokenizer the estimate is derived from file sizes without reading the files, and
+// placeholders for omitted entries are always estimated from their size.
+func annotateTreeTokens(backend Backend, tree *DirectoryTree, tokenizer Tokenizer) error {
+	if tokenizer == nil {
+		tokenizer = ApproxTokenizer{}
+	}
+
+	if tree.Omitted != nil {
+		tree.Tokens = int((tree.Size + 3) / 4)
+		return nil
+	}
+
+	if tree.IsFile {
+		tree.Tokens = 0
+		if tree.IsBinary {
+			return nil
+		}
+		if _, ok := tokenizer.(ApproxTokenizer); ok {
+			tree.Tokens = int((tree.Size + 3) / 4)
+			return nil
+		}
+		content, err := readFile(backend, tree.Path)
+		if err != nil {
+			return err
+		}
+		tree.Tokens = tokenizer.CountTokens(string(content))
+		return nil
+	}
+
+	tree.Tokens = 0
+	for i := range tree.Children {
+		if err := annotateTreeTokens(backend, &tree.Children[i], tokenizer); err != nil {
+			return err
+		}
+		tree.Tokens += tree.Children[i].Tokens
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeVocab writes a tiktoken-format vocabulary containing every single byte followed
+// by the given merged tokens, in rank order.
+func writeVocab(t *testing.T, merged ...string) string {
+	t.Helper()
+	var b strings.Builder
+	rank := 0
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), rank)
+		rank++
+	}
+	for _, token := range merged {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+		rank++
+	}
+	path := filepath.Join(t.TempDir(), "vocab.tiktoken")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApproxTokenizer(t *testing.T) {
+	tokenizer := ApproxTokenizer{}
+	if n := tokenizer.CountTokens(""); n != 0 {
+		t.Errorf("Expected 0 tokens for empty text, got %d", n)
+	}
+	if n := tokenizer.CountTokens("hello world!"); n != 3 {
+		t.Errorf("Expected 3 tokens, got %d", n)
+	}
+}
+
+func TestBPETokenizer(t *testing.T) {
+	path := writeVocab(t, "he", "ll", "hell", "hello", " w", " wo")
+	tokenizer, err := LoadBPETokenizer(path)
+	if err != nil {
+		t.Fatalf("LoadBPETokenizer failed: %v", err)
+	}
+
+	// "hello" is a single token, " world" merges to " wo" + "r" + "l" + "d".
+	if n := tokenizer.CountTokens("hello world"); n != 5 {
+		t.Errorf("Expected 5 tokens, got %d", n)
+	}
+	ids := tokenizer.Encode("hello")
+	if len(ids) != 1 || ids[0] != 256+3 {
+		t.Errorf("Unexpected ids for hello: %v", ids)
+	}
+	if n := tokenizer.CountTokens("xyz"); n != 3 {
+		t.Errorf("Expected unmerged bytes to count individually, got %d", n)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.tiktoken")
+	os.WriteFile(bad, []byte("not-a-vocab-line\n"), 0644)
+	if _, err = LoadBPETokenizer(bad); err == nil {
+		t.Error("Expected an error for an invalid vocabulary")
+	}
+	if _, err = LoadBPETokenizer("non-existent-vocab"); err == nil {
+		t.Error("Expected an error for a missing vocabulary")
+	}
+}
+
+func TestAnnotateTreeTokens(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("12345678"), 0644)
+	os.Mkdir(filepath.Join(tmpDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "sub", "b.txt"), []byte("1234"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "c.bin"), []byte{0, 1, 2, 3}, 0644)
+
+	tree, err := BuildDirTree(tmpDir, TreeOptions{})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	if err = AnnotateTreeTokens(&tree, nil); err != nil {
+		t.Fatalf("AnnotateTreeTokens failed: %v", err)
+	}
+	if tree.Tokens != 3 {
+		t.Errorf("Expected 3 tokens for the tree, got %d", tree.Tokens)
+	}
+
+	tokenizer, err := LoadBPETokenizer(writeVocab(t, "12", "34", "1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = AnnotateTreeTokens(&tree, tokenizer); err != nil {
+		t.Fatalf("AnnotateTreeTokens with BPE failed: %v", err)
+	}
+	// "12345678" encodes as "1234" "5" "6" "7" "8" and "1234" as a single token.
+	if tree.Tokens != 6 {
+		t.Errorf("Expected 6 BPE tokens for the tree, got %d", tree.Tokens)
+	}
+}
@@ -0,0 +1,416 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrProtectedPath is returned for deletions of the root of a filesystem, the home
+// directory or the working directory, or of a directory containing one of them.
+var ErrProtectedPath = errors.New("path is protected from deletion")
+
+// trashInfoSuffix is the extension of the files recording where trashed entries came from.
+const trashInfoSuffix = ".trashinfo"
+
+// trashDateLayout is the layout of deletion dates in trash info files, in local time.
+const trashDateLayout = "2006-01-02T15:04:05"
+
+// TrashItem is an entry of a trash directory.
+type TrashItem struct {
+	Name      string    `json:"name"`       // name in the trash, as given to Restore
+	Path      string    `json:"path"`       // absolute path the entry was deleted from
+	DeletedAt time.Time `json:"deleted_at"` // deletion time, to the second
+	IsDir     bool      `json:"is_dir"`
+}
+
+// checkDeletable returns ErrProtectedPath if deleting path would delete the root of the
+// filesystem, the home directory or the working directory.
+func checkDeletable(op, path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: path, Err: err}
+	}
+	protected := abs == filepath.VolumeName(abs)+string(filepath.Separator)
+	if home, err := os.UserHomeDir(); err == nil && isWithin(home, abs) {
+		protected = true
+	}
+	if wd, err := os.Getwd(); err == nil && isWithin(wd, abs) {
+		protected = true
+	}
+	if protected {
+		return &fs.PathError{Op: op, Path: path, Err: ErrProtectedPath}
+	}
+	return nil
+}
+
+// DefaultTrashDir returns the trash directory of the FreeDesktop.org Trash specification:
+// "Trash" in $XDG_DATA_HOME, which defaults to ~/.local/share.
+func DefaultTrashDir() (string, error) {
+	if data := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(data) {
+		return filepath.Join(data, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// trashPath moves the entry at path into the trash directory, laid out like the
+// FreeDesktop.org Trash specification: the entry is moved into "files", and a
+// ".trashinfo" file of the same name in "info" records its original path and the time of
+// deletion. Entries that cannot be renamed into the trash are copied and deleted.
+func trashPath(backend WritableBackend, trash, path string) (TrashItem, error) {
+	if err := checkDeletable("trash", path); err != nil {
+		return TrashItem{}, err
+	}
+	info, err := backend.Lstat(path)
+	if err != nil {
+		return TrashItem{}, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return TrashItem{}, err
+	}
+	files, infos := filepath.Join(trash, "files"), filepath.Join(trash, "info")
+	for _, dir := range []string{files, infos} {
+		if err := backend.MkdirAll(dir, 0700); err != nil {
+			return TrashItem{}, err
+		}
+	}
+
+	item := TrashItem{Path: abs, DeletedAt: time.Now().Truncate(time.Second), IsDir: info.IsDir()}
+	base := filepath.Base(abs)
+	for i := 1; ; i++ {
+		item.Name = base
+		if i > 1 {
+			item.Name = fmt.Sprintf("%s.%d", base, i)
+		}
+		inFiles, err := exists(backend, filepath.Join(files, item.Name))
+		if err != nil {
+			return TrashItem{}, err
+		}
+		inInfo, err := exists(backend, filepath.Join(infos, item.Name+trashInfoSuffix))
+		if err != nil {
+			return TrashItem{}, err
+		}
+		if !inFiles && !inInfo {
+			break
+		}
+	}
+
+	infoPath := filepath.Join(infos, item.Name+trashInfoSuffix)
+	if err := backend.WriteFile(infoPath, formatTrashInfo(item), 0600); err != nil {
+		return TrashItem{}, err
+	}
+	if err := moveFile(backend, path, filepath.Join(files, item.Name)); err != nil {
+		backend.Remove(infoPath)
+		return TrashItem{}, err
+	}
+	return item, nil
+}
+
+// formatTrashInfo returns the content of the info file of item.
+func formatTrashInfo(item TrashItem) []byte {
+	path := (&url.URL{Path: filepath.ToSlash(item.Path)}).EscapedPath()
+	return fmt.Appendf(nil, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", path, item.DeletedAt.Format(trashDateLayout))
+}
+
+// parseTrashInfo parses the info file of the trash entry called name.
+func parseTrashInfo(name string, data []byte) (TrashItem, error) {
+	item := TrashItem{Name: name}
+	lines := strings.Split(string(data), "\n")
+	if strings.TrimSpace(lines[0]) != "[Trash Info]" {
+		return TrashItem{}, fmt.Errorf("trash info of %s: missing [Trash Info] header", name)
+	}
+	for _, line := range lines[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			path, err := url.PathUnescape(value)
+			if err != nil {
+				return TrashItem{}, fmt.Errorf("trash info of %s: %w", name, err)
+			}
+			item.Path = filepath.FromSlash(path)
+		case "DeletionDate":
+			date, err := time.ParseInLocation(trashDateLayout, value, time.Local)
+			if err != nil {
+				return TrashItem{}, fmt.Errorf("trash info of %s: %w", name, err)
+			}
+			item.DeletedAt = date
+		}
+	}
+	if item.Path == "" {
+		return TrashItem{}, fmt.Errorf("trash info of %s: missing Path", name)
+	}
+	return item, nil
+}
+
+// readTrashItem returns the entry of the trash called name.
+func readTrashItem(backend Backend, trash, name string) (TrashItem, error) {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return TrashItem{}, &fs.PathError{Op: "restore", Path: name, Err: fs.ErrInvalid}
+	}
+	data, err := backend.ReadFile(filepath.Join(trash, "info", name+trashInfoSuffix))
+	if err != nil {
+		return TrashItem{}, err
+	}
+	item, err := parseTrashInfo(name, data)
+	if err != nil {
+		return TrashItem{}, err
+	}
+	info, err := backend.Lstat(filepath.Join(trash, "files", name))
+	if err != nil {
+		return TrashItem{}, err
+	}
+	item.IsDir = info.IsDir()
+	return item, nil
+}
+
+// listTrash returns the entries of the trash directory, oldest first. Entries whose info
+// file is missing or malformed are left out.
+func listTrash(backend Backend, trash string) ([]TrashItem, error) {
+	entries, err := backend.ReadDir(filepath.Join(trash, "info"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []TrashItem
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), trashInfoSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if item, err := readTrashItem(backend, trash, name); err == nil {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.Before(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// restoreTrash moves the entry of the trash called name back to where it was deleted
+// from, creating missing parent directories. Nothing is overwritten: restoring fails with
+// fs.ErrExist if something is at the original path.
+func restoreTrash(backend WritableBackend, trash, name string) (TrashItem, error) {
+	item, err := readTrashItem(backend, trash, name)
+	if err != nil {
+		return TrashItem{}, err
+	}
+	if ok, err := exists(backend, item.Path); err != nil {
+		return TrashItem{}, err
+	} else if ok {
+		return TrashItem{}, &fs.PathError{Op: "restore", Path: item.Path, Err: fs.ErrExist}
+	}
+	if err := backend.MkdirAll(filepath.Dir(item.Path), 0755); err != nil {
+		return TrashItem{}, err
+	}
+	if err := moveFile(backend, filepath.Join(trash, "files", name), item.Path); err != nil {
+		return TrashItem{}, err
+	}
+	return item, backend.Remove(filepath.Join(trash, "info", name+trashInfoSuffix))
+}
+
+// emptyTrash permanently deletes every entry of the trash directory.
+func emptyTrash(backend WritableBackend, trash string) error {
+	for _, dir := range []string{"files", "info"} {
+		if err := backend.RemoveAll(filepath.Join(trash, dir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TrashBackend moves what is deleted through it into a trash directory of the wrapped
+// backend instead of deleting it, so that deletions can be undone with Restore. Deleting
+// inside the trash directory deletes for good.
+type TrashBackend struct {
+	backend Backend
+	dir     string
+}
+
+// NewTrashBackend returns backend with deletions moved into the trash directory dir,
+// which is created when first used.
+func NewTrashBackend(backend Backend, dir string) (*TrashBackend, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &TrashBackend{backend: backend, dir: abs}, nil
+}
+
+// Dir returns the trash directory.
+func (t *TrashBackend) Dir() string {
+	return t.dir
+}
+
+// ListTrash returns the entries of the trash, oldest first.
+func (t *TrashBackend) ListTrash() ([]TrashItem, error) {
+	return listTrash(t.backend, t.dir)
+}
+
+// Restore moves the entry of the trash called name back to where it was deleted from.
+func (t *TrashBackend) Restore(name string) (TrashItem, error) {
+	backend, err := writableBackend(t.backend, "restore", name)
+	if err != nil {
+		return TrashItem{}, err
+	}
+	return restoreTrash(backend, t.dir, name)
+}
+
+// EmptyTrash permanently deletes every entry of the trash.
+func (t *TrashBackend) EmptyTrash() error {
+	backend, err := writableBackend(t.backend, "remove", t.dir)
+	if err != nil {
+		return err
+	}
+	return emptyTrash(backend, t.dir)
+}
+
+func (t *TrashBackend) unwrap() Backend {
+	return t.backend
+}
+
+func (t *TrashBackend) withOperation(op string, inner Backend) Backend {
+	view := *t
+	view.backend = inner
+	return &view
+}
+
+// inTrash reports whether name is the trash directory or below it.
+func (t *TrashBackend) inTrash(name string) bool {
+	abs, err := filepath.Abs(name)
+	return err == nil && isWithin(abs, t.dir)
+}
+
+// Open opens a file for reading.
+func (t *TrashBackend) Open(name string) (fs.File, error) {
+	return t.backend.Open(name)
+}
+
+// Stat returns the file info of a path, following links.
+func (t *TrashBackend) Stat(name string) (fs.FileInfo, error) {
+	return t.backend.Stat(name)
+}
+
+// Lstat returns the file info of a path without following a final link.
+func (t *TrashBackend) Lstat(name string) (fs.FileInfo, error) {
+	return t.backend.Lstat(name)
+}
+
+// ReadDir returns the entries of a directory sorted by name.
+func (t *TrashBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return t.backend.ReadDir(name)
+}
+
+// ReadFile returns the content of a file.
+func (t *TrashBackend) ReadFile(name string) ([]byte, error) {
+	return t.backend.ReadFile(name)
+}
+
+// ReadLink returns the target of a symbolic link.
+func (t *TrashBackend) ReadLink(name string) (string, error) {
+	return t.backend.ReadLink(name)
+}
+
+// WriteFile replaces the content of a file.
+func (t *TrashBackend) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	backend, err := writableBackend(t.backend, "write", name)
+	if err != nil {
+		return err
+	}
+	return backend.WriteFile(name, data, perm)
+}
+
+// MkdirAll creates a directory along with any missing parents.
+func (t *TrashBackend) MkdirAll(name string, perm fs.FileMode) error {
+	backend, err := writableBackend(t.backend, "mkdir", name)
+	if err != nil {
+		return err
+	}
+	return backend.MkdirAll(name, perm)
+}
+
+// Remove moves a file or an empty directory into the trash.
+func (t *TrashBackend) Remove(name string) error {
+	backend, err := writableBackend(t.backend, "remove", name)
+	if err != nil {
+		return err
+	}
+	if t.inTrash(name) {
+		return backend.Remove(name)
+	}
+	info, err := backend.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if entries, err := backend.ReadDir(name); err != nil {
+			return err
+		} else if len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+		}
+	}
+	_, err = trashPath(backend, t.dir, name)
+	return err
+}
+
+// RemoveAll moves a path and everything below it into the trash, succeeding if it does not
+// exist.
+func (t *TrashBackend) RemoveAll(name string) error {
+	backend, err := writableBackend(t.backend, "remove", name)
+	if err != nil {
+		return err
+	}
+	if t.inTrash(name) {
+		return backend.RemoveAll(name)
+	}
+	if _, err := backend.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	_, err = trashPath(backend, t.dir, name)
+	return err
+}
+
+// Rename moves a file or directory.
+func (t *TrashBackend) Rename(oldname, newname string) error {
+	backend, err := writableBackend(t.backend, "rename", oldname)
+	if err != nil {
+		return err
+	}
+	return backend.Rename(oldname, newname)
+}
+
+// Chmod changes the mode of a file or directory.
+func (t *TrashBackend) Chmod(name string, mode fs.FileMode) error {
+	backend, err := writableBackend(t.backend, "chmod", name)
+	if err != nil {
+		return err
+	}
+	return backend.Chmod(name, mode)
+}
+
+// Chtimes changes the modification time of a file or directory.
+func (t *TrashBackend) Chtimes(name string, modTime time.Time) error {
+	backend, err := writableBackend(t.backend, "chtimes", name)
+	if err != nil {
+		return err
+	}
+	return backend.Chtimes(name, modTime)
+}
+
+var _ WritableBackend = (*TrashBackend)(nil)
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrashBackend(t *testing.T) {
+	memory := NewMemoryBackend()
+	for path, content := range map[string]string{
+		"/repo/a.txt":     "a",
+		"/repo/dir/b.txt": "b",
+	} {
+		if err := memory.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := memory.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backend, err := NewTrashBackend(memory, "/trash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := NewFS(backend)
+
+	if err := fsys.DeleteFile("/repo/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.DeleteDir("/repo/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.DeleteDir("/repo/missing"); err != nil {
+		t.Errorf("deleting a missing directory: %v", err)
+	}
+	if err := fsys.DeleteFile("/repo/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("deleting a missing file: got %v, want fs.ErrNotExist", err)
+	}
+	for _, path := range []string{"/repo/a.txt", "/repo/dir"} {
+		if ok, _ := exists(memory, path); ok {
+			t.Errorf("%s was not deleted", path)
+		}
+	}
+
+	// Deleting the same path again gives the entry a new name.
+	if err := fsys.WriteFile("/repo/a.txt", []byte("a2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.DeleteFile("/repo/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	items, err := backend.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]TrashItem{}
+	for _, item := range items {
+		names[item.Name] = item
+	}
+	if len(items) != 3 || names["a.txt"].Path != "/repo/a.txt" || names["a.txt.2"].Path != "/repo/a.txt" ||
+		!names["dir"].IsDir || names["a.txt"].IsDir || names["dir"].DeletedAt.IsZero() {
+		t.Fatalf("unexpected trash: %+v", items)
+	}
+	info, err := memory.ReadFile("/trash/info/dir.trashinfo")
+	if err != nil || !strings.HasPrefix(string(info), "[Trash Info]\nPath=/repo/dir\nDeletionDate=") {
+		t.Errorf("unexpected info file: %q, %v", info, err)
+	}
+
+	// Restoring does not overwrite, and recreates missing parents.
+	if err := memory.RemoveAll("/repo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Restore("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := memory.ReadFile("/repo/dir/b.txt"); err != nil || string(data) != "b" {
+		t.Errorf("restored file = %q, %v", data, err)
+	}
+	if _, err := backend.Restore("a.txt.2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Restore("a.txt"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("restoring over an existing file: got %v, want fs.ErrExist", err)
+	}
+	if _, err := backend.Restore("../a.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("restoring a path: got %v, want fs.ErrInvalid", err)
+	}
+	if items, err := backend.ListTrash(); err != nil || len(items) != 1 || items[0].Name != "a.txt" {
+		t.Errorf("trash after restoring = %+v, %v", items, err)
+	}
+
+	// Deleting inside the trash deletes for good.
+	if err := fsys.DeleteFile("/trash/files/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if items, err := backend.ListTrash(); err != nil || len(items) != 0 {
+		t.Errorf("trash after deleting inside it = %+v, %v", items, err)
+	}
+
+	if err := fsys.DeleteFile("/repo/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.EmptyTrash(); err != nil {
+		t.Fatal(err)
+	}
+	if items, err := backend.ListTrash(); err != nil || len(items) != 0 {
+		t.Errorf("trash after emptying = %+v, %v", items, err)
+	}
+}
+
+func TestTrashBackend_NotEmpty(t *testing.T) {
+	memory := NewMemoryBackend()
+	if err := memory.MkdirAll("/repo/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.WriteFile("/repo/dir/a.txt", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	backend, err := NewTrashBackend(memory, "/trash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Remove("/repo/dir"); err == nil {
+		t.Error("removing a non-empty directory did not fail")
+	}
+	if ok, _ := exists(memory, "/repo/dir/a.txt"); !ok {
+		t.Error("the directory was trashed")
+	}
+}
+
+func TestTrashBackend_OS(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a b%.txt")
+	if err := os.WriteFile(path, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	if _, err := MoveToTrash(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("file was not moved: %v", err)
+	}
+	info, err := os.ReadFile(filepath.Join(dir, "data", "Trash", "info", "a b%.txt.trashinfo"))
+	if err != nil || !strings.Contains(string(info), "Path="+filepath.ToSlash(dir)+"/a%20b%25.txt\n") {
+		t.Errorf("unexpected info file: %q, %v", info, err)
+	}
+	items, err := ListTrash()
+	if err != nil || len(items) != 1 || items[0].Path != path {
+		t.Fatalf("ListTrash = %+v, %v", items, err)
+	}
+	if _, err := RestoreFromTrash(items[0].Name); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "a" {
+		t.Errorf("restored file = %q, %v", data, err)
+	}
+	if err := EmptyTrash(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDelete_ProtectedPaths(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := []string{"/", ".", wd, filepath.Dir(wd)}
+	if home, err := os.UserHomeDir(); err == nil {
+		protected = append(protected, home)
+	}
+	// The memory backend keeps a broken guard from deleting anything real.
+	memory := NewMemoryBackend()
+	for _, path := range protected {
+		if err := deleteDir(memory, path); !errors.Is(err, ErrProtectedPath) {
+			t.Errorf("deleteDir(%q): got %v, want ErrProtectedPath", path, err)
+		}
+		if err := deleteFile(memory, path); !errors.Is(err, ErrProtectedPath) {
+			t.Errorf("deleteFile(%q): got %v, want ErrProtectedPath", path, err)
+		}
+		if _, err := trashPath(memory, "/trash", path); !errors.Is(err, ErrProtectedPath) {
+			t.Errorf("trashPath(%q): got %v, want ErrProtectedPath", path, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// treeSnapshotVersion is the format version written by saveTreeSnapshot.
+const treeSnapshotVersion = 1
+
+// TreeChange describes one entry that differs between two directory trees. Paths are
+// slash-separated and relative to the root of each tree.
+type TreeChange struct {
+	Path    string `json:"path"`               // path in the newer tree, or in the older one for removals
+	OldPath string `json:"old_path,omitempty"` // path in the older tree, set for renames
+	IsFile  bool   `json:"is_file"`
+	Size    int64  `json:"size"`               // size in the newer tree, or in the older one for removals
+	OldSize int64  `json:"old_size,omitempty"` // size in the older tree, set for modifications
+}
+
+// TreeDiff lists the differences between two directory trees, each sorted by path.
+type TreeDiff struct {
+	Added    []TreeChange `json:"added,omitempty"`
+	Removed  []TreeChange `json:"removed,omitempty"`
+	Modified []TreeChange `json:"modified,omitempty"`
+	Renamed  []TreeChange `json:"renamed,omitempty"`
+}
+
+// treeSnapshot is the on-disk form of a saved tree.
+type treeSnapshot struct {
+	Version int           `json:"version"`
+	Tree    DirectoryTree `json:"tree"`
+}
+
+// flattenTree maps the slash-separated relative path of every entry below tree to its
+// node. Placeholders for omitted entries are left out.
+func flattenTree(tree DirectoryTree) map[string]DirectoryTree {
+	entries := make(map[string]DirectoryTree)
+	var walk func(children []DirectoryTree, prefix string)
+	walk = func(children []DirectoryTree, prefix string) {
+		for _, child := range children {
+			if child.Omitted != nil {
+				continue
+			}
+			path := prefix + child.Name
+			entries[path] = child
+			walk(child.Children, path+"/")
+		}
+	}
+	walk(tree.Children, "")
+	return entries
+}
+
+// fileChanged reports whether a file differs between two snapshots. Content hashes are
+// compared when both nodes have one; otherwise sizes and modification times are.
+func fileChanged(a, b DirectoryTree) bool {
+	if a.Hash != "" && b.Hash != "" {
+		return a.Hash != b.Hash
+	}
+	if a.Size != b.Size {
+		return true
+	}
+	return !a.ModTime.IsZero() && !b.ModTime.IsZero() && !a.ModTime.Equal(b.ModTime)
+}
+
+// diffTrees compares an older tree a with a newer tree b. An entry that changes between
+// file and directory is reported as removed and added. Removed and added files with the
+// same content hash are reported as renames, so build both trees with the Hash metadata
+// enabled to detect them.
+func diffTrees(a, b DirectoryTree) TreeDiff {
+	before, after := flattenTree(a), flattenTree(b)
+
+	var diff TreeDiff
+	for _, path := range sortedKeys(before) {
+		old := before[path]
+		current, ok := after[path]
+		switch {
+		case !ok || current.IsFile != old.IsFile:
+			diff.Removed = append(diff.Removed, TreeChange{Path: path, IsFile: old.IsFile, Size: old.Size})
+		case old.IsFile && fileChanged(old, current):
+			diff.Modified = append(diff.Modified, TreeChange{Path: path, IsFile: true, Size: current.Size, OldSize: old.Size})
+		}
+	}
+	for _, path := range sortedKeys(after) {
+		current := after[path]
+		if old, ok := before[path]; !ok || current.IsFile != old.IsFile {
+			diff.Added = append(diff.Added, TreeChange{Path: path, IsFile: current.IsFile, Size: current.Size})
+		}
+	}
+
+	// Pair up removed and added files by content hash, in path order.
+	removedByHash := make(map[string][]int)
+	for i, change := range diff.Removed {
+		if hash := before[change.Path].Hash; change.IsFile && hash != "" {
+			removedByHash[hash] = append(removedByHash[hash], i)
+		}
+	}
+	renamedFrom := make(map[int]bool)
+	var added []TreeChange
+	for _, change := range diff.Added {
+		hash := after[change.Path].Hash
+		if candidates := removedByHash[hash]; change.IsFile && hash != "" && len(candidates) > 0 {
+			removedByHash[hash] = candidates[1:]
+			renamedFrom[candidates[0]] = true
+			change.OldPath = diff.Removed[candidates[0]].Path
+			diff.Renamed = append(diff.Renamed, change)
+			continue
+		}
+		added = append(added, change)
+	}
+	var removed []TreeChange
+	for i, change := range diff.Removed {
+		if !renamedFrom[i] {
+			removed = append(removed, change)
+		}
+	}
+	diff.Added, diff.Removed = added, removed
+	return diff
+}
+
+// saveTreeSnapshot writes a tree to path as JSON so it can be compared later.
+func saveTreeSnapshot(backend WritableBackend, tree DirectoryTree, path string) error {
+	data, err := json.Marshal(treeSnapshot{Version: treeSnapshotVersion, Tree: tree})
+	if err != nil {
+		return fmt.Errorf("could not marshal tree snapshot: %w", err)
+	}
+	return writeFile(backend, path, data)
+}
+
+// loadTreeSnapshot reads a tree written by saveTreeSnapshot.
+func loadTreeSnapshot(backend Backend, path string) (DirectoryTree, error) {
+	data, err := readFile(backend, path)
+	if err != nil {
+		return DirectoryTree{}, err
+	}
+	var snapshot treeSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return DirectoryTree{}, fmt.Errorf("could not parse tree snapshot %s: %w", path, err)
+	}
+	if snapshot.Version != treeSnapshotVersion {
+		return DirectoryTree{}, fmt.Errorf("unsupported tree snapshot version %d in %s", snapshot.Version, path)
+	}
+	return snapshot.Tree, nil
+}
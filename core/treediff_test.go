@@ -0,0 +1,122 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffTrees(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("keep.txt", "same")
+	write("edit.txt", "before")
+	write("old/name.txt", "moved content")
+	write("gone.txt", "deleted")
+
+	options := TreeOptions{Metadata: MetadataOptions{Hash: true}}
+	before, err := BuildDirTree(root, options)
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+
+	write("edit.txt", "after!")
+	if err := os.Rename(filepath.Join(root, "old", "name.txt"), filepath.Join(root, "new.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+	write("added/file.txt", "fresh")
+
+	after, err := BuildDirTree(root, options)
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+
+	expected := TreeDiff{
+		Added: []TreeChange{
+			{Path: "added", Size: 5},
+			{Path: "added/file.txt", IsFile: true, Size: 5},
+		},
+		Removed: []TreeChange{
+			{Path: "gone.txt", IsFile: true, Size: 7},
+		},
+		Modified: []TreeChange{
+			{Path: "edit.txt", IsFile: true, Size: 6, OldSize: 6},
+		},
+		Renamed: []TreeChange{
+			{Path: "new.txt", OldPath: "old/name.txt", IsFile: true, Size: 13},
+		},
+	}
+	if diff := DiffTrees(before, after); !reflect.DeepEqual(diff, expected) {
+		t.Errorf("DiffTrees mismatch:\ngot  %+v\nwant %+v", diff, expected)
+	}
+	if diff := DiffTrees(after, after); !reflect.DeepEqual(diff, TreeDiff{}) {
+		t.Errorf("Diffing a tree with itself should find nothing, got %+v", diff)
+	}
+}
+
+func TestDiffTrees_WithoutHashes(t *testing.T) {
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := DirectoryTree{Children: []DirectoryTree{
+		{Name: "touched.txt", IsFile: true, Size: 3, ModTime: modTime},
+		{Name: "moved.txt", IsFile: true, Size: 3},
+	}}
+	b := DirectoryTree{Children: []DirectoryTree{
+		{Name: "touched.txt", IsFile: true, Size: 3, ModTime: modTime.Add(time.Second)},
+		{Name: "renamed.txt", IsFile: true, Size: 3},
+	}}
+
+	diff := DiffTrees(a, b)
+	if len(diff.Modified) != 1 || diff.Modified[0].Path != "touched.txt" {
+		t.Errorf("Expected a modification detected by mod time, got %+v", diff.Modified)
+	}
+	if len(diff.Renamed) != 0 || len(diff.Added) != 1 || len(diff.Removed) != 1 {
+		t.Errorf("Renames should only be detected by hash, got %+v", diff)
+	}
+}
+
+func TestTreeSnapshot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := BuildDirTree(root, TreeOptions{Metadata: MetadataOptions{ModTime: true, Hash: true}})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+
+	snapshot := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := SaveTreeSnapshot(tree, snapshot); err != nil {
+		t.Fatalf("SaveTreeSnapshot failed: %v", err)
+	}
+	loaded, err := LoadTreeSnapshot(snapshot)
+	if err != nil {
+		t.Fatalf("LoadTreeSnapshot failed: %v", err)
+	}
+	if diff := DiffTrees(loaded, tree); !reflect.DeepEqual(diff, TreeDiff{}) {
+		t.Errorf("A loaded snapshot should match the tree it was saved from, got %+v", diff)
+	}
+	if loaded.Children[0].Hash != tree.Children[0].Hash {
+		t.Error("Snapshot should keep content hashes")
+	}
+
+	if err := os.WriteFile(snapshot, []byte(`{"version":99,"tree":{}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTreeSnapshot(snapshot); err == nil {
+		t.Error("Expected an error for an unsupported snapshot version")
+	}
+}
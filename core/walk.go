@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+)
+
+// listDir returns the entries of a directory sorted by name, leaving out entries hidden by
+// the backend's policy.
+func listDir(backend Backend, path string) ([]fs.DirEntry, error) {
+	if err := checkAccess(backend, PolicyTree, path); err != nil {
+		return nil, err
+	}
+	entries, err := backend.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	visible := entries[:0]
+	for _, entry := range entries {
+		if checkAccess(backend, PolicyTree, filepath.Join(path, entry.Name())) == nil {
+			visible = append(visible, entry)
+		}
+	}
+	return visible, nil
+}
+
+// walkDir walks the tree at root like fs.WalkDir, calling fn with paths joined to root.
+// A link at root is followed, while links below it are reported but never followed.
+// Entries hidden by the backend's policy are skipped.
+func walkDir(backend Backend, root string, fn fs.WalkDirFunc) error {
+	info, err := backend.Stat(root)
+	if err == nil {
+		err = checkAccess(backend, PolicyTree, root)
+	}
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDirIn(backend, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDirIn walks the entry at path, returning fs.SkipDir only when fn skips the rest of
+// the parent directory of a file.
+func walkDirIn(backend Backend, path string, entry fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, entry, nil); err != nil || !entry.IsDir() {
+		if err == fs.SkipDir && entry.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := backend.ReadDir(path)
+	if err != nil {
+		// Report the error, letting fn decide whether to go on.
+		if err := fn(path, entry, err); err != nil {
+			if err == fs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, child := range entries {
+		name := filepath.Join(path, child.Name())
+		if checkAccess(backend, PolicyTree, name) != nil {
+			continue
+		}
+		if err := walkDirIn(backend, name, child, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// glob returns the paths below root whose slash-separated path relative to root matches
+// pattern, in lexical order. A "**" segment of pattern matches any number of directories.
+// Directories below root that cannot be read are skipped.
+func glob(backend Backend, root, pattern string) ([]string, error) {
+	if !validGlob(pattern) {
+		return nil, fmt.Errorf("glob %q: %w", pattern, path.ErrBadPattern)
+	}
+	var matches []string
+	err := walkDir(backend, root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if name == root {
+				return err
+			}
+			return nil // skip unreadable directories below root
+		}
+		if name == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		if matchGlob(pattern, filepath.ToSlash(rel)) {
+			matches = append(matches, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListDir(t *testing.T) {
+	root := setupLimitTree(t)
+	entries, err := ListDir(root)
+	if err != nil {
+		t.Fatalf("ListDir failed: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"deep", "f0.txt", "f1.txt", "f2.txt", "f3.txt", "f4.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("ListDir = %v, want %v", names, want)
+	}
+	if _, err := ListDir(filepath.Join(root, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("listing a missing directory: got %v, want ErrNotExist", err)
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	root := setupLimitTree(t)
+	var visited []string
+	err := WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, name)
+		visited = append(visited, filepath.ToSlash(rel))
+		switch rel {
+		case filepath.Join("deep", "a"):
+			return fs.SkipDir
+		case "f1.txt":
+			return fs.SkipDir // skips the rest of root
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir failed: %v", err)
+	}
+	want := []string{".", "deep", "deep/a", "f0.txt", "f1.txt"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited %v, want %v", visited, want)
+	}
+
+	visited = nil
+	err = WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+		visited = append(visited, name)
+		if len(visited) == 3 {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil || len(visited) != 3 {
+		t.Errorf("SkipAll: got %d entries and %v", len(visited), err)
+	}
+
+	if err := WalkDir(filepath.Join(root, "missing"), func(string, fs.DirEntry, error) error {
+		return errors.New("stop")
+	}); err == nil || err.Error() != "stop" {
+		t.Errorf("walking a missing root: got %v, want the error of fn", err)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	root := setupLimitTree(t)
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.txt", []string{"f0.txt", "f1.txt", "f2.txt", "f3.txt", "f4.txt"}},
+		{"**/*.txt", []string{"deep/a/b/c.txt", "f0.txt", "f1.txt", "f2.txt", "f3.txt", "f4.txt"}},
+		{"deep/**", []string{"deep", "deep/a", "deep/a/b", "deep/a/b/c.txt"}},
+		{"deep/*/b", []string{"deep/a/b"}},
+		{"f[13].txt", []string{"f1.txt", "f3.txt"}},
+		{"*.go", nil},
+	}
+	for _, tt := range tests {
+		matches, err := Glob(root, tt.pattern)
+		if err != nil {
+			t.Fatalf("Glob(%q) failed: %v", tt.pattern, err)
+		}
+		var got []string
+		for _, match := range matches {
+			rel, _ := filepath.Rel(root, match)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Glob(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+	if _, err := Glob(root, "[a"); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("invalid pattern: got %v, want ErrBadPattern", err)
+	}
+}
+
+func TestWalkDir_Policy(t *testing.T) {
+	root := setupLimitTree(t)
+	backend, err := NewPolicyBackend(OSBackend{}, Policy{Root: root, Rules: []PolicyRule{
+		{Paths: []string{"deep/**"}, Operations: []string{PolicyTree}, Effect: PolicyDeny},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := NewFS(backend).Glob(root, "**")
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	if len(matches) != 5 {
+		t.Errorf("Glob through a policy = %v, want the 5 files of the root", matches)
+	}
+}
@@ -0,0 +1,537 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of change reported by a Watcher.
+const (
+	EventCreate = "create"
+	EventModify = "modify"
+	EventDelete = "delete"
+	EventRename = "rename"
+)
+
+// ErrWatchOverflow is reported on Watcher.Errors when the kernel dropped events. The
+// watcher recovers by reporting the root as modified and rebuilding its tree.
+var ErrWatchOverflow = errors.New("watch event queue overflowed")
+
+// WatchEvent is a change to a path below a watched root.
+type WatchEvent struct {
+	Kind    string `json:"kind"`
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"` // previous path, set for renames
+	IsDir   bool   `json:"is_dir"`
+}
+
+// WatchOptions controls how a directory is watched.
+type WatchOptions struct {
+	Include []string `json:"include,omitempty"` // file name patterns to report; empty reports everything
+	Exclude []string `json:"exclude,omitempty"` // file and directory name patterns to ignore
+
+	// Debounce is how long the watcher waits for changes to settle before emitting them
+	// as one batch, and defaults to 100ms.
+	Debounce time.Duration `json:"debounce,omitempty"`
+	// ForcePolling uses the polling watcher even where a native one is available.
+	ForcePolling bool `json:"force_polling,omitempty"`
+	// PollInterval is how often the polling watcher rescans the root, and defaults to 1s.
+	PollInterval time.Duration `json:"poll_interval,omitempty"`
+
+	// TrackTree keeps a DirectoryTree of the root up to date with every batch of events,
+	// available through Watcher.Tree.
+	TrackTree bool `json:"track_tree,omitempty"`
+}
+
+// Watcher reports debounced changes below a directory. Events arrive in batches, sorted by
+// path, after the watched tree has been quiet for the debounce interval.
+type Watcher struct {
+	root    string
+	options WatchOptions
+	backend watchBackend
+
+	raw    chan WatchEvent
+	events chan []WatchEvent
+	errors chan error
+	done   chan struct{}
+	close  sync.Once
+
+	mu      sync.Mutex
+	tree    *DirectoryTree
+	builder *treeBuilder
+}
+
+// watchBackend is a source of raw, undebounced events.
+type watchBackend interface {
+	close() error
+}
+
+// errNoNativeWatcher is returned by startNativeWatcher on platforms without one.
+var errNoNativeWatcher = errors.New("no native file watcher on this platform")
+
+// watch starts watching root, using the native watcher when available and polling
+// otherwise.
+func watch(root string, options WatchOptions) (*Watcher, error) {
+	root = filepath.Clean(root)
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "watch", Path: root, Err: errors.New("not a directory")}
+	}
+	if options.Debounce <= 0 {
+		options.Debounce = 100 * time.Millisecond
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = time.Second
+	}
+
+	w := &Watcher{
+		root:    root,
+		options: options,
+		raw:     make(chan WatchEvent, 256),
+		events:  make(chan []WatchEvent, 16),
+		errors:  make(chan error, 16),
+		done:    make(chan struct{}),
+	}
+	if options.TrackTree {
+		w.builder = newTreeBuilder(defaultBackend, TreeOptions{Include: options.Include, Exclude: options.Exclude})
+		tree, err := w.builder.build(root, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		w.tree = &tree
+	}
+
+	if !options.ForcePolling {
+		w.backend, err = startNativeWatcher(root, options, w.emit, w.report)
+	}
+	if options.ForcePolling || err != nil {
+		w.backend, err = startPollWatcher(root, options, w.emit, w.done)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Events returns the channel on which batches of events are delivered. It is closed when
+// the watcher is closed.
+func (w *Watcher) Events() <-chan []WatchEvent {
+	return w.events
+}
+
+// Errors returns the channel on which errors that do not stop the watcher are reported.
+// Errors are dropped while the channel is full.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Tree returns a copy of the tracked tree, which reflects every batch delivered so far.
+// It reports false unless WatchOptions.TrackTree is set.
+func (w *Watcher) Tree() (DirectoryTree, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.tree == nil {
+		return DirectoryTree{}, false
+	}
+	return cloneTree(*w.tree), true
+}
+
+// Close stops the watcher and closes its Events channel.
+func (w *Watcher) Close() error {
+	var err error
+	w.close.Do(func() {
+		close(w.done)
+		err = w.backend.close()
+	})
+	return err
+}
+
+// emit hands a raw event from a backend to the debouncer, dropping events that the
+// include and exclude patterns filter out.
+func (w *Watcher) emit(event WatchEvent) {
+	keepNew := w.keep(event.Path, event.IsDir)
+	if event.Kind == EventRename {
+		keepOld := w.keep(event.OldPath, event.IsDir)
+		switch {
+		case !keepOld && !keepNew:
+			return
+		case !keepOld:
+			event = WatchEvent{Kind: EventCreate, Path: event.Path, IsDir: event.IsDir}
+		case !keepNew:
+			event = WatchEvent{Kind: EventDelete, Path: event.OldPath, IsDir: event.IsDir}
+		}
+	} else if !keepNew {
+		return
+	}
+
+	select {
+	case w.raw <- event:
+	case <-w.done:
+	}
+}
+
+// report delivers an error without blocking.
+func (w *Watcher) report(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+// keep reports whether events for path pass the include and exclude patterns. Every path
+// component below the root is checked against the exclude patterns, like a tree build
+// would, and include patterns only apply to files.
+func (w *Watcher) keep(path string, isDir bool) bool {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	if rel != "." {
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			if isExcluded(name, w.options.Exclude) {
+				return false
+			}
+		}
+	}
+	return isDir || isIncluded(filepath.Base(path), w.options.Include)
+}
+
+// run debounces raw events into batches, updates the tracked tree and delivers them.
+func (w *Watcher) run() {
+	defer close(w.events)
+
+	var batch eventBatch
+	timer := time.NewTimer(w.options.Debounce)
+	timer.Stop()
+	for {
+		select {
+		case event := <-w.raw:
+			batch.add(event)
+			timer.Reset(w.options.Debounce)
+		case <-timer.C:
+			events := batch.flush()
+			if len(events) == 0 {
+				continue
+			}
+			w.updateTree(events)
+			select {
+			case w.events <- events:
+			case <-w.done:
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// updateTree refreshes the tracked tree for every path touched by events.
+func (w *Watcher) updateTree(events []WatchEvent) {
+	if w.tree == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, event := range events {
+		for _, path := range []string{event.OldPath, event.Path} {
+			if path == "" {
+				continue
+			}
+			if err := refreshTree(w.tree, path, w.builder); err != nil {
+				w.report(err)
+			}
+		}
+	}
+}
+
+// eventBatch coalesces the events seen during one debounce interval into at most one
+// event per path.
+type eventBatch struct {
+	pending map[string]WatchEvent
+}
+
+// add merges an event into the batch. A create followed by a delete cancels out, a delete
+// followed by a create becomes a modification, and renames of freshly created or renamed
+// paths carry the earlier event over to the new path.
+func (b *eventBatch) add(event WatchEvent) {
+	if b.pending == nil {
+		b.pending = make(map[string]WatchEvent)
+	}
+	previous, seen := b.pending[event.Path]
+
+	switch event.Kind {
+	case EventCreate:
+		if seen && previous.Kind == EventDelete {
+			event.Kind = EventModify
+		} else if seen {
+			return
+		}
+	case EventModify:
+		if seen && previous.Kind != EventDelete {
+			return
+		}
+	case EventDelete:
+		if seen && previous.Kind == EventCreate {
+			delete(b.pending, event.Path)
+			return
+		}
+		if seen && previous.Kind == EventRename {
+			// The renamed entry is gone: what disappeared is its original path.
+			delete(b.pending, event.Path)
+			event.Path = previous.OldPath
+			b.add(event)
+			return
+		}
+	case EventRename:
+		if old, ok := b.pending[event.OldPath]; ok {
+			delete(b.pending, event.OldPath)
+			switch old.Kind {
+			case EventCreate:
+				event = WatchEvent{Kind: EventCreate, Path: event.Path, IsDir: event.IsDir}
+			case EventRename:
+				event.OldPath = old.OldPath
+			}
+		}
+		if event.OldPath == event.Path {
+			event = WatchEvent{Kind: EventModify, Path: event.Path, IsDir: event.IsDir}
+		}
+	}
+	b.pending[event.Path] = event
+}
+
+// flush returns the pending events sorted by path and empties the batch.
+func (b *eventBatch) flush() []WatchEvent {
+	events := make([]WatchEvent, 0, len(b.pending))
+	for _, path := range sortedKeys(b.pending) {
+		events = append(events, b.pending[path])
+	}
+	b.pending = nil
+	return events
+}
+
+// refreshTree brings the node for path in tree up to date with the disk, adding, replacing
+// or removing it, and fixes up the sizes of its ancestors. Paths outside the tree are
+// ignored.
+func refreshTree(tree *DirectoryTree, path string, builder *treeBuilder) error {
+	rel, err := filepath.Rel(tree.Path, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	if rel == "." {
+		fresh, err := builder.build(tree.Path, 0, nil)
+		if err != nil {
+			return err
+		}
+		*tree = fresh
+		return nil
+	}
+
+	node := tree
+	stack := []*DirectoryTree{tree}
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, name := range parts {
+		index := -1
+		for j := range node.Children {
+			if node.Children[j].Name == name && node.Children[j].Omitted == nil {
+				index = j
+				break
+			}
+		}
+		if index >= 0 && i < len(parts)-1 && !node.Children[index].IsFile {
+			node = &node.Children[index]
+			stack = append(stack, node)
+			continue
+		}
+
+		// Rebuild the first node on the path that is missing, a file, or the target.
+		fresh, err := builder.build(filepath.Join(node.Path, name), 1, nil)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		exists := err == nil && fresh.Path != ""
+		switch {
+		case index >= 0 && exists:
+			node.Children[index] = fresh
+		case index >= 0:
+			node.Children = append(node.Children[:index], node.Children[index+1:]...)
+		case exists:
+			at := sort.Search(len(node.Children), func(j int) bool { return node.Children[j].Name > name })
+			node.Children = append(node.Children, DirectoryTree{})
+			copy(node.Children[at+1:], node.Children[at:])
+			node.Children[at] = fresh
+		}
+		break
+	}
+
+	// Walk back up, dropping directories that include patterns leave empty and summing
+	// up sizes again.
+	include := builder.options.Include
+	for i := len(stack) - 1; i >= 0; i-- {
+		dir := stack[i]
+		dir.Size = 0
+		for _, child := range dir.Children {
+			dir.Size += child.Size
+		}
+		if i > 0 && len(include) > 0 && len(dir.Children) == 0 && len(dir.Errors) == 0 {
+			parent := stack[i-1]
+			for j := range parent.Children {
+				if &parent.Children[j] == dir {
+					parent.Children = append(parent.Children[:j], parent.Children[j+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cloneTree returns a deep copy of a tree.
+func cloneTree(tree DirectoryTree) DirectoryTree {
+	if tree.Children != nil {
+		children := make([]DirectoryTree, len(tree.Children))
+		for i, child := range tree.Children {
+			children[i] = cloneTree(child)
+		}
+		tree.Children = children
+	}
+	tree.Errors = append([]*TreeError(nil), tree.Errors...)
+	return tree
+}
+
+// pollWatcher detects changes by periodically rescanning the root and comparing the
+// results with the previous scan.
+type pollWatcher struct {
+	root    string
+	exclude []string
+	emit    func(WatchEvent)
+	done    <-chan struct{}
+	stop    chan struct{}
+	seen    map[string]fs.FileInfo
+}
+
+// startPollWatcher takes an initial scan of root and starts rescanning it every
+// options.PollInterval until done is closed or the watcher is closed.
+func startPollWatcher(root string, options WatchOptions, emit func(WatchEvent), done <-chan struct{}) (*pollWatcher, error) {
+	p := &pollWatcher{
+		root:    root,
+		exclude: options.Exclude,
+		emit:    emit,
+		done:    done,
+		stop:    make(chan struct{}),
+	}
+	var err error
+	if p.seen, err = p.scan(); err != nil {
+		return nil, err
+	}
+	go func() {
+		ticker := time.NewTicker(options.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.poll()
+			case <-p.stop:
+				return
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	return p, nil
+}
+
+func (p *pollWatcher) close() error {
+	close(p.stop)
+	return nil
+}
+
+// scan records the file info of every entry below the root, without following links or
+// descending into excluded directories.
+func (p *pollWatcher) scan() (map[string]fs.FileInfo, error) {
+	seen := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(p.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == p.root {
+				return err
+			}
+			return nil
+		}
+		if path == p.root {
+			return nil
+		}
+		if isExcluded(d.Name(), p.exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			seen[path] = info
+		}
+		return nil
+	})
+	return seen, err
+}
+
+// poll rescans the root and emits the differences from the previous scan. Entries that
+// disappeared and reappeared elsewhere as the same file are reported as renames.
+func (p *pollWatcher) poll() {
+	current, err := p.scan()
+	if err != nil {
+		return
+	}
+
+	var removed, added []string
+	for _, path := range sortedKeys(p.seen) {
+		old := p.seen[path]
+		info, ok := current[path]
+		switch {
+		case !ok || info.IsDir() != old.IsDir():
+			removed = append(removed, path)
+			if ok {
+				added = append(added, path)
+			}
+		case !info.IsDir() && (info.Size() != old.Size() || !info.ModTime().Equal(old.ModTime())):
+			p.emit(WatchEvent{Kind: EventModify, Path: path})
+		}
+	}
+	for _, path := range sortedKeys(current) {
+		if _, ok := p.seen[path]; !ok {
+			added = append(added, path)
+		}
+	}
+
+	renamed := make(map[string]bool)
+	for _, oldPath := range removed {
+		old := p.seen[oldPath]
+		for _, path := range added {
+			if !renamed[path] && path != oldPath && os.SameFile(old, current[path]) {
+				renamed[path], renamed[oldPath] = true, true
+				p.emit(WatchEvent{Kind: EventRename, Path: path, OldPath: oldPath, IsDir: old.IsDir()})
+				break
+			}
+		}
+	}
+	for _, path := range removed {
+		if !renamed[path] {
+			p.emit(WatchEvent{Kind: EventDelete, Path: path, IsDir: p.seen[path].IsDir()})
+		}
+	}
+	for _, path := range added {
+		if !renamed[path] {
+			p.emit(WatchEvent{Kind: EventCreate, Path: path, IsDir: current[path].IsDir()})
+		}
+	}
+	p.seen = current
+}
@@ -0,0 +1,280 @@
+//go:build linux
+
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask selects the inotify events the native watcher subscribes to.
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_DONT_FOLLOW | unix.IN_ONLYDIR
+
+// inotifyWatcher watches every directory below a root with inotify.
+type inotifyWatcher struct {
+	root    string
+	exclude []string
+	fd      int
+	file    *os.File // wraps fd for reads; never call Fd on it, which makes it blocking
+	emit    func(WatchEvent)
+	report  func(error)
+
+	mu    sync.Mutex
+	dirs  map[int]string // watch descriptor to directory path
+	watch map[string]int // directory path to watch descriptor
+
+	// IN_MOVED_FROM halves are kept across reads until their IN_MOVED_TO arrives, or are
+	// reported as deletes once the debounce interval has passed without it.
+	debounce time.Duration
+	movesMu  sync.Mutex
+	moves    map[uint32]pendingMove // by cookie
+	order    []uint32               // cookies in arrival order
+	expire   *time.Timer
+}
+
+// startNativeWatcher starts an inotify watcher on root and every directory below it.
+func startNativeWatcher(root string, options WatchOptions, emit func(WatchEvent), report func(error)) (watchBackend, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotifyWatcher{
+		root:    root,
+		exclude: options.Exclude,
+		fd:      fd,
+		// A non-blocking descriptor lets reads park in the runtime poller, so that closing
+		// the file unblocks them.
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		emit:   emit,
+		report: report,
+		dirs:   make(map[int]string),
+		watch:  make(map[string]int),
+
+		debounce: options.Debounce,
+		moves:    make(map[uint32]pendingMove),
+	}
+	if err := w.addTree(root, false); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+func (w *inotifyWatcher) close() error {
+	w.movesMu.Lock()
+	if w.expire != nil {
+		w.expire.Stop()
+	}
+	w.movesMu.Unlock()
+	return w.file.Close()
+}
+
+// addTree adds a watch on dir and every directory below it, skipping excluded directories
+// and not following links. With announce set, entries found below dir are reported as
+// created, since they may have appeared before the watch was in place.
+func (w *inotifyWatcher) addTree(dir string, announce bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if path != w.root && isExcluded(d.Name(), w.exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if announce && path != dir {
+			w.emit(WatchEvent{Kind: EventCreate, Path: path, IsDir: d.IsDir()})
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		wd, err := unix.InotifyAddWatch(w.fd, path, inotifyMask)
+		if err != nil {
+			if path == dir {
+				return os.NewSyscallError("inotify_add_watch", err)
+			}
+			w.report(&fs.PathError{Op: "watch", Path: path, Err: err})
+			return filepath.SkipDir
+		}
+		w.mu.Lock()
+		w.dirs[wd] = path
+		w.watch[path] = wd
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// moveTree updates the recorded paths of watched directories at or below oldPath after it
+// was renamed to path.
+func (w *inotifyWatcher) moveTree(oldPath, path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for dir, wd := range w.watch {
+		if dir == oldPath || strings.HasPrefix(dir, oldPath+string(filepath.Separator)) {
+			moved := path + dir[len(oldPath):]
+			delete(w.watch, dir)
+			w.watch[moved] = wd
+			w.dirs[wd] = moved
+		}
+	}
+}
+
+// removeTree drops the watches at or below dir, which has left the watched root.
+func (w *inotifyWatcher) removeTree(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path, wd := range w.watch {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watch, path)
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+// pendingMove is the first half of a rename, waiting for its IN_MOVED_TO.
+type pendingMove struct {
+	path    string
+	isDir   bool
+	expires time.Time // when it is reported as a delete if still unmatched
+}
+
+// addMove records the IN_MOVED_FROM half of a rename.
+func (w *inotifyWatcher) addMove(cookie uint32, path string, isDir bool) {
+	w.movesMu.Lock()
+	defer w.movesMu.Unlock()
+	if len(w.moves) == 0 {
+		if w.expire == nil {
+			w.expire = time.AfterFunc(w.debounce, w.expireMoves)
+		} else {
+			w.expire.Reset(w.debounce)
+		}
+	}
+	w.moves[cookie] = pendingMove{path: path, isDir: isDir, expires: time.Now().Add(w.debounce)}
+	w.order = append(w.order, cookie)
+}
+
+// takeMove returns and forgets the IN_MOVED_FROM half of a rename matching cookie.
+func (w *inotifyWatcher) takeMove(cookie uint32) (pendingMove, bool) {
+	w.movesMu.Lock()
+	defer w.movesMu.Unlock()
+	move, ok := w.moves[cookie]
+	delete(w.moves, cookie)
+	return move, ok
+}
+
+// expireMoves reports the renames whose IN_MOVED_TO has not arrived within the debounce
+// interval as deletes, since entries moved out of the watched root never get one.
+func (w *inotifyWatcher) expireMoves() {
+	now := time.Now()
+	var expired []pendingMove
+	w.movesMu.Lock()
+	var order []uint32
+	for _, cookie := range w.order {
+		move, ok := w.moves[cookie]
+		switch {
+		case !ok:
+		case now.Before(move.expires):
+			order = append(order, cookie)
+		default:
+			expired = append(expired, move)
+			delete(w.moves, cookie)
+		}
+	}
+	w.order = order
+	if len(order) > 0 {
+		w.expire.Reset(w.moves[order[0]].expires.Sub(now))
+	}
+	w.movesMu.Unlock()
+
+	for _, move := range expired {
+		if move.isDir {
+			w.removeTree(move.path)
+		}
+		w.emit(WatchEvent{Kind: EventDelete, Path: move.path, IsDir: move.isDir})
+	}
+}
+
+// readEvents reads and translates inotify events until the watcher is closed.
+func (w *inotifyWatcher) readEvents() {
+	buffer := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buffer)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.report(err)
+			}
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := strings.TrimRight(string(buffer[nameStart:nameStart+int(event.Len)]), "\x00")
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				w.report(ErrWatchOverflow)
+				w.emit(WatchEvent{Kind: EventModify, Path: w.root, IsDir: true})
+				continue
+			}
+			w.mu.Lock()
+			dir, ok := w.dirs[int(event.Wd)]
+			if event.Mask&unix.IN_IGNORED != 0 && ok {
+				delete(w.dirs, int(event.Wd))
+				if w.watch[dir] == int(event.Wd) {
+					delete(w.watch, dir)
+				}
+			}
+			w.mu.Unlock()
+			if !ok || name == "" {
+				if ok && dir == w.root && event.Mask&unix.IN_DELETE_SELF != 0 {
+					w.emit(WatchEvent{Kind: EventDelete, Path: w.root, IsDir: true})
+				}
+				continue
+			}
+
+			path := filepath.Join(dir, name)
+			isDir := event.Mask&unix.IN_ISDIR != 0
+			switch {
+			case event.Mask&unix.IN_CREATE != 0:
+				w.emit(WatchEvent{Kind: EventCreate, Path: path, IsDir: isDir})
+				if isDir && !isExcluded(name, w.exclude) {
+					w.addTree(path, true)
+				}
+			case event.Mask&unix.IN_MOVED_FROM != 0:
+				w.addMove(event.Cookie, path, isDir)
+			case event.Mask&unix.IN_MOVED_TO != 0:
+				if move, ok := w.takeMove(event.Cookie); ok {
+					if isDir {
+						w.moveTree(move.path, path)
+					}
+					w.emit(WatchEvent{Kind: EventRename, Path: path, OldPath: move.path, IsDir: isDir})
+				} else {
+					w.emit(WatchEvent{Kind: EventCreate, Path: path, IsDir: isDir})
+					if isDir && !isExcluded(name, w.exclude) {
+						w.addTree(path, false)
+					}
+				}
+			case event.Mask&unix.IN_DELETE != 0:
+				w.emit(WatchEvent{Kind: EventDelete, Path: path, IsDir: isDir})
+			case event.Mask&(unix.IN_MODIFY|unix.IN_CLOSE_WRITE) != 0:
+				w.emit(WatchEvent{Kind: EventModify, Path: path, IsDir: isDir})
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package core
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInotifyWatcher_MovesAcrossReads(t *testing.T) {
+	var mu sync.Mutex
+	var events []WatchEvent
+	w := &inotifyWatcher{
+		debounce: 20 * time.Millisecond,
+		moves:    make(map[uint32]pendingMove),
+		emit: func(event WatchEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+		},
+	}
+
+	// The halves of a rename split across two reads still match.
+	w.addMove(1, "/root/old.txt", false)
+	w.addMove(2, "/root/gone.txt", false)
+	if move, ok := w.takeMove(1); !ok || move.path != "/root/old.txt" {
+		t.Fatalf("takeMove(1) = %+v, %v; want the pending move", move, ok)
+	}
+
+	// Unmatched halves are reported as deletes once the debounce interval has passed.
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	want := []WatchEvent{{Kind: EventDelete, Path: "/root/gone.txt"}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+	if _, ok := w.takeMove(2); ok {
+		t.Error("expired move is still pending")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package core
+
+// startNativeWatcher reports that no native watcher is available, so Watch polls.
+func startNativeWatcher(root string, options WatchOptions, emit func(WatchEvent), report func(error)) (watchBackend, error) {
+	return nil, errNoNativeWatcher
+}
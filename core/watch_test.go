@@ -0,0 +1,179 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// collectEvents gathers batches from w until done reports true for everything collected
+// so far, failing the test after a timeout.
+func collectEvents(t *testing.T, w *Watcher, done func([]WatchEvent) bool) []WatchEvent {
+	t.Helper()
+	var events []WatchEvent
+	timeout := time.After(5 * time.Second)
+	for !done(events) {
+		select {
+		case batch, ok := <-w.Events():
+			if !ok {
+				t.Fatal("Events channel closed early")
+			}
+			events = append(events, batch...)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for events, got %+v", events)
+		}
+	}
+	return events
+}
+
+// hasEvent returns a predicate reporting whether an event matching want was collected.
+func hasEvent(want WatchEvent) func([]WatchEvent) bool {
+	return func(events []WatchEvent) bool {
+		for _, event := range events {
+			if event == want {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func testWatch(t *testing.T, options WatchOptions) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "existing.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	options.Debounce = 20 * time.Millisecond
+	options.PollInterval = 20 * time.Millisecond
+	options.Exclude = []string{"ignored"}
+	options.TrackTree = true
+	w, err := Watch(root, options)
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	defer w.Close()
+
+	created := filepath.Join(root, "sub", "new.txt")
+	if err := os.MkdirAll(filepath.Join(root, "ignored"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "ignored", "file.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(created), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(created, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	events := collectEvents(t, w, hasEvent(WatchEvent{Kind: EventCreate, Path: created}))
+	for _, event := range events {
+		if filepath.Base(filepath.Dir(event.Path)) == "ignored" || filepath.Base(event.Path) == "ignored" {
+			t.Errorf("Excluded paths should not be reported, got %+v", event)
+		}
+	}
+	tree, ok := w.Tree()
+	if !ok {
+		t.Fatal("Tree should be tracked")
+	}
+	if node, ok := findNode(tree, "sub/new.txt"); !ok || node.Size != 5 {
+		t.Errorf("Tracked tree should contain the new file, got %+v", tree)
+	}
+
+	existing := filepath.Join(root, "existing.txt")
+	renamed := filepath.Join(root, "renamed.txt")
+	if err := os.Rename(existing, renamed); err != nil {
+		t.Fatal(err)
+	}
+	collectEvents(t, w, hasEvent(WatchEvent{Kind: EventRename, Path: renamed, OldPath: existing}))
+
+	if err := os.WriteFile(renamed, []byte("much longer content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	collectEvents(t, w, hasEvent(WatchEvent{Kind: EventModify, Path: renamed}))
+
+	if err := os.RemoveAll(filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	collectEvents(t, w, hasEvent(WatchEvent{Kind: EventDelete, Path: created}))
+
+	tracked, _ := w.Tree()
+	fresh, err := BuildDirTree(root, TreeOptions{Exclude: options.Exclude})
+	if err != nil {
+		t.Fatalf("BuildDirTree failed: %v", err)
+	}
+	trackedJSON, _ := GetTreeMinifiedJSON(tracked)
+	freshJSON, _ := GetTreeMinifiedJSON(fresh)
+	if trackedJSON != freshJSON {
+		t.Errorf("Tracked tree should match a fresh build:\ngot  %s\nwant %s", trackedJSON, freshJSON)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	for range w.Events() {
+	}
+}
+
+func TestWatch(t *testing.T) {
+	testWatch(t, WatchOptions{})
+}
+
+func TestWatch_Polling(t *testing.T) {
+	testWatch(t, WatchOptions{ForcePolling: true})
+}
+
+func TestEventBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   []WatchEvent
+		expected []WatchEvent
+	}{
+		{
+			"create then delete cancels out",
+			[]WatchEvent{{Kind: EventCreate, Path: "a"}, {Kind: EventModify, Path: "a"}, {Kind: EventDelete, Path: "a"}},
+			[]WatchEvent{},
+		},
+		{
+			"delete then create is a modification",
+			[]WatchEvent{{Kind: EventDelete, Path: "a"}, {Kind: EventCreate, Path: "a"}},
+			[]WatchEvent{{Kind: EventModify, Path: "a"}},
+		},
+		{
+			"repeated writes collapse",
+			[]WatchEvent{{Kind: EventModify, Path: "a"}, {Kind: EventModify, Path: "a"}},
+			[]WatchEvent{{Kind: EventModify, Path: "a"}},
+		},
+		{
+			"renaming a new file creates it under the new name",
+			[]WatchEvent{{Kind: EventCreate, Path: "a"}, {Kind: EventRename, Path: "b", OldPath: "a"}},
+			[]WatchEvent{{Kind: EventCreate, Path: "b"}},
+		},
+		{
+			"chained renames",
+			[]WatchEvent{{Kind: EventRename, Path: "b", OldPath: "a"}, {Kind: EventRename, Path: "c", OldPath: "b"}},
+			[]WatchEvent{{Kind: EventRename, Path: "c", OldPath: "a"}},
+		},
+		{
+			"renaming back is a modification",
+			[]WatchEvent{{Kind: EventRename, Path: "b", OldPath: "a"}, {Kind: EventRename, Path: "a", OldPath: "b"}},
+			[]WatchEvent{{Kind: EventModify, Path: "a"}},
+		},
+		{
+			"deleting a renamed file deletes the original",
+			[]WatchEvent{{Kind: EventRename, Path: "b", OldPath: "a"}, {Kind: EventDelete, Path: "b"}},
+			[]WatchEvent{{Kind: EventDelete, Path: "a"}},
+		},
+	}
+	for _, test := range tests {
+		var batch eventBatch
+		for _, event := range test.events {
+			batch.add(event)
+		}
+		if events := batch.flush(); !reflect.DeepEqual(events, test.expected) {
+			t.Errorf("%s: got %+v, want %+v", test.name, events, test.expected)
+		}
+	}
+}
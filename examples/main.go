@@ -84,7 +84,7 @@ func main() {
 
 	// --- Tree Example ---
 	fmt.Println("--- Directory Example ---")
-	tree, err := core.WorkingDirectoryTree(nil, []string{".git", "node_modules", ".DS_Store"})
+	tree, err := core.WorkingDirectoryTree(core.TreeOptions{Exclude: []string{".git", "node_modules", ".DS_Store"}})
 	if err != nil {
 		log.Fatalf("Failed to get working directory tree: %v", err)
 	}
@@ -0,0 +1,15 @@
+package ffs
+
+import "github.com/tesh254/ffs/core"
+
+// NewArchive returns a read-only FileSystem serving the files of a .tar, .tar.gz or .zip
+// archive, so that release artifacts can be explored with Tree, Search and Read without
+// being extracted. The archive is read into memory; paths are resolved against its root,
+// so "/src/main.go" and "src/main.go" name the same file.
+func NewArchive(path string) (FileSystem, error) {
+	backend, err := core.OpenArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithBackend(backend), nil
+}
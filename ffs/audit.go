@@ -0,0 +1,30 @@
+package ffs
+
+import "github.com/tesh254/ffs/core"
+
+// Audited is a FileSystem recording each of its operations to a core.AuditSink, such as a
+// JSONL log opened with core.OpenAuditLog. The log can be replayed with core.ReplayAudit
+// to reconstruct the files the session wrote.
+type Audited struct {
+	FileSystem
+	backend *core.AuditBackend
+}
+
+// WithAudit returns fsys recording its operations to sink.
+func WithAudit(fsys FileSystem, sink core.AuditSink, options core.AuditOptions) (*Audited, error) {
+	inner, err := backendOf(fsys)
+	if err != nil {
+		return nil, err
+	}
+	backend := core.NewAuditBackend(inner, sink, options)
+	return &Audited{FileSystem: NewWithBackend(backend), backend: backend}, nil
+}
+
+// Backend returns the audit backend, for use with the core package.
+func (a *Audited) Backend() *core.AuditBackend {
+	return a.backend
+}
+
+func (a *Audited) coreBackend() core.Backend {
+	return a.backend
+}
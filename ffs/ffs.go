@@ -1,44 +1,215 @@
 package ffs
 
-import "github.com/tesh254/ffs/core"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"path/filepath"
+
+	"github.com/tesh254/ffs/core"
+)
 
 // ffs is the default implementation of the FileSystem interface.
-// It uses the core package to interact with the underlying file system.
-type ffs struct{}
+// It uses the core package to interact with its backend.
+type ffs struct {
+	fs *core.FS
+}
 
-// New returns a new instance of the default FileSystem implementation.
+// New returns a new instance of the default FileSystem implementation, operating on the
+// operating system's filesystem.
 func New() FileSystem {
-	return &ffs{}
+	return NewWithBackend(core.OSBackend{})
+}
+
+// NewWithBackend returns a FileSystem operating on the given backend. Backends that are
+// not a core.WritableBackend give a read-only FileSystem whose modifications fail with
+// core.ErrReadOnly.
+func NewWithBackend(backend core.Backend) FileSystem {
+	return &ffs{fs: core.NewFS(backend)}
+}
+
+// backender is implemented by the FileSystems of this package, which wrappers such as
+// WithPolicy build on.
+type backender interface {
+	coreBackend() core.Backend
+}
+
+// backendOf returns the core backend of fsys, for the wrappers such as WithPolicy.
+func backendOf(fsys FileSystem) (core.Backend, error) {
+	inner, ok := fsys.(backender)
+	if !ok {
+		return nil, fmt.Errorf("cannot wrap %T: not a FileSystem of this package", fsys)
+	}
+	return inner.coreBackend(), nil
+}
+
+func (f *ffs) coreBackend() core.Backend {
+	return f.fs.Backend()
 }
 
 // File returns a new File instance for the given path.
 func (f *ffs) File(path string) File {
-	return &file{path: path}
+	return &file{fs: f.fs, path: path}
 }
 
 // Dir returns a new Dir instance for the given path.
 func (f *ffs) Dir(path string) Dir {
-	return &dir{path: path}
+	return &dir{fs: f.fs, path: path}
 }
 
 // file is the default implementation of the File interface.
 type file struct {
+	fs   *core.FS
 	path string
+	lock *core.FileLock // held by Lock or TryLock until Unlock
 }
 
 // Read reads the content of the file.
 func (f *file) Read() ([]byte, error) {
-	return core.ReadFile(f.path)
+	return f.fs.ReadFile(f.path)
+}
+
+// ReadLines reads lines start through end (1-based, inclusive) of the file.
+func (f *file) ReadLines(start, end int) ([]string, error) {
+	return f.fs.ReadLines(f.path, start, end)
+}
+
+// ReadBytes reads up to length bytes of the file starting at offset.
+func (f *file) ReadBytes(offset, length int64) ([]byte, error) {
+	return f.fs.ReadBytes(f.path, offset, length)
+}
+
+// Chunks splits the file into line-aligned chunks.
+func (f *file) Chunks(options core.ChunkOptions) ([]core.Chunk, error) {
+	return f.fs.ChunkFile(f.path, options)
+}
+
+// Lines reads all lines of the file.
+func (f *file) Lines() ([]string, error) {
+	return f.fs.ReadFileLines(f.path)
+}
+
+// Open opens the file for streaming reads.
+func (f *file) Open() (io.ReadCloser, error) {
+	return f.fs.OpenFile(f.path)
+}
+
+// Stat returns the file info of the file, following links.
+func (f *file) Stat() (iofs.FileInfo, error) {
+	return f.fs.Stat(f.path)
+}
+
+// Exists reports whether the file exists.
+func (f *file) Exists() (bool, error) {
+	return f.fs.Exists(f.path)
 }
 
 // Write writes data to the file.
 func (f *file) Write(data []byte) error {
-	return core.WriteFile(f.path, data)
+	return f.fs.WriteFile(f.path, data)
+}
+
+// WriteWithOptions writes data to the file according to options, such as creating
+// missing parent directories.
+func (f *file) WriteWithOptions(data []byte, options core.WriteOptions) error {
+	return f.fs.WriteFileWithOptions(f.path, data, options)
+}
+
+// Append appends data to the file, creating it if it does not exist.
+func (f *file) Append(data []byte) error {
+	return f.fs.AppendFile(f.path, data)
+}
+
+// Create returns a writer for a new content of the file. The file is replaced when the
+// writer is closed, and is left unchanged until then.
+func (f *file) Create() (io.WriteCloser, error) {
+	return f.fs.CreateFile(f.path)
+}
+
+// Patch applies line-based edits to the file, whatever the FilePath of the request.
+func (f *file) Patch(request core.FileEditRequest) error {
+	request.FilePath = f.path
+	return f.fs.ApplyPatch(request, false, false, false)
+}
+
+// Chmod changes the permission bits of the file.
+func (f *file) Chmod(mode iofs.FileMode) error {
+	return f.fs.Chmod(f.path, mode)
+}
+
+// Rename gives the file a new name in the same directory. The File then refers to the
+// renamed file.
+func (f *file) Rename(name string) error {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return &iofs.PathError{Op: "rename", Path: f.path, Err: fmt.Errorf("invalid file name %q", name)}
+	}
+	return f.Move(filepath.Join(filepath.Dir(f.path), name))
+}
+
+// Move moves the file to path, copying and deleting it when it cannot be renamed across
+// devices. The File then refers to the moved file.
+func (f *file) Move(path string) error {
+	if err := f.fs.MoveFile(f.path, path); err != nil {
+		return err
+	}
+	f.path = path
+	return nil
+}
+
+// Lock takes an exclusive advisory lock on the file, waiting for other lock holders until
+// ctx is done. The lock is held until Unlock.
+func (f *file) Lock(ctx context.Context) error {
+	if f.lock != nil {
+		return &iofs.PathError{Op: "lock", Path: f.path, Err: errors.New("already locked")}
+	}
+	lock, err := f.fs.LockFile(ctx, f.path)
+	if err != nil {
+		return err
+	}
+	f.lock = lock
+	return nil
+}
+
+// TryLock takes an exclusive advisory lock on the file if no one else holds it, and
+// reports whether it did.
+func (f *file) TryLock() (bool, error) {
+	if f.lock != nil {
+		return false, &iofs.PathError{Op: "lock", Path: f.path, Err: errors.New("already locked")}
+	}
+	lock, err := f.fs.TryLockFile(f.path)
+	if errors.Is(err, core.ErrLocked) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	f.lock = lock
+	return true, nil
+}
+
+// Unlock releases the lock taken by Lock or TryLock.
+func (f *file) Unlock() error {
+	if f.lock == nil {
+		return &iofs.PathError{Op: "unlock", Path: f.path, Err: errors.New("not locked")}
+	}
+	err := f.lock.Unlock()
+	f.lock = nil
+	return err
+}
+
+// Copy copies the file with its mode and modification time to path, and returns the copy.
+func (f *file) Copy(path string) (File, error) {
+	if err := f.fs.CopyFile(f.path, path); err != nil {
+		return nil, err
+	}
+	return &file{fs: f.fs, path: path}, nil
 }
 
 // Delete deletes the file.
 func (f *file) Delete() error {
-	return core.DeleteFile(f.path)
+	return f.fs.DeleteFile(f.path)
 }
 
 // Path returns the path of the file.
@@ -48,17 +219,18 @@ func (f *file) Path() string {
 
 // dir is the default implementation of the Dir interface.
 type dir struct {
+	fs   *core.FS
 	path string
 }
 
 // Create creates the directory.
 func (d *dir) Create() error {
-	return core.CreateDir(d.path)
+	return d.fs.CreateDir(d.path)
 }
 
 // Delete deletes the directory.
 func (d *dir) Delete() error {
-	return core.DeleteDir(d.path)
+	return d.fs.DeleteDir(d.path)
 }
 
 // Path returns the path of the directory.
@@ -67,6 +239,68 @@ func (d *dir) Path() string {
 }
 
 // Tree returns the directories tree.
-func (d *dir) Tree(include, exclude []string) (core.DirectoryTree, error) {
-	return core.BuildDirTree(d.path, include, exclude)
+func (d *dir) Tree(options core.TreeOptions) (core.DirectoryTree, error) {
+	return d.fs.BuildDirTree(d.path, options)
+}
+
+// List returns the entries of the directory sorted by name.
+func (d *dir) List() ([]iofs.DirEntry, error) {
+	return d.fs.ListDir(d.path)
+}
+
+// Glob returns the paths below the directory whose slash-separated path relative to it
+// matches pattern, where a "**" segment matches any number of directories.
+func (d *dir) Glob(pattern string) ([]string, error) {
+	return d.fs.Glob(d.path, pattern)
+}
+
+// Walk walks the directory like fs.WalkDir, calling fn with paths joined to the path of
+// the directory. Returning fs.SkipDir or fs.SkipAll from fn skips entries.
+func (d *dir) Walk(fn iofs.WalkDirFunc) error {
+	return d.fs.WalkDir(d.path, fn)
+}
+
+// Search searches the files below the directory for query.
+func (d *dir) Search(query string, options core.SearchOptions) ([]core.SearchResult, error) {
+	return d.fs.SearchFiles(d.path, query, options)
+}
+
+// Copy copies the directory recursively to path, keeping the modes and modification
+// times of its entries and recreating links, and returns the copy.
+func (d *dir) Copy(path string) (Dir, error) {
+	if err := d.fs.CopyDir(d.path, path); err != nil {
+		return nil, err
+	}
+	return &dir{fs: d.fs, path: path}, nil
+}
+
+// Move moves the directory to path, copying and deleting it when it cannot be renamed
+// across devices. The Dir then refers to the moved directory.
+func (d *dir) Move(path string) error {
+	if err := d.fs.MoveFile(d.path, path); err != nil {
+		return err
+	}
+	d.path = path
+	return nil
+}
+
+// Size returns the total size of the regular files below the directory.
+func (d *dir) Size() (int64, error) {
+	return d.fs.DirSize(d.path)
+}
+
+// IsEmpty reports whether the directory has no entries.
+func (d *dir) IsEmpty() (bool, error) {
+	return d.fs.IsEmptyDir(d.path)
+}
+
+// Export writes the directory to a new tar, tar.gz or zip archive at dst, with entries named
+// by their path relative to the directory and selected by the include and exclude patterns
+// of options.
+func (d *dir) Export(dst string, options core.ArchiveOptions) error {
+	tree, err := d.fs.BuildDirTree(d.path, core.TreeOptions{Include: options.Include, Exclude: options.Exclude, SkipBinaryCheck: true})
+	if err != nil {
+		return err
+	}
+	return d.fs.ExportArchive(tree, dst, options)
 }
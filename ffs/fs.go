@@ -1,9 +1,19 @@
 package ffs
 
-import "github.com/tesh254/ffs/core"
+import (
+	"context"
+	"io"
+	"io/fs"
+
+	"github.com/tesh254/ffs/core"
+)
 
 // FileSystem provides an interface for file and directory operations.
 // It abstracts the underlying file system, allowing for easier testing and extension.
+//
+// The wrappers ReadOnly, WithAudit, WithPolicy, WithQuota, WithRedaction and WithTrash
+// apply to the FileSystems of this package, such as those returned by New, NewMemory,
+// NewOverlay, NewRooted, NewArchive and the wrappers themselves, and fail on others.
 type FileSystem interface {
 	File(path string) File
 	Dir(path string) Dir
@@ -12,7 +22,25 @@ type FileSystem interface {
 // File provides an interface for file-specific operations.
 type File interface {
 	Read() ([]byte, error)
+	ReadLines(start, end int) ([]string, error)
+	ReadBytes(offset, length int64) ([]byte, error)
+	Chunks(options core.ChunkOptions) ([]core.Chunk, error)
+	Lines() ([]string, error)
+	Open() (io.ReadCloser, error)
+	Stat() (fs.FileInfo, error)
+	Exists() (bool, error)
 	Write(data []byte) error
+	WriteWithOptions(data []byte, options core.WriteOptions) error
+	Append(data []byte) error
+	Create() (io.WriteCloser, error)
+	Patch(request core.FileEditRequest) error
+	Chmod(mode fs.FileMode) error
+	Rename(name string) error
+	Move(path string) error
+	Copy(path string) (File, error)
+	Lock(ctx context.Context) error
+	TryLock() (bool, error)
+	Unlock() error
 	Delete() error
 	Path() string
 }
@@ -22,5 +50,14 @@ type Dir interface {
 	Create() error
 	Delete() error
 	Path() string
-	Tree(include, exclude []string) (core.DirectoryTree, error)
+	Tree(options core.TreeOptions) (core.DirectoryTree, error)
+	List() ([]fs.DirEntry, error)
+	Glob(pattern string) ([]string, error)
+	Walk(fn fs.WalkDirFunc) error
+	Search(query string, options core.SearchOptions) ([]core.SearchResult, error)
+	Copy(path string) (Dir, error)
+	Move(path string) error
+	Size() (int64, error)
+	IsEmpty() (bool, error)
+	Export(dst string, options core.ArchiveOptions) error
 }
@@ -0,0 +1,10 @@
+package ffs
+
+import "github.com/tesh254/ffs/core"
+
+// NewMemory returns a FileSystem that keeps everything in memory and never touches disk.
+// It starts out with an empty root directory; paths are resolved against that root, so
+// "/src/main.go" and "src/main.go" name the same file.
+func NewMemory() FileSystem {
+	return NewWithBackend(core.NewMemoryBackend())
+}
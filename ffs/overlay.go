@@ -0,0 +1,52 @@
+package ffs
+
+import "github.com/tesh254/ffs/core"
+
+// Overlay is a copy-on-write FileSystem over the operating system's filesystem. Writes and
+// deletes only affect a scratch layer until they are committed, while reads, searches and
+// trees see the scratch layer merged over the real files. It lets agents make speculative
+// edits, run checks against them and then keep or throw them away.
+type Overlay struct {
+	FileSystem
+	backend *core.OverlayBackend
+}
+
+// NewOverlay returns an Overlay whose changes are kept in upper, such as a
+// core.NewMemoryBackend() or a core.NewDirBackend on a temporary directory. A nil upper
+// keeps changes in memory.
+func NewOverlay(upper core.WritableBackend) *Overlay {
+	if upper == nil {
+		upper = core.NewMemoryBackend()
+	}
+	backend := core.NewOverlayBackend(core.OSBackend{}, upper)
+	return &Overlay{FileSystem: NewWithBackend(backend), backend: backend}
+}
+
+// Backend returns the overlay backend, for use with the core package.
+func (o *Overlay) Backend() *core.OverlayBackend {
+	return o.backend
+}
+
+func (o *Overlay) coreBackend() core.Backend {
+	return o.backend
+}
+
+// Changes lists the added, modified and deleted paths, sorted by path.
+func (o *Overlay) Changes() ([]core.OverlayChange, error) {
+	return o.backend.Changes()
+}
+
+// Diff renders the pending changes to files as unified diffs.
+func (o *Overlay) Diff() (string, error) {
+	return o.backend.Diff()
+}
+
+// Commit writes the pending changes to disk.
+func (o *Overlay) Commit() error {
+	return o.backend.Commit()
+}
+
+// Discard drops the pending changes.
+func (o *Overlay) Discard() error {
+	return o.backend.Discard()
+}
@@ -0,0 +1,33 @@
+package ffs
+
+import "github.com/tesh254/ffs/core"
+
+// Restricted is a FileSystem whose operations are checked against a core.Policy. Denied
+// operations fail with a *core.PolicyError, which matches core.ErrPolicyDenied, and trees
+// leave out the entries the policy hides.
+type Restricted struct {
+	FileSystem
+	backend *core.PolicyBackend
+}
+
+// WithPolicy returns fsys restricted by policy.
+func WithPolicy(fsys FileSystem, policy core.Policy) (*Restricted, error) {
+	inner, err := backendOf(fsys)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := core.NewPolicyBackend(inner, policy)
+	if err != nil {
+		return nil, err
+	}
+	return &Restricted{FileSystem: NewWithBackend(backend), backend: backend}, nil
+}
+
+// Backend returns the policy backend, for use with the core package.
+func (r *Restricted) Backend() *core.PolicyBackend {
+	return r.backend
+}
+
+func (r *Restricted) coreBackend() core.Backend {
+	return r.backend
+}
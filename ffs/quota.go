@@ -0,0 +1,41 @@
+package ffs
+
+import "github.com/tesh254/ffs/core"
+
+// Limited is a FileSystem enforcing a core.Quota on the bytes read and written, the files
+// touched and the searches made, so that runaway agents cannot read the whole disk.
+// Operations exceeding a limit fail with a *core.QuotaError, which matches
+// core.ErrQuotaExceeded.
+type Limited struct {
+	FileSystem
+	backend *core.QuotaBackend
+}
+
+// WithQuota returns fsys limited by quota.
+func WithQuota(fsys FileSystem, quota core.Quota) (*Limited, error) {
+	inner, err := backendOf(fsys)
+	if err != nil {
+		return nil, err
+	}
+	backend := core.NewQuotaBackend(inner, quota)
+	return &Limited{FileSystem: NewWithBackend(backend), backend: backend}, nil
+}
+
+// Backend returns the quota backend, for use with the core package.
+func (l *Limited) Backend() *core.QuotaBackend {
+	return l.backend
+}
+
+// Usage returns what the session has used of its quota.
+func (l *Limited) Usage() core.QuotaUsage {
+	return l.backend.Usage()
+}
+
+// Reset clears the usage to start a new session.
+func (l *Limited) Reset() {
+	l.backend.Reset()
+}
+
+func (l *Limited) coreBackend() core.Backend {
+	return l.backend
+}
@@ -0,0 +1,14 @@
+package ffs
+
+import "github.com/tesh254/ffs/core"
+
+// ReadOnly returns a view of fsys for agents that may only explore: reads, trees and
+// searches work as usual, while writes, deletions and directory creations fail with
+// core.ErrReadOnly.
+func ReadOnly(fsys FileSystem) (FileSystem, error) {
+	inner, err := backendOf(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithBackend(core.NewReadOnlyBackend(inner)), nil
+}
@@ -0,0 +1,30 @@
+package ffs
+
+import "github.com/tesh254/ffs/core"
+
+// Redacted is a FileSystem masking secrets such as API keys and private keys in the content
+// it reads, and refusing writes that introduce new ones with a *core.SecretError.
+type Redacted struct {
+	FileSystem
+	backend *core.RedactBackend
+}
+
+// WithRedaction returns fsys redacted by scanner, or by core.NewSecretScanner() if scanner
+// is nil.
+func WithRedaction(fsys FileSystem, scanner *core.SecretScanner) (*Redacted, error) {
+	inner, err := backendOf(fsys)
+	if err != nil {
+		return nil, err
+	}
+	backend := core.NewRedactBackend(inner, scanner)
+	return &Redacted{FileSystem: NewWithBackend(backend), backend: backend}, nil
+}
+
+// Backend returns the redacting backend, for use with the core package.
+func (r *Redacted) Backend() *core.RedactBackend {
+	return r.backend
+}
+
+func (r *Redacted) coreBackend() core.Backend {
+	return r.backend
+}
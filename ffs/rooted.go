@@ -0,0 +1,35 @@
+package ffs
+
+import "github.com/tesh254/ffs/core"
+
+// Rooted is a FileSystem confined to a directory, for paths that cannot be trusted such as
+// those coming from an LLM. Every path is resolved relative to the root, absolute paths
+// included, and paths escaping it through ".." or symbolic links fail with
+// core.ErrOutsideRoot.
+type Rooted struct {
+	FileSystem
+	backend *core.RootBackend
+}
+
+// NewRooted returns a FileSystem confined to dir. Close it to release the directory.
+func NewRooted(dir string) (*Rooted, error) {
+	backend, err := core.NewRootBackend(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Rooted{FileSystem: NewWithBackend(backend), backend: backend}, nil
+}
+
+// Backend returns the rooted backend, for use with the core package.
+func (r *Rooted) Backend() *core.RootBackend {
+	return r.backend
+}
+
+func (r *Rooted) coreBackend() core.Backend {
+	return r.backend
+}
+
+// Close releases the root directory.
+func (r *Rooted) Close() error {
+	return r.backend.Close()
+}
@@ -0,0 +1,53 @@
+package ffs
+
+import "github.com/tesh254/ffs/core"
+
+// Trashed is a FileSystem moving what is deleted through it into a trash directory
+// instead of deleting it, so that deletions can be undone.
+type Trashed struct {
+	FileSystem
+	backend *core.TrashBackend
+}
+
+// WithTrash returns fsys with deletions moved into the trash directory dir, or into
+// core.DefaultTrashDir if dir is empty.
+func WithTrash(fsys FileSystem, dir string) (*Trashed, error) {
+	inner, err := backendOf(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		if dir, err = core.DefaultTrashDir(); err != nil {
+			return nil, err
+		}
+	}
+	backend, err := core.NewTrashBackend(inner, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Trashed{FileSystem: NewWithBackend(backend), backend: backend}, nil
+}
+
+// Backend returns the trash backend, for use with the core package.
+func (t *Trashed) Backend() *core.TrashBackend {
+	return t.backend
+}
+
+// ListTrash returns the entries of the trash, oldest first.
+func (t *Trashed) ListTrash() ([]core.TrashItem, error) {
+	return t.backend.ListTrash()
+}
+
+// Restore moves the entry of the trash called name back to where it was deleted from.
+func (t *Trashed) Restore(name string) (core.TrashItem, error) {
+	return t.backend.Restore(name)
+}
+
+// EmptyTrash permanently deletes every entry of the trash.
+func (t *Trashed) EmptyTrash() error {
+	return t.backend.EmptyTrash()
+}
+
+func (t *Trashed) coreBackend() core.Backend {
+	return t.backend
+}
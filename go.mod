@@ -1,3 +1,8 @@
 module github.com/tesh254/ffs
 
 go 1.24.3
+
+require (
+	golang.org/x/sys v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
+)